@@ -12,6 +12,7 @@ import (
 	"os"
 	"path"
 
+	"github.com/filecoin-project/storetheindex/api/v0/admin/model"
 	"github.com/filecoin-project/storetheindex/internal/httpclient"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -22,8 +23,10 @@ var log = logging.Logger("adminhttpclient")
 const (
 	adminPort = 3002
 
-	importResource = "/import"
-	ingestResource = "/ingest"
+	importResource     = "/import"
+	ingestResource     = "/ingest"
+	providersResource  = "/providers"
+	valueStoreResource = "/valuestore"
 )
 
 // Client is an http client for the indexer finder API,
@@ -113,6 +116,53 @@ func (c *Client) Unsubscribe(ctx context.Context, provID peer.ID) error {
 	return c.ingestRequest(ctx, provID, "unsubscribe")
 }
 
+// SetProviderLabels replaces the labels that the indexer's operator assigns to
+// a registered provider.  Empty labels remove all labels.
+func (c *Client) SetProviderLabels(ctx context.Context, provID peer.ID, labels map[string]string) error {
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	u := c.baseURL + path.Join(providersResource, provID.String(), "labels")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpclient.ReadErrorFrom(resp.StatusCode, resp.Body)
+	}
+	return nil
+}
+
+// CheckValueStore starts a background scan of the indexer's value store, that
+// reports corrupt records, values with bad metadata, and values from unknown
+// providers.  The report is read using ValueStoreStatus once the check is
+// finished.
+func (c *Client) CheckValueStore(ctx context.Context) (*model.CheckStatus, error) {
+	return c.valueStoreRequest(ctx, http.MethodPost, "check", http.StatusAccepted)
+}
+
+// CompactValueStore starts a background scan of the indexer's value store, as
+// CheckValueStore does, that also removes bad values and values from unknown
+// providers.
+func (c *Client) CompactValueStore(ctx context.Context) (*model.CheckStatus, error) {
+	return c.valueStoreRequest(ctx, http.MethodPost, "compact", http.StatusAccepted)
+}
+
+// ValueStoreStatus returns the status of the running value store check, or of
+// the latest check if none is running.
+func (c *Client) ValueStoreStatus(ctx context.Context) (*model.CheckStatus, error) {
+	return c.valueStoreRequest(ctx, http.MethodGet, "status", http.StatusOK)
+}
+
 func (c *Client) ListLogSubSystems(ctx context.Context) ([]string, error) {
 	u := c.baseURL + "/config/log/subsystems"
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
@@ -183,6 +233,30 @@ func (c *Client) ingestRequest(ctx context.Context, provID peer.ID, action strin
 	return nil
 }
 
+func (c *Client) valueStoreRequest(ctx context.Context, method, action string, okStatus int) (*model.CheckStatus, error) {
+	u := c.baseURL + path.Join(valueStoreResource, action)
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != okStatus {
+		return nil, httpclient.ReadErrorFrom(resp.StatusCode, resp.Body)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return model.UnmarshalCheckStatus(body)
+}
+
 func (c *Client) newUploadRequest(ctx context.Context, uri, fileName string, contextID, metadata []byte) (*http.Request, error) {
 	file, err := os.Open(fileName)
 	if err != nil {
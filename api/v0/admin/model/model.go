@@ -0,0 +1,91 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CheckReport describes the result of checking or compacting the value
+// store.
+type CheckReport struct {
+	// Multihashes is the number of multihashes scanned.  When compacting,
+	// this is counted in the final scan, after values with bad metadata are
+	// removed.
+	Multihashes int
+	// Values is the number of values scanned, counting a value once for each
+	// multihash that maps to it.
+	Values int
+	// Corrupt is the number of records that could not be read.
+	Corrupt int
+	// BadMetadata is the number of values whose metadata cannot be decoded.
+	BadMetadata int
+	// UnknownProvider is the number of values from providers that are not in
+	// the registry.
+	UnknownProvider int
+	// Removed is the number of values with bad metadata that were removed.
+	Removed int
+	// RemovedProviders is the number of unknown providers whose values were
+	// removed.
+	RemovedProviders int
+	// StartSize is the size of the value store, in bytes, before the check.
+	StartSize int64
+	// EndSize is the size of the value store, in bytes, after the check.
+	EndSize int64
+	// Reclaimed is the number of bytes reclaimed by removing values.
+	Reclaimed int64
+}
+
+// MarshalCheckReport serializes a check report.
+func MarshalCheckReport(r *CheckReport) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// UnmarshalCheckReport de-serializes a check report.
+func UnmarshalCheckReport(b []byte) (*CheckReport, error) {
+	r := &CheckReport{}
+	err := json.Unmarshal(b, r)
+	return r, err
+}
+
+func (r *CheckReport) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "Multihashes:      ", r.Multihashes)
+	fmt.Fprintln(&b, "Values:           ", r.Values)
+	fmt.Fprintln(&b, "Corrupt:          ", r.Corrupt)
+	fmt.Fprintln(&b, "BadMetadata:      ", r.BadMetadata)
+	fmt.Fprintln(&b, "UnknownProvider:  ", r.UnknownProvider)
+	fmt.Fprintln(&b, "Removed:          ", r.Removed)
+	fmt.Fprintln(&b, "RemovedProviders: ", r.RemovedProviders)
+	fmt.Fprintln(&b, "Reclaimed bytes:  ", r.Reclaimed)
+	return b.String()
+}
+
+// CheckStatus is the state of the value store check or compaction that is
+// running, or that ran last.
+type CheckStatus struct {
+	// Running is true while the check is in progress.
+	Running bool
+	// Compact is true if the check removes bad values.
+	Compact bool
+	// Started is when the check started.
+	Started string `json:",omitempty"`
+	// Finished is when the check finished.
+	Finished string `json:",omitempty"`
+	// Error is the reason the check did not complete.
+	Error string `json:",omitempty"`
+	// Report is the result of a completed check.
+	Report *CheckReport `json:",omitempty"`
+}
+
+// MarshalCheckStatus serializes a check status.
+func MarshalCheckStatus(s *CheckStatus) ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// UnmarshalCheckStatus de-serializes a check status.
+func UnmarshalCheckStatus(b []byte) (*CheckStatus, error) {
+	s := &CheckStatus{}
+	err := json.Unmarshal(b, s)
+	return s, err
+}
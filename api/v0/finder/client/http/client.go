@@ -2,28 +2,51 @@ package finderhttpclient
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
 	"github.com/filecoin-project/storetheindex/internal/httpclient"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multibase"
 	"github.com/multiformats/go-multihash"
 )
 
 var log = logging.Logger("finderhttpclient")
 
 const (
-	finderResource = "multihash"
-	finderPort     = 3000
+	finderResource    = "multihash"
+	providersResource = "providers"
+	finderPort        = 3000
 )
 
+const (
+	// acceptFindResponse prefers the more compact binary encodings of find
+	// responses.
+	acceptFindResponse = model.ProtobufContentType + ", " + model.CBORContentType + ";q=0.9, " + model.JSONContentType + ";q=0.8"
+	// acceptEncoding lists the content codings that responses are decoded
+	// from.
+	acceptEncoding = "zstd, gzip"
+)
+
+// zstdDecoder is shared by all clients, since DecodeAll is safe to call
+// concurrently.
+var zstdDecoder, _ = zstd.NewReader(nil)
+
 // Client is an http client for the indexer finder API
 type Client struct {
-	c       *http.Client
-	baseURL string
+	c            *http.Client
+	baseURL      string
+	providersURL string
 }
 
 // New creates a new finder HTTP client.
@@ -32,12 +55,20 @@ func New(baseURL string, options ...httpclient.Option) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	baseURL = u.String()
+	u.Path = providersResource
 	return &Client{
-		c:       c,
-		baseURL: u.String(),
+		c:            c,
+		baseURL:      baseURL,
+		providersURL: u.String(),
 	}, nil
 }
 
+// CloseIdleConnections closes the client's connections that are not in use.
+func (c *Client) CloseIdleConnections() {
+	c.c.CloseIdleConnections()
+}
+
 // Find queries indexer entries for a multihash
 func (c *Client) Find(ctx context.Context, m multihash.Multihash) (*model.FindResponse, error) {
 	u := c.baseURL + "/" + m.B58String()
@@ -51,10 +82,30 @@ func (c *Client) Find(ctx context.Context, m multihash.Multihash) (*model.FindRe
 
 // FindBatch queries indexer entries for a batch of multihashes
 func (c *Client) FindBatch(ctx context.Context, mhs []multihash.Multihash) (*model.FindResponse, error) {
-	if len(mhs) == 0 {
+	return c.FindBatchCursors(ctx, mhs, nil)
+}
+
+// FindBatchFilter queries indexer entries for a batch of multihashes, only
+// returning the provider results selected by filter.
+func (c *Client) FindBatchFilter(ctx context.Context, mhs []multihash.Multihash, filter model.FindFilter) (*model.FindResponse, error) {
+	return c.FindBatchRequest(ctx, &model.FindRequest{Multihashes: mhs, FindFilter: filter})
+}
+
+// FindBatchCursors queries indexer entries for a batch of multihashes,
+// continuing each from the cursor returned in a previous response.  If
+// cursors is not nil, then it must have one cursor, which may be empty, for
+// each multihash.
+func (c *Client) FindBatchCursors(ctx context.Context, mhs []multihash.Multihash, cursors []string) (*model.FindResponse, error) {
+	return c.FindBatchRequest(ctx, &model.FindRequest{Multihashes: mhs, Cursors: cursors})
+}
+
+// FindBatchRequest sends a find request, that can have cursors and a filter,
+// for a batch of multihashes.
+func (c *Client) FindBatchRequest(ctx context.Context, findReq *model.FindRequest) (*model.FindResponse, error) {
+	if len(findReq.Multihashes) == 0 {
 		return &model.FindResponse{}, nil
 	}
-	data, err := model.MarshalFindRequest(&model.FindRequest{Multihashes: mhs})
+	data, err := model.MarshalFindRequest(findReq)
 	if err != nil {
 		return nil, err
 	}
@@ -65,12 +116,146 @@ func (c *Client) FindBatch(ctx context.Context, mhs []multihash.Multihash) (*mod
 	return c.sendRequest(req)
 }
 
+// FindBatchStream queries indexer entries for a batch of multihashes, using
+// newline-delimited JSON for the request and response.  Each result is passed
+// to resultFunc as soon as it is received.  If resultFunc returns an error,
+// then no more results are read.
+func (c *Client) FindBatchStream(ctx context.Context, mhs []multihash.Multihash, resultFunc func(model.MultihashResult) error) error {
+	return c.FindBatchStreamCursors(ctx, mhs, nil, resultFunc)
+}
+
+// FindBatchStreamCursors is like FindBatchStream, but continues each multihash
+// from the cursor returned in a previous result.  If cursors is not nil, then
+// it must have one cursor, which may be empty, for each multihash.
+func (c *Client) FindBatchStreamCursors(ctx context.Context, mhs []multihash.Multihash, cursors []string, resultFunc func(model.MultihashResult) error) error {
+	if len(mhs) == 0 {
+		return nil
+	}
+	if cursors != nil && len(cursors) != len(mhs) {
+		return fmt.Errorf("got %d cursors for %d multihashes", len(cursors), len(mhs))
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(pw)
+		for i := range mhs {
+			item := model.FindRequestItem{Multihash: mhs[i]}
+			if cursors != nil {
+				item.Cursor = cursors[i]
+			}
+			if err := enc.Encode(&item); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", model.NDJSONContentType)
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpclient.ReadErrorFrom(resp.StatusCode, resp.Body)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var result model.FindStreamResult
+		err = dec.Decode(&result)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if result.Error != "" {
+			return fmt.Errorf("streaming find failed: %s", result.Error)
+		}
+		if err = resultFunc(result.MultihashResult); err != nil {
+			return err
+		}
+	}
+}
+
+// ProviderContexts lists the contexts indexed for a provider.
+func (c *Client) ProviderContexts(ctx context.Context, providerID peer.ID) (*model.ProviderContextsResponse, error) {
+	u := c.providersURL + "/" + providerID.String() + "/contexts"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.sendListRequest(req)
+	if err != nil || b == nil {
+		return &model.ProviderContextsResponse{Provider: providerID}, err
+	}
+	return model.UnmarshalProviderContextsResponse(b)
+}
+
+// ContextMultihashes lists one page of the multihashes indexed for a provider
+// context.  The next page is requested using the NextOffset from the
+// response.  A limit of 0 requests the indexer's maximum page size.
+func (c *Client) ContextMultihashes(ctx context.Context, providerID peer.ID, contextID []byte, offset, limit int) (*model.ContextMultihashesResponse, error) {
+	encCtxID, err := multibase.Encode(multibase.Base64url, contextID)
+	if err != nil {
+		return nil, err
+	}
+	u := c.providersURL + "/" + providerID.String() + "/contexts/" + encCtxID + "/multihashes"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	if offset != 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+	if limit != 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	b, err := c.sendListRequest(req)
+	if err != nil || b == nil {
+		return &model.ContextMultihashesResponse{Provider: providerID, ContextID: contextID}, err
+	}
+	return model.UnmarshalContextMultihashesResponse(b)
+}
+
+func (c *Client) sendListRequest(req *http.Request) ([]byte, error) {
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, httpclient.ReadErrorFrom(resp.StatusCode, resp.Body)
+	}
+	return io.ReadAll(resp.Body)
+}
+
 func (c *Client) sendRequest(req *http.Request) (*model.FindResponse, error) {
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", acceptFindResponse)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
 	resp, err := c.c.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
 	// Handle failed requests
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusNotFound {
@@ -80,11 +265,40 @@ func (c *Client) sendRequest(req *http.Request) (*model.FindResponse, error) {
 		return nil, fmt.Errorf("batch find query failed: %v", http.StatusText(resp.StatusCode))
 	}
 
-	defer resp.Body.Close()
-	b, err := io.ReadAll(resp.Body)
+	b, err := readBody(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	return model.UnmarshalFindResponse(b)
+	// Indexers that do not support other encodings send JSON, possibly
+	// without a content type.
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch contentType {
+	case model.CBORContentType, model.ProtobufContentType:
+	default:
+		contentType = model.JSONContentType
+	}
+	return model.UnmarshalFindResponseAs(b, contentType)
+}
+
+// readBody reads the response body, decompressing it if it is compressed.
+func readBody(resp *http.Response) ([]byte, error) {
+	switch resp.Header.Get("Content-Encoding") {
+	case "":
+		return io.ReadAll(resp.Body)
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return io.ReadAll(gz)
+	case "zstd":
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return zstdDecoder.DecodeAll(b, nil)
+	}
+	return nil, fmt.Errorf("unsupported response content encoding %q", resp.Header.Get("Content-Encoding"))
 }
@@ -15,7 +15,8 @@ import (
 )
 
 type Client struct {
-	p2pc *libp2pclient.Client
+	p2pc  *libp2pclient.Client
+	codec pb.FinderMessage_Codec
 }
 
 func New(p2pHost host.Host, peerID peer.ID) (*Client, error) {
@@ -24,10 +25,17 @@ func New(p2pHost host.Host, peerID peer.ID) (*Client, error) {
 		return nil, err
 	}
 	return &Client{
-		p2pc: client,
+		p2pc:  client,
+		codec: pb.FinderMessage_PROTOBUF,
 	}, nil
 }
 
+// SetCodec sets the encoding that find responses are requested in.  The
+// default is protobuf, which is the most compact.
+func (c *Client) SetCodec(codec pb.FinderMessage_Codec) {
+	c.codec = codec
+}
+
 // Connect connects the client to the host at the location specified by
 // hostname.  The value of hostname is a host or host:port, where the host is a
 // hostname or IP address.
@@ -44,28 +52,54 @@ func (c *Client) Find(ctx context.Context, m multihash.Multihash) (*model.FindRe
 }
 
 func (c *Client) FindBatch(ctx context.Context, mhs []multihash.Multihash) (*model.FindResponse, error) {
-	if len(mhs) == 0 {
+	return c.FindBatchCursors(ctx, mhs, nil)
+}
+
+// FindBatchFilter queries indexer entries for a batch of multihashes, only
+// returning the provider results selected by filter.
+func (c *Client) FindBatchFilter(ctx context.Context, mhs []multihash.Multihash, filter model.FindFilter) (*model.FindResponse, error) {
+	return c.FindBatchRequest(ctx, &model.FindRequest{Multihashes: mhs, FindFilter: filter})
+}
+
+// FindBatchCursors queries indexer entries for a batch of multihashes,
+// continuing each from the cursor returned in a previous response.  If
+// cursors is not nil, then it must have one cursor, which may be empty, for
+// each multihash.
+func (c *Client) FindBatchCursors(ctx context.Context, mhs []multihash.Multihash, cursors []string) (*model.FindResponse, error) {
+	return c.FindBatchRequest(ctx, &model.FindRequest{Multihashes: mhs, Cursors: cursors})
+}
+
+// FindBatchRequest sends a find request, that can have cursors and a filter,
+// for a batch of multihashes.
+func (c *Client) FindBatchRequest(ctx context.Context, findReq *model.FindRequest) (*model.FindResponse, error) {
+	if len(findReq.Multihashes) == 0 {
 		return &model.FindResponse{}, nil
 	}
 
-	data, err := model.MarshalFindRequest(&model.FindRequest{Multihashes: mhs})
+	data, err := model.MarshalFindRequest(findReq)
 	if err != nil {
 		return nil, err
 	}
 	req := &pb.FinderMessage{
-		Type: pb.FinderMessage_GET,
-		Data: data,
+		Type:  pb.FinderMessage_GET,
+		Data:  data,
+		Codec: c.codec,
 	}
 
-	data, err = c.sendRecv(ctx, req, pb.FinderMessage_GET_RESPONSE)
+	resp, err := c.sendRecv(ctx, req, pb.FinderMessage_GET_RESPONSE)
 	if err != nil {
 		return nil, err
 	}
 
-	return model.UnmarshalFindResponse(data)
+	// Indexers that do not support other codecs respond with JSON.
+	contentType := model.CodecContentType(resp.GetCodec())
+	if contentType == "" {
+		return nil, fmt.Errorf("unsupported response codec %d", resp.GetCodec())
+	}
+	return model.UnmarshalFindResponseAs(resp.GetData(), contentType)
 }
 
-func (c *Client) sendRecv(ctx context.Context, req *pb.FinderMessage, expectRspType pb.FinderMessage_MessageType) ([]byte, error) {
+func (c *Client) sendRecv(ctx context.Context, req *pb.FinderMessage, expectRspType pb.FinderMessage_MessageType) (*pb.FinderMessage, error) {
 	resp := new(pb.FinderMessage)
 	err := c.p2pc.SendRequest(ctx, req, func(data []byte) error {
 		return resp.Unmarshal(data)
@@ -79,5 +113,5 @@ func (c *Client) sendRecv(ctx context.Context, req *pb.FinderMessage, expectRspT
 		}
 		return nil, fmt.Errorf("response type is not %s", expectRspType.String())
 	}
-	return resp.GetData(), nil
+	return resp, nil
 }
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+// verifyingFinder is a Finder that checks that all find responses are signed
+// by a specific indexer.
+type verifyingFinder struct {
+	Finder
+	indexerID peer.ID
+}
+
+// VerifySignatures wraps a Finder so that every find response is checked for
+// a valid signature from the indexer identified by indexerID.  A response that
+// is not signed, or is signed by a different indexer, returns an error.  This
+// allows trusting responses that come through proxies or caches.
+//
+// A response with no results is accepted without a signature, since an
+// indexer does not return a response body when nothing is found.
+func VerifySignatures(finder Finder, indexerID peer.ID) Finder {
+	return &verifyingFinder{
+		Finder:    finder,
+		indexerID: indexerID,
+	}
+}
+
+func (f *verifyingFinder) Find(ctx context.Context, m multihash.Multihash) (*model.FindResponse, error) {
+	rsp, err := f.Finder.Find(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	return rsp, f.verify(rsp)
+}
+
+func (f *verifyingFinder) FindBatch(ctx context.Context, mhs []multihash.Multihash) (*model.FindResponse, error) {
+	rsp, err := f.Finder.FindBatch(ctx, mhs)
+	if err != nil {
+		return nil, err
+	}
+	return rsp, f.verify(rsp)
+}
+
+func (f *verifyingFinder) verify(rsp *model.FindResponse) error {
+	if len(rsp.MultihashResults) == 0 && len(rsp.Signature) == 0 {
+		return nil
+	}
+	signerID, err := rsp.VerifySignature()
+	if err != nil {
+		return fmt.Errorf("cannot verify find response: %w", err)
+	}
+	if signerID != f.indexerID {
+		return fmt.Errorf("find response signed by %s, expected %s", signerID, f.indexerID)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+)
+
+// DecodeCid decodes a CID from its string form.  A CIDv0 is base58btc, and a
+// CIDv1 may be in any multibase encoding, such as base32, base36, or
+// base58btc, in either case where the encoding allows.  All encodings of the
+// same CID decode to the same value, so they find the same results.
+func DecodeCid(s string) (cid.Cid, error) {
+	return cid.Decode(strings.TrimSpace(s))
+}
+
+// CidCodec returns the IPLD codec of the content that a CID identifies.
+func CidCodec(c cid.Cid) multicodec.Code {
+	return multicodec.Code(c.Type())
+}
+
+// InlineData returns the data inlined in an identity multihash, and true, or
+// returns false if the multihash is not an identity multihash.
+func InlineData(mh multihash.Multihash) ([]byte, bool) {
+	dmh, err := multihash.Decode(mh)
+	if err != nil || dmh.Code != multihash.IDENTITY {
+		return nil, false
+	}
+	return dmh.Digest, true
+}
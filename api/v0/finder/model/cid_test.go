@@ -0,0 +1,63 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestDecodeCid(t *testing.T) {
+	mh := util.RandomMultihashes(1)[0]
+	c := cid.NewCidV1(cid.DagProtobuf, mh)
+
+	strs := []string{cid.NewCidV0(mh).String()}
+	for _, base := range []multibase.Encoding{multibase.Base32, multibase.Base32Upper, multibase.Base36, multibase.Base36Upper, multibase.Base58BTC} {
+		s, err := c.StringOfBase(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		strs = append(strs, s)
+	}
+	strs = append(strs, " "+c.String()+"\n")
+
+	for _, s := range strs {
+		decoded, err := DecodeCid(s)
+		if err != nil {
+			t.Fatalf("cannot decode %q: %s", s, err)
+		}
+		if !bytes.Equal(decoded.Hash(), mh) {
+			t.Fatalf("%q decoded to wrong multihash", s)
+		}
+		if CidCodec(decoded) != multicodec.DagPb {
+			t.Fatalf("%q decoded to codec %s, expected dag-pb", s, CidCodec(decoded))
+		}
+	}
+
+	if _, err := DecodeCid("not-a-cid"); err == nil {
+		t.Fatal("expected error decoding invalid cid")
+	}
+}
+
+func TestInlineData(t *testing.T) {
+	data := []byte("inline content")
+	idMh, err := multihash.Sum(data, multihash.IDENTITY, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inline, ok := InlineData(idMh)
+	if !ok {
+		t.Fatal("expected identity multihash to have inline data")
+	}
+	if !bytes.Equal(inline, data) {
+		t.Fatalf("expected inline data %q, got %q", data, inline)
+	}
+
+	if _, ok = InlineData(util.RandomMultihashes(1)[0]); ok {
+		t.Fatal("expected no inline data for sha2-256 multihash")
+	}
+}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/filecoin-project/storetheindex/api/v0"
+	pb "github.com/filecoin-project/storetheindex/api/v0/finder/pb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multicodec"
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// Media types of the encodings that find responses can be serialized with.
+const (
+	JSONContentType     = "application/json"
+	CBORContentType     = "application/cbor"
+	ProtobufContentType = "application/x-protobuf"
+)
+
+// ErrUnsupportedEncoding is returned when a find response is serialized with
+// an unknown media type.
+var ErrUnsupportedEncoding = errors.New("unsupported find response encoding")
+
+// MarshalFindResponseAs serializes a find response using the encoding
+// identified by contentType, which is one of JSONContentType,
+// CBORContentType, or ProtobufContentType.
+func MarshalFindResponseAs(r *FindResponse, contentType string) ([]byte, error) {
+	switch contentType {
+	case JSONContentType:
+		return MarshalFindResponse(r)
+	case CBORContentType:
+		return refmt.MarshalAtlased(cbor.EncodeOptions{}, toWire(r), cborAtlas)
+	case ProtobufContentType:
+		return proto.Marshal(toWire(r))
+	}
+	return nil, ErrUnsupportedEncoding
+}
+
+// UnmarshalFindResponseAs de-serializes a find response that was serialized
+// using the encoding identified by contentType.
+func UnmarshalFindResponseAs(b []byte, contentType string) (*FindResponse, error) {
+	var wr pb.FindResponse
+	switch contentType {
+	case JSONContentType:
+		return UnmarshalFindResponse(b)
+	case CBORContentType:
+		if err := refmt.UnmarshalAtlased(cbor.DecodeOptions{}, b, &wr, cborAtlas); err != nil {
+			return nil, err
+		}
+	case ProtobufContentType:
+		if err := proto.Unmarshal(b, &wr); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+	return fromWire(&wr)
+}
+
+// The binary encodings serialize a find response as the protobuf messages in
+// the pb package, which hold the response in plain types.  Peer IDs and
+// multiaddrs are in their binary form.  In CBOR, each message is a map keyed
+// by field name.
+
+var cborAtlas = atlas.MustBuild(
+	atlas.BuildEntry(pb.FindResponse{}).StructMap().
+		AddField("MultihashResults", atlas.StructMapEntry{SerialName: "multihashResults"}).
+		AddField("Signature", atlas.StructMapEntry{SerialName: "signature", OmitEmpty: true}).
+		Complete(),
+	atlas.BuildEntry(pb.MultihashResult{}).StructMap().
+		AddField("Multihash", atlas.StructMapEntry{SerialName: "multihash"}).
+		AddField("ProviderResults", atlas.StructMapEntry{SerialName: "providerResults"}).
+		AddField("Cursor", atlas.StructMapEntry{SerialName: "cursor", OmitEmpty: true}).
+		AddField("Data", atlas.StructMapEntry{SerialName: "data", OmitEmpty: true}).
+		Complete(),
+	atlas.BuildEntry(pb.ProviderResult{}).StructMap().
+		AddField("ContextId", atlas.StructMapEntry{SerialName: "contextID"}).
+		AddField("ProtocolId", atlas.StructMapEntry{SerialName: "protocolID"}).
+		AddField("Metadata", atlas.StructMapEntry{SerialName: "metadata"}).
+		AddField("ProviderId", atlas.StructMapEntry{SerialName: "providerID"}).
+		AddField("ProviderAddrs", atlas.StructMapEntry{SerialName: "providerAddrs"}).
+		AddField("Score", atlas.StructMapEntry{SerialName: "score", OmitEmpty: true}).
+		AddField("Upstream", atlas.StructMapEntry{SerialName: "upstream", OmitEmpty: true}).
+		Complete(),
+)
+
+// CodecContentType returns the media type of the find response encoding
+// identified by a libp2p finder message codec, or an empty string if the codec
+// is not known.
+func CodecContentType(codec pb.FinderMessage_Codec) string {
+	switch codec {
+	case pb.FinderMessage_JSON:
+		return JSONContentType
+	case pb.FinderMessage_CBOR:
+		return CBORContentType
+	case pb.FinderMessage_PROTOBUF:
+		return ProtobufContentType
+	}
+	return ""
+}
+
+func toWire(r *FindResponse) *pb.FindResponse {
+	wr := &pb.FindResponse{
+		MultihashResults: make([]*pb.MultihashResult, len(r.MultihashResults)),
+		Signature:        r.Signature,
+	}
+	for i := range r.MultihashResults {
+		mhr := &r.MultihashResults[i]
+		wmhr := &pb.MultihashResult{
+			Multihash:       mhr.Multihash,
+			ProviderResults: make([]*pb.ProviderResult, len(mhr.ProviderResults)),
+			Cursor:          mhr.Cursor,
+			Data:            mhr.Data,
+		}
+		for j := range mhr.ProviderResults {
+			pr := &mhr.ProviderResults[j]
+			wpr := &pb.ProviderResult{
+				ContextId:     pr.ContextID,
+				ProtocolId:    uint64(pr.Metadata.ProtocolID),
+				Metadata:      pr.Metadata.Data,
+				ProviderId:    []byte(pr.Provider.ID),
+				ProviderAddrs: make([][]byte, len(pr.Provider.Addrs)),
+				Score:         pr.Score,
+				Upstream:      pr.Upstream,
+			}
+			for k, a := range pr.Provider.Addrs {
+				wpr.ProviderAddrs[k] = a.Bytes()
+			}
+			wmhr.ProviderResults[j] = wpr
+		}
+		wr.MultihashResults[i] = wmhr
+	}
+	return wr
+}
+
+func fromWire(wr *pb.FindResponse) (*FindResponse, error) {
+	r := &FindResponse{
+		MultihashResults: make([]MultihashResult, len(wr.MultihashResults)),
+		Signature:        wr.Signature,
+	}
+	for i, wmhr := range wr.MultihashResults {
+		mhr := MultihashResult{
+			Multihash:       wmhr.Multihash,
+			ProviderResults: make([]ProviderResult, len(wmhr.ProviderResults)),
+			Cursor:          wmhr.Cursor,
+			Data:            wmhr.Data,
+		}
+		for j, wpr := range wmhr.ProviderResults {
+			provID, err := peer.IDFromBytes(wpr.ProviderId)
+			if err != nil {
+				return nil, fmt.Errorf("bad provider id: %w", err)
+			}
+			pr := ProviderResult{
+				ContextID: wpr.ContextId,
+				Metadata: v0.Metadata{
+					ProtocolID: multicodec.Code(wpr.ProtocolId),
+					Data:       wpr.Metadata,
+				},
+				Provider: peer.AddrInfo{
+					ID:    provID,
+					Addrs: make([]multiaddr.Multiaddr, len(wpr.ProviderAddrs)),
+				},
+				Score:    wpr.Score,
+				Upstream: wpr.Upstream,
+			}
+			for k, b := range wpr.ProviderAddrs {
+				pr.Provider.Addrs[k], err = multiaddr.NewMultiaddrBytes(b)
+				if err != nil {
+					return nil, fmt.Errorf("bad provider address: %w", err)
+				}
+			}
+			mhr.ProviderResults[j] = pr
+		}
+		r.MultihashResults[i] = mhr
+	}
+	return r, nil
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestEncodings(t *testing.T) {
+	mhs := util.RandomMultihashes(3)
+	p, err := peer.Decode("12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/udp/1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := multiaddr.NewMultiaddr("/dns4/example.com/tcp/443/wss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &FindResponse{}
+	for i := range mhs {
+		resp.MultihashResults = append(resp.MultihashResults, MultihashResult{
+			Multihash: mhs[i],
+			ProviderResults: []ProviderResult{
+				{
+					ContextID: []byte("test-context-id"),
+					Metadata: v0.Metadata{
+						ProtocolID: testProtoID,
+						Data:       []byte(mhs[i]),
+					},
+					Provider: peer.AddrInfo{
+						ID:    p,
+						Addrs: []multiaddr.Multiaddr{m1, m2},
+					},
+					Score:    0.75,
+					Upstream: "upstream-1",
+				},
+			},
+		})
+	}
+	resp.MultihashResults[0].Cursor = "next"
+	resp.MultihashResults[1].Data = []byte("inline data")
+
+	privKey, _, err := p2ptest.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resp.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	signerID, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonData, err := MarshalFindResponseAs(resp, JSONContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, contentType := range []string{JSONContentType, CBORContentType, ProtobufContentType} {
+		data, err := MarshalFindResponseAs(resp, contentType)
+		if err != nil {
+			t.Fatalf("cannot marshal %s: %s", contentType, err)
+		}
+		if contentType != JSONContentType && len(data) >= len(jsonData) {
+			t.Errorf("%s encoding is %d bytes, not smaller than %d bytes of json", contentType, len(data), len(jsonData))
+		}
+
+		r, err := UnmarshalFindResponseAs(data, contentType)
+		if err != nil {
+			t.Fatalf("cannot unmarshal %s: %s", contentType, err)
+		}
+		got, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, expect) {
+			t.Fatalf("%s round trip changed response:\n%s\n%s", contentType, got, expect)
+		}
+		verifiedID, err := r.VerifySignature()
+		if err != nil {
+			t.Fatalf("cannot verify signature of %s response: %s", contentType, err)
+		}
+		if verifiedID != signerID {
+			t.Fatalf("wrong signer of %s response", contentType)
+		}
+	}
+
+	if _, err = MarshalFindResponseAs(resp, "text/plain"); err != ErrUnsupportedEncoding {
+		t.Fatalf("expected ErrUnsupportedEncoding, got %v", err)
+	}
+}
@@ -8,12 +8,53 @@ import (
 
 	"github.com/filecoin-project/storetheindex/api/v0"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 )
 
+// NDJSONContentType is the media type of streaming find requests and
+// responses, where each line is a separate JSON value.
+const NDJSONContentType = "application/x-ndjson"
+
 // FindRequest is the client request send by end user clients
 type FindRequest struct {
 	Multihashes []multihash.Multihash
+	// Cursors, if present, has a cursor for each multihash in Multihashes.  A
+	// non-empty cursor continues reading provider results for the
+	// corresponding multihash from where a previous response left off.
+	Cursors []string `json:",omitempty"`
+	// FindFilter, if not empty, selects which provider results are returned.
+	FindFilter
+	// NoCascade, if true, tells the indexer not to query its upstream
+	// indexers.  An indexer sets this on the requests it forwards upstream,
+	// so that requests do not loop between indexers that cascade to each
+	// other.
+	NoCascade bool `json:",omitempty"`
+}
+
+// FindFilter selects which provider results are returned from a find request.
+// Empty fields do not filter results.
+type FindFilter struct {
+	// Protocols, if not empty, only allows results with metadata that has one
+	// of these protocol IDs.
+	Protocols []multicodec.Code `json:",omitempty"`
+	// Providers, if not empty, only allows results from these providers.
+	Providers []peer.ID `json:",omitempty"`
+	// ExcludeProviders excludes results from these providers.
+	ExcludeProviders []peer.ID `json:",omitempty"`
+	// ContextIDPrefix, if not empty, only allows results with a context ID
+	// that starts with this prefix.
+	ContextIDPrefix []byte `json:",omitempty"`
+	// Codecs, if not empty, only allows results from providers that serve
+	// content with one of these IPLD codecs.  Results from providers that have
+	// not advertised which codecs they serve are always allowed.
+	Codecs []multicodec.Code `json:",omitempty"`
+}
+
+// FindRequestItem is one line of a streaming (NDJSON) find request.
+type FindRequestItem struct {
+	Multihash multihash.Multihash
+	Cursor    string `json:",omitempty"`
 }
 
 // ProviderResult is a one of possibly multiple results when looking up a
@@ -25,19 +66,67 @@ type ProviderResult struct {
 	Metadata v0.Metadata
 	// Provider is the peer ID and addresses of the provider.
 	Provider peer.AddrInfo
+	// Score is the provider's rank, from 0 to 1, when the indexer ranks
+	// provider results.  Results are ordered from highest to lowest score.
+	Score float64 `json:",omitempty"`
+	// Upstream is set when the result came from an upstream indexer, instead
+	// of from this indexer, and identifies that upstream indexer.
+	Upstream string `json:",omitempty"`
 }
 
 // MultihashResult aggregates all values for a single multihash.
 type MultihashResult struct {
 	Multihash       multihash.Multihash
 	ProviderResults []ProviderResult
+	// Cursor is set when there are more provider results than were returned.
+	// It is used in a subsequent request to get the next results.
+	Cursor string `json:",omitempty"`
+	// Data is the content inlined in an identity multihash.  It is returned,
+	// without any provider results, instead of looking up the multihash.
+	Data []byte `json:",omitempty"`
+}
+
+// FindStreamResult is one line of a streaming (NDJSON) find response.  Each
+// line holds a MultihashResult, except when the request cannot be completed,
+// in which case the last line holds only an Error.
+type FindStreamResult struct {
+	MultihashResult
+	Error string `json:",omitempty"`
 }
 
 // FindResponse used to answer client queries/requests
 type FindResponse struct {
 	MultihashResults []MultihashResult
-	// NOTE: This feature is not enabled yet.
-	// Signature []byte	// Providers signature.
+	// Signature is the indexer's signature of the response, if the indexer
+	// signs responses.  See VerifySignature.
+	Signature []byte `json:",omitempty"`
+}
+
+// ContextResult describes a context indexed for a provider.
+type ContextResult struct {
+	// ContextID identifies the context.
+	ContextID []byte
+	// Metadata is the most recent metadata for the context.
+	Metadata v0.Metadata
+	// MultihashCount is the number of multihashes indexed for the context.
+	MultihashCount uint64
+}
+
+// ProviderContextsResponse lists the contexts indexed for a provider.
+type ProviderContextsResponse struct {
+	Provider peer.ID
+	Contexts []ContextResult
+}
+
+// ContextMultihashesResponse lists one page of the multihashes indexed for a
+// provider context.
+type ContextMultihashesResponse struct {
+	Provider    peer.ID
+	ContextID   []byte
+	Multihashes []multihash.Multihash
+	// NextOffset is the offset at which to request the next page of
+	// multihashes.  It is zero if there are no more multihashes.
+	NextOffset int `json:",omitempty"`
 }
 
 // Equal compares ProviderResult values to determine if they are equal.  The
@@ -55,6 +144,13 @@ func (pr ProviderResult) Equal(other ProviderResult) bool {
 	return true
 }
 
+// IsEmpty returns true if the filter does not filter any results.
+func (f FindFilter) IsEmpty() bool {
+	return len(f.Protocols) == 0 && len(f.Providers) == 0 &&
+		len(f.ExcludeProviders) == 0 && len(f.ContextIDPrefix) == 0 &&
+		len(f.Codecs) == 0
+}
+
 // MarshalReq serializes the request. Currently uses JSON, but could use
 // anything else.
 //
@@ -84,6 +180,33 @@ func UnmarshalFindResponse(b []byte) (*FindResponse, error) {
 	return r, err
 }
 
+// MarshalProviderContextsResponse serializes a provider contexts response.
+func MarshalProviderContextsResponse(r *ProviderContextsResponse) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// UnmarshalProviderContextsResponse de-serializes a provider contexts
+// response.
+func UnmarshalProviderContextsResponse(b []byte) (*ProviderContextsResponse, error) {
+	r := &ProviderContextsResponse{}
+	err := json.Unmarshal(b, r)
+	return r, err
+}
+
+// MarshalContextMultihashesResponse serializes a context multihashes
+// response.
+func MarshalContextMultihashesResponse(r *ContextMultihashesResponse) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// UnmarshalContextMultihashesResponse de-serializes a context multihashes
+// response.
+func UnmarshalContextMultihashesResponse(b []byte) (*ContextMultihashesResponse, error) {
+	r := &ContextMultihashesResponse{}
+	err := json.Unmarshal(b, r)
+	return r, err
+}
+
 func (r *FindResponse) String() string {
 	var b strings.Builder
 	for i := range r.MultihashResults {
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"encoding/json"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multicodec"
+)
+
+// Multicodec codes for the retrieval transports that are recognized in
+// provider metadata.
+const (
+	TransportBitswap             multicodec.Code = 0x0900
+	TransportGraphsyncFilecoinV1 multicodec.Code = 0x0910
+)
+
+// Delegated routing schemas and protocol names for the recognized transports.
+const (
+	RoutingSchemaBitswap     = "bitswap"
+	RoutingSchemaGraphsync   = "graphsync-filecoinv1"
+	RoutingSchemaUnknown     = "unknown"
+	RoutingProtocolBitswap   = "transport-bitswap"
+	RoutingProtocolGraphsync = "transport-graphsync-filecoinv1"
+)
+
+// RoutingProvidersResponse is the response to a delegated routing find
+// providers request, in the form used by the IPFS delegated routing HTTP API.
+type RoutingProvidersResponse struct {
+	Providers []RoutingProviderRecord
+}
+
+// RoutingProviderRecord describes a provider of content and the transport
+// used to retrieve the content from it.
+type RoutingProviderRecord struct {
+	// Protocol is the name of the retrieval transport, if known.
+	Protocol string
+	// Schema identifies the type of record, and is the transport name
+	// without the "transport-" prefix, or "unknown".
+	Schema string
+	// ID is the provider's peer ID.
+	ID peer.ID
+	// Addrs are the provider's multiaddrs.
+	Addrs []string `json:",omitempty"`
+}
+
+// RoutingTransport returns the delegated routing protocol name and schema
+// for a metadata protocol ID.  If the protocol ID is not a recognized
+// transport, then the protocol is the multicodec name of the code, and the
+// schema is unknown.
+func RoutingTransport(protocolID multicodec.Code) (protocol, schema string) {
+	switch protocolID {
+	case TransportBitswap:
+		return RoutingProtocolBitswap, RoutingSchemaBitswap
+	case TransportGraphsyncFilecoinV1:
+		return RoutingProtocolGraphsync, RoutingSchemaGraphsync
+	}
+	return protocolID.String(), RoutingSchemaUnknown
+}
+
+// MarshalRoutingProvidersResponse serializes a delegated routing response.
+func MarshalRoutingProvidersResponse(r *RoutingProvidersResponse) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// UnmarshalRoutingProvidersResponse de-serializes a delegated routing
+// response.
+func UnmarshalRoutingProvidersResponse(b []byte) (*RoutingProvidersResponse, error) {
+	r := &RoutingProvidersResponse{}
+	err := json.Unmarshal(b, r)
+	return r, err
+}
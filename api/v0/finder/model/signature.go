@@ -0,0 +1,126 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"math"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	findSignatureCodec  = "/indexer/finder/findSignature"
+	findSignatureDomain = "indexer"
+)
+
+// ErrNotSigned is returned when verifying a find response that has no
+// signature.
+var ErrNotSigned = errors.New("find response is not signed")
+
+type findSignatureRecord struct {
+	payload []byte
+}
+
+func (r *findSignatureRecord) Domain() string {
+	return findSignatureDomain
+}
+
+func (r *findSignatureRecord) Codec() []byte {
+	return []byte(findSignatureCodec)
+}
+
+func (r *findSignatureRecord) MarshalRecord() ([]byte, error) {
+	return r.payload, nil
+}
+
+func (r *findSignatureRecord) UnmarshalRecord(buf []byte) error {
+	r.payload = buf
+	return nil
+}
+
+// Sign signs the find response with the indexer's private key, and stores the
+// signature, as a libp2p signed envelope, in the response.
+func (r *FindResponse) Sign(privKey crypto.PrivKey) error {
+	payload, err := r.signaturePayload()
+	if err != nil {
+		return err
+	}
+	env, err := record.Seal(&findSignatureRecord{payload: payload}, privKey)
+	if err != nil {
+		return err
+	}
+	r.Signature, err = env.Marshal()
+	return err
+}
+
+// VerifySignature checks that the find response signature is valid for the
+// contents of the response, and returns the ID of the indexer that signed the
+// response.  Returns ErrNotSigned if the response has no signature.
+func (r *FindResponse) VerifySignature() (peer.ID, error) {
+	if len(r.Signature) == 0 {
+		return "", ErrNotSigned
+	}
+	rec := &findSignatureRecord{}
+	env, err := record.ConsumeTypedEnvelope(r.Signature, rec)
+	if err != nil {
+		return "", err
+	}
+	payload, err := r.signaturePayload()
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(payload, rec.payload) {
+		return "", errors.New("signature does not match find response")
+	}
+	return peer.IDFromPublicKey(env.PublicKey)
+}
+
+// signaturePayload generates the data that is signed.  This is a hash of the
+// response contents, independent of how the response is serialized.
+func (r *FindResponse) signaturePayload() ([]byte, error) {
+	h := sha256.New()
+	writeUvarint(h, uint64(len(r.MultihashResults)))
+	for i := range r.MultihashResults {
+		mhr := &r.MultihashResults[i]
+		writeBytes(h, mhr.Multihash)
+		writeBytes(h, []byte(mhr.Cursor))
+		writeBytes(h, mhr.Data)
+		writeUvarint(h, uint64(len(mhr.ProviderResults)))
+		for j := range mhr.ProviderResults {
+			pr := &mhr.ProviderResults[j]
+			writeBytes(h, pr.ContextID)
+			metadata, err := pr.Metadata.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			writeBytes(h, metadata)
+			writeBytes(h, []byte(pr.Provider.ID))
+			writeUvarint(h, uint64(len(pr.Provider.Addrs)))
+			for _, addr := range pr.Provider.Addrs {
+				writeBytes(h, addr.Bytes())
+			}
+			writeUvarint(h, math.Float64bits(pr.Score))
+			writeBytes(h, []byte(pr.Upstream))
+		}
+	}
+	return multihash.Encode(h.Sum(nil), multihash.SHA2_256)
+}
+
+func writeUvarint(h hash.Hash, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	h.Write(buf[:n])
+}
+
+// writeBytes writes length-prefixed data, so that the boundaries between
+// fields are part of what is signed.
+func writeBytes(h hash.Hash, data []byte) {
+	writeUvarint(h, uint64(len(data)))
+	h.Write(data)
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestSignFindResponse(t *testing.T) {
+	priv, pub, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexerID, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mhs := util.RandomMultihashes(2)
+	p, err := peer.Decode("12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	maddr, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/udp/1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &FindResponse{}
+	for i := range mhs {
+		resp.MultihashResults = append(resp.MultihashResults, MultihashResult{
+			Multihash: mhs[i],
+			ProviderResults: []ProviderResult{{
+				ContextID: []byte("test-context-id"),
+				Metadata:  v0.Metadata{ProtocolID: testProtoID, Data: []byte("data")},
+				Provider: peer.AddrInfo{
+					ID:    p,
+					Addrs: []multiaddr.Multiaddr{maddr},
+				},
+			}},
+		})
+	}
+
+	if _, err = resp.VerifySignature(); err != ErrNotSigned {
+		t.Fatalf("expected error %q, got %v", ErrNotSigned, err)
+	}
+
+	if err = resp.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that signature survives serialization.
+	b, err := MarshalFindResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = UnmarshalFindResponse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerID, err := resp.VerifySignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signerID != indexerID {
+		t.Fatalf("expected signer %s, got %s", indexerID, signerID)
+	}
+
+	// Altering the response invalidates the signature.
+	resp.MultihashResults[1].ProviderResults[0].ContextID = []byte("other-context-id")
+	if _, err = resp.VerifySignature(); err == nil {
+		t.Fatal("expected signature verification to fail for altered response")
+	}
+}
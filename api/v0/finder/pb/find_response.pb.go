@@ -0,0 +1,1177 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: find_response.proto
+
+package reqresp_pb
+
+import (
+	encoding_binary "encoding/binary"
+	fmt "fmt"
+	proto "github.com/gogo/protobuf/proto"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+type FindResponse struct {
+	MultihashResults []*MultihashResult `protobuf:"bytes,1,rep,name=multihash_results,json=multihashResults,proto3" json:"multihash_results,omitempty"`
+	Signature        []byte             `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *FindResponse) Reset()         { *m = FindResponse{} }
+func (m *FindResponse) String() string { return proto.CompactTextString(m) }
+func (*FindResponse) ProtoMessage()    {}
+func (*FindResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_13d37e415f6750d1, []int{0}
+}
+func (m *FindResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *FindResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_FindResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *FindResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FindResponse.Merge(m, src)
+}
+func (m *FindResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *FindResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_FindResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FindResponse proto.InternalMessageInfo
+
+func (m *FindResponse) GetMultihashResults() []*MultihashResult {
+	if m != nil {
+		return m.MultihashResults
+	}
+	return nil
+}
+
+func (m *FindResponse) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+type MultihashResult struct {
+	Multihash       []byte            `protobuf:"bytes,1,opt,name=multihash,proto3" json:"multihash,omitempty"`
+	ProviderResults []*ProviderResult `protobuf:"bytes,2,rep,name=provider_results,json=providerResults,proto3" json:"provider_results,omitempty"`
+	Cursor          string            `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Data            []byte            `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *MultihashResult) Reset()         { *m = MultihashResult{} }
+func (m *MultihashResult) String() string { return proto.CompactTextString(m) }
+func (*MultihashResult) ProtoMessage()    {}
+func (*MultihashResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_13d37e415f6750d1, []int{1}
+}
+func (m *MultihashResult) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *MultihashResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_MultihashResult.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *MultihashResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MultihashResult.Merge(m, src)
+}
+func (m *MultihashResult) XXX_Size() int {
+	return m.Size()
+}
+func (m *MultihashResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_MultihashResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MultihashResult proto.InternalMessageInfo
+
+func (m *MultihashResult) GetMultihash() []byte {
+	if m != nil {
+		return m.Multihash
+	}
+	return nil
+}
+
+func (m *MultihashResult) GetProviderResults() []*ProviderResult {
+	if m != nil {
+		return m.ProviderResults
+	}
+	return nil
+}
+
+func (m *MultihashResult) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+func (m *MultihashResult) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type ProviderResult struct {
+	ContextId     []byte   `protobuf:"bytes,1,opt,name=context_id,json=contextId,proto3" json:"context_id,omitempty"`
+	ProtocolId    uint64   `protobuf:"varint,2,opt,name=protocol_id,json=protocolId,proto3" json:"protocol_id,omitempty"`
+	Metadata      []byte   `protobuf:"bytes,3,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	ProviderId    []byte   `protobuf:"bytes,4,opt,name=provider_id,json=providerId,proto3" json:"provider_id,omitempty"`
+	ProviderAddrs [][]byte `protobuf:"bytes,5,rep,name=provider_addrs,json=providerAddrs,proto3" json:"provider_addrs,omitempty"`
+	Score         float64  `protobuf:"fixed64,6,opt,name=score,proto3" json:"score,omitempty"`
+	Upstream      string   `protobuf:"bytes,7,opt,name=upstream,proto3" json:"upstream,omitempty"`
+}
+
+func (m *ProviderResult) Reset()         { *m = ProviderResult{} }
+func (m *ProviderResult) String() string { return proto.CompactTextString(m) }
+func (*ProviderResult) ProtoMessage()    {}
+func (*ProviderResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_13d37e415f6750d1, []int{2}
+}
+func (m *ProviderResult) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ProviderResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ProviderResult.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ProviderResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProviderResult.Merge(m, src)
+}
+func (m *ProviderResult) XXX_Size() int {
+	return m.Size()
+}
+func (m *ProviderResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProviderResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProviderResult proto.InternalMessageInfo
+
+func (m *ProviderResult) GetContextId() []byte {
+	if m != nil {
+		return m.ContextId
+	}
+	return nil
+}
+
+func (m *ProviderResult) GetProtocolId() uint64 {
+	if m != nil {
+		return m.ProtocolId
+	}
+	return 0
+}
+
+func (m *ProviderResult) GetMetadata() []byte {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *ProviderResult) GetProviderId() []byte {
+	if m != nil {
+		return m.ProviderId
+	}
+	return nil
+}
+
+func (m *ProviderResult) GetProviderAddrs() [][]byte {
+	if m != nil {
+		return m.ProviderAddrs
+	}
+	return nil
+}
+
+func (m *ProviderResult) GetScore() float64 {
+	if m != nil {
+		return m.Score
+	}
+	return 0
+}
+
+func (m *ProviderResult) GetUpstream() string {
+	if m != nil {
+		return m.Upstream
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*FindResponse)(nil), "reqresp.pb.FindResponse")
+	proto.RegisterType((*MultihashResult)(nil), "reqresp.pb.MultihashResult")
+	proto.RegisterType((*ProviderResult)(nil), "reqresp.pb.ProviderResult")
+}
+
+func init() { proto.RegisterFile("find_response.proto", fileDescriptor_13d37e415f6750d1) }
+
+var fileDescriptor_13d37e415f6750d1 = []byte{
+	// 354 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x90, 0xd1, 0x4e, 0xc2, 0x30,
+	0x14, 0x86, 0x29, 0x03, 0x94, 0x03, 0x02, 0x56, 0x63, 0x1a, 0xd4, 0xb9, 0x90, 0x98, 0xec, 0x6a,
+	0x17, 0xfa, 0x04, 0x9a, 0x68, 0xe4, 0xc2, 0xc4, 0xf4, 0x05, 0xc8, 0x58, 0xab, 0x2c, 0x61, 0xeb,
+	0x6c, 0x3b, 0xe2, 0x63, 0xf8, 0x0c, 0x3e, 0x8d, 0x97, 0x5c, 0x7a, 0x69, 0x20, 0xf1, 0x39, 0xcc,
+	0x4a, 0x37, 0xc4, 0xbb, 0xfd, 0xdf, 0xfe, 0xff, 0x9c, 0xff, 0x14, 0x8e, 0x9e, 0xe3, 0x94, 0x4d,
+	0x24, 0x57, 0x99, 0x48, 0x15, 0x0f, 0x32, 0x29, 0xb4, 0xc0, 0x20, 0xf9, 0x6b, 0x81, 0x82, 0x6c,
+	0x3a, 0x5a, 0x40, 0xf7, 0x3e, 0x4e, 0x19, 0xb5, 0x0e, 0xfc, 0x00, 0x87, 0x49, 0x3e, 0xd7, 0xf1,
+	0x2c, 0x54, 0xb3, 0x22, 0x97, 0xcf, 0xb5, 0x22, 0xc8, 0x73, 0xfc, 0xce, 0xd5, 0x69, 0xb0, 0xcd,
+	0x05, 0x8f, 0xa5, 0x89, 0x1a, 0x0f, 0x1d, 0x24, 0xbb, 0x40, 0xe1, 0x33, 0x68, 0xab, 0xf8, 0x25,
+	0x0d, 0x75, 0x2e, 0x39, 0xa9, 0x7b, 0xc8, 0xef, 0xd2, 0x2d, 0x18, 0x7d, 0x20, 0xe8, 0xff, 0x9b,
+	0x51, 0x24, 0xaa, 0x29, 0x04, 0x6d, 0x12, 0x15, 0xc0, 0x77, 0x30, 0xc8, 0xa4, 0x58, 0xc4, 0x8c,
+	0xcb, 0xaa, 0x58, 0xdd, 0x14, 0x1b, 0xfe, 0x2d, 0xf6, 0x64, 0x3d, 0xb6, 0x57, 0x3f, 0xdb, 0xd1,
+	0x0a, 0x9f, 0x40, 0x2b, 0xca, 0xa5, 0x12, 0x92, 0x38, 0x1e, 0xf2, 0xdb, 0xd4, 0x2a, 0x8c, 0xa1,
+	0xc1, 0x42, 0x1d, 0x92, 0x86, 0xd9, 0x6b, 0xbe, 0x47, 0x3f, 0x08, 0x7a, 0xbb, 0xf3, 0xf0, 0x39,
+	0x40, 0x24, 0x52, 0xcd, 0xdf, 0xf4, 0x24, 0x66, 0x65, 0x49, 0x4b, 0xc6, 0x0c, 0x5f, 0x40, 0xc7,
+	0xbc, 0x71, 0x24, 0xe6, 0xc5, 0xff, 0xe2, 0xec, 0x06, 0x85, 0x12, 0x8d, 0x19, 0x1e, 0xc2, 0x7e,
+	0xc2, 0x75, 0x68, 0x56, 0x39, 0x26, 0x5d, 0x69, 0x1b, 0xde, 0x5c, 0x18, 0x33, 0xdb, 0x04, 0x4a,
+	0x34, 0x66, 0xf8, 0x12, 0x7a, 0x95, 0x21, 0x64, 0x4c, 0x2a, 0xd2, 0xf4, 0x1c, 0xbf, 0x4b, 0x0f,
+	0x4a, 0x7a, 0x53, 0x40, 0x7c, 0x0c, 0x4d, 0x15, 0x09, 0xc9, 0x49, 0xcb, 0x43, 0x3e, 0xa2, 0x1b,
+	0x51, 0x6c, 0xce, 0x33, 0xa5, 0x25, 0x0f, 0x13, 0xb2, 0x67, 0x4e, 0xaf, 0xf4, 0x2d, 0xf9, 0x5c,
+	0xb9, 0x68, 0xb9, 0x72, 0xd1, 0xf7, 0xca, 0x45, 0xef, 0x6b, 0xb7, 0xb6, 0x5c, 0xbb, 0xb5, 0xaf,
+	0xb5, 0x5b, 0x9b, 0xb6, 0x4c, 0xf7, 0xeb, 0xdf, 0x01, 0x00, 0x85, 0x22, 0x36, 0xc6, 0x49, 0x02,
+	0x00, 0x00,
+}
+
+func (m *FindResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *FindResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *FindResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Signature) > 0 {
+		i -= len(m.Signature)
+		copy(dAtA[i:], m.Signature)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.Signature)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.MultihashResults) > 0 {
+		for iNdEx := len(m.MultihashResults) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.MultihashResults[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintFindResponse(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *MultihashResult) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MultihashResult) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MultihashResult) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Data) > 0 {
+		i -= len(m.Data)
+		copy(dAtA[i:], m.Data)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.Data)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.Cursor) > 0 {
+		i -= len(m.Cursor)
+		copy(dAtA[i:], m.Cursor)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.Cursor)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.ProviderResults) > 0 {
+		for iNdEx := len(m.ProviderResults) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.ProviderResults[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintFindResponse(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.Multihash) > 0 {
+		i -= len(m.Multihash)
+		copy(dAtA[i:], m.Multihash)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.Multihash)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ProviderResult) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ProviderResult) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ProviderResult) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Upstream) > 0 {
+		i -= len(m.Upstream)
+		copy(dAtA[i:], m.Upstream)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.Upstream)))
+		i--
+		dAtA[i] = 0x3a
+	}
+	if m.Score != 0 {
+		i -= 8
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.Score))))
+		i--
+		dAtA[i] = 0x31
+	}
+	if len(m.ProviderAddrs) > 0 {
+		for iNdEx := len(m.ProviderAddrs) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.ProviderAddrs[iNdEx])
+			copy(dAtA[i:], m.ProviderAddrs[iNdEx])
+			i = encodeVarintFindResponse(dAtA, i, uint64(len(m.ProviderAddrs[iNdEx])))
+			i--
+			dAtA[i] = 0x2a
+		}
+	}
+	if len(m.ProviderId) > 0 {
+		i -= len(m.ProviderId)
+		copy(dAtA[i:], m.ProviderId)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.ProviderId)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.Metadata) > 0 {
+		i -= len(m.Metadata)
+		copy(dAtA[i:], m.Metadata)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.Metadata)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if m.ProtocolId != 0 {
+		i = encodeVarintFindResponse(dAtA, i, uint64(m.ProtocolId))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.ContextId) > 0 {
+		i -= len(m.ContextId)
+		copy(dAtA[i:], m.ContextId)
+		i = encodeVarintFindResponse(dAtA, i, uint64(len(m.ContextId)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintFindResponse(dAtA []byte, offset int, v uint64) int {
+	offset -= sovFindResponse(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *FindResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.MultihashResults) > 0 {
+		for _, e := range m.MultihashResults {
+			l = e.Size()
+			n += 1 + l + sovFindResponse(uint64(l))
+		}
+	}
+	l = len(m.Signature)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	return n
+}
+
+func (m *MultihashResult) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Multihash)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	if len(m.ProviderResults) > 0 {
+		for _, e := range m.ProviderResults {
+			l = e.Size()
+			n += 1 + l + sovFindResponse(uint64(l))
+		}
+	}
+	l = len(m.Cursor)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	l = len(m.Data)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	return n
+}
+
+func (m *ProviderResult) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.ContextId)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	if m.ProtocolId != 0 {
+		n += 1 + sovFindResponse(uint64(m.ProtocolId))
+	}
+	l = len(m.Metadata)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	l = len(m.ProviderId)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	if len(m.ProviderAddrs) > 0 {
+		for _, b := range m.ProviderAddrs {
+			l = len(b)
+			n += 1 + l + sovFindResponse(uint64(l))
+		}
+	}
+	if m.Score != 0 {
+		n += 9
+	}
+	l = len(m.Upstream)
+	if l > 0 {
+		n += 1 + l + sovFindResponse(uint64(l))
+	}
+	return n
+}
+
+func sovFindResponse(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozFindResponse(x uint64) (n int) {
+	return sovFindResponse(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *FindResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowFindResponse
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: FindResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: FindResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MultihashResults", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.MultihashResults = append(m.MultihashResults, &MultihashResult{})
+			if err := m.MultihashResults[len(m.MultihashResults)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Signature", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Signature = append(m.Signature[:0], dAtA[iNdEx:postIndex]...)
+			if m.Signature == nil {
+				m.Signature = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipFindResponse(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *MultihashResult) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowFindResponse
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: MultihashResult: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: MultihashResult: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Multihash", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Multihash = append(m.Multihash[:0], dAtA[iNdEx:postIndex]...)
+			if m.Multihash == nil {
+				m.Multihash = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ProviderResults", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ProviderResults = append(m.ProviderResults, &ProviderResult{})
+			if err := m.ProviderResults[len(m.ProviderResults)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Cursor", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Cursor = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipFindResponse(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ProviderResult) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowFindResponse
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ProviderResult: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ProviderResult: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ContextId", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ContextId = append(m.ContextId[:0], dAtA[iNdEx:postIndex]...)
+			if m.ContextId == nil {
+				m.ContextId = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ProtocolId", wireType)
+			}
+			m.ProtocolId = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ProtocolId |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Metadata = append(m.Metadata[:0], dAtA[iNdEx:postIndex]...)
+			if m.Metadata == nil {
+				m.Metadata = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ProviderId", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ProviderId = append(m.ProviderId[:0], dAtA[iNdEx:postIndex]...)
+			if m.ProviderId == nil {
+				m.ProviderId = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ProviderAddrs", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ProviderAddrs = append(m.ProviderAddrs, make([]byte, postIndex-iNdEx))
+			copy(m.ProviderAddrs[len(m.ProviderAddrs)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Score", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.Score = float64(math.Float64frombits(v))
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Upstream", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Upstream = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipFindResponse(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthFindResponse
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipFindResponse(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	depth := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowFindResponse
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+		case 1:
+			iNdEx += 8
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowFindResponse
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthFindResponse
+			}
+			iNdEx += length
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupFindResponse
+			}
+			depth--
+		case 5:
+			iNdEx += 4
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthFindResponse
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+var (
+	ErrInvalidLengthFindResponse        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowFindResponse          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupFindResponse = fmt.Errorf("proto: unexpected end of group")
+)
@@ -50,11 +50,42 @@ func (FinderMessage_MessageType) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_02dfec63316bfb34, []int{0, 0}
 }
 
+type FinderMessage_Codec int32
+
+const (
+	FinderMessage_JSON     FinderMessage_Codec = 0
+	FinderMessage_CBOR     FinderMessage_Codec = 1
+	FinderMessage_PROTOBUF FinderMessage_Codec = 2
+)
+
+var FinderMessage_Codec_name = map[int32]string{
+	0: "JSON",
+	1: "CBOR",
+	2: "PROTOBUF",
+}
+
+var FinderMessage_Codec_value = map[string]int32{
+	"JSON":     0,
+	"CBOR":     1,
+	"PROTOBUF": 2,
+}
+
+func (x FinderMessage_Codec) String() string {
+	return proto.EnumName(FinderMessage_Codec_name, int32(x))
+}
+
+func (FinderMessage_Codec) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_02dfec63316bfb34, []int{0, 1}
+}
+
 type FinderMessage struct {
 	// defines what type of message it is.
 	Type FinderMessage_MessageType `protobuf:"varint,1,opt,name=type,proto3,enum=reqresp.pb.FinderMessage_MessageType" json:"type,omitempty"`
 	// Value for the message
 	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// Encoding of the find response data.  A GET request sets the encoding
+	// that the response should use.
+	Codec FinderMessage_Codec `protobuf:"varint,3,opt,name=codec,proto3,enum=reqresp.pb.FinderMessage_Codec" json:"codec,omitempty"`
 }
 
 func (m *FinderMessage) Reset()         { *m = FinderMessage{} }
@@ -104,27 +135,39 @@ func (m *FinderMessage) GetData() []byte {
 	return nil
 }
 
+func (m *FinderMessage) GetCodec() FinderMessage_Codec {
+	if m != nil {
+		return m.Codec
+	}
+	return FinderMessage_JSON
+}
+
 func init() {
 	proto.RegisterEnum("reqresp.pb.FinderMessage_MessageType", FinderMessage_MessageType_name, FinderMessage_MessageType_value)
+	proto.RegisterEnum("reqresp.pb.FinderMessage_Codec", FinderMessage_Codec_name, FinderMessage_Codec_value)
 	proto.RegisterType((*FinderMessage)(nil), "reqresp.pb.FinderMessage")
 }
 
 func init() { proto.RegisterFile("finder.proto", fileDescriptor_02dfec63316bfb34) }
 
 var fileDescriptor_02dfec63316bfb34 = []byte{
-	// 191 bytes of a gzipped FileDescriptorProto
+	// 249 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x49, 0xcb, 0xcc, 0x4b,
 	0x49, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x2a, 0x4a, 0x2d, 0x2c, 0x4a, 0x2d,
-	0x2e, 0xd0, 0x2b, 0x48, 0x52, 0x9a, 0xc3, 0xc8, 0xc5, 0xeb, 0x06, 0x96, 0xf4, 0x4d, 0x2d, 0x2e,
+	0x2e, 0xd0, 0x2b, 0x48, 0x52, 0xfa, 0xc7, 0xc8, 0xc5, 0xeb, 0x06, 0x96, 0xf4, 0x4d, 0x2d, 0x2e,
 	0x4e, 0x4c, 0x4f, 0x15, 0xb2, 0xe4, 0x62, 0x29, 0xa9, 0x2c, 0x48, 0x95, 0x60, 0x54, 0x60, 0xd4,
 	0xe0, 0x33, 0x52, 0xd5, 0x43, 0x28, 0xd6, 0x43, 0x51, 0xa8, 0x07, 0xa5, 0x43, 0x2a, 0x0b, 0x52,
 	0x83, 0xc0, 0x5a, 0x84, 0x84, 0xb8, 0x58, 0x52, 0x12, 0x4b, 0x12, 0x25, 0x98, 0x14, 0x18, 0x35,
-	0x78, 0x82, 0xc0, 0x6c, 0x25, 0x1b, 0x2e, 0x6e, 0x24, 0x85, 0x42, 0x42, 0x5c, 0x7c, 0xae, 0x41,
-	0x41, 0xfe, 0x41, 0xf1, 0x41, 0xae, 0xc1, 0x01, 0xfe, 0x7e, 0xc1, 0xae, 0x02, 0x0c, 0x42, 0xec,
-	0x5c, 0xcc, 0xee, 0xae, 0x21, 0x02, 0x8c, 0x42, 0x02, 0x5c, 0x3c, 0xee, 0xae, 0x21, 0x08, 0x29,
-	0x26, 0x27, 0x89, 0x13, 0x8f, 0xe4, 0x18, 0x2f, 0x3c, 0x92, 0x63, 0x7c, 0xf0, 0x48, 0x8e, 0x71,
-	0xc2, 0x63, 0x39, 0x86, 0x0b, 0x8f, 0xe5, 0x18, 0x6e, 0x3c, 0x96, 0x63, 0x48, 0x62, 0x03, 0xfb,
-	0xc5, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x65, 0xf2, 0x99, 0x68, 0xdb, 0x00, 0x00, 0x00,
+	0x78, 0x82, 0xc0, 0x6c, 0x21, 0x53, 0x2e, 0xd6, 0xe4, 0xfc, 0x94, 0xd4, 0x64, 0x09, 0x66, 0xb0,
+	0x79, 0xf2, 0xb8, 0xcd, 0x73, 0x06, 0x29, 0x0b, 0x82, 0xa8, 0x56, 0xb2, 0xe1, 0xe2, 0x46, 0x32,
+	0x5f, 0x48, 0x88, 0x8b, 0xcf, 0x35, 0x28, 0xc8, 0x3f, 0x28, 0x3e, 0xc8, 0x35, 0x38, 0xc0, 0xdf,
+	0x2f, 0xd8, 0x55, 0x80, 0x41, 0x88, 0x9d, 0x8b, 0xd9, 0xdd, 0x35, 0x44, 0x80, 0x51, 0x48, 0x80,
+	0x8b, 0xc7, 0xdd, 0x35, 0x04, 0x21, 0xc5, 0xa4, 0xa4, 0xc9, 0xc5, 0x0a, 0x36, 0x4d, 0x88, 0x83,
+	0x8b, 0xc5, 0x2b, 0xd8, 0xdf, 0x4f, 0x80, 0x01, 0xc4, 0x72, 0x76, 0xf2, 0x0f, 0x12, 0x60, 0x14,
+	0xe2, 0xe1, 0xe2, 0x08, 0x08, 0xf2, 0x0f, 0xf1, 0x77, 0x0a, 0x75, 0x13, 0x60, 0x72, 0x92, 0x38,
+	0xf1, 0x48, 0x8e, 0xf1, 0xc2, 0x23, 0x39, 0xc6, 0x07, 0x8f, 0xe4, 0x18, 0x27, 0x3c, 0x96, 0x63,
+	0xb8, 0xf0, 0x58, 0x8e, 0xe1, 0xc6, 0x63, 0x39, 0x86, 0x24, 0x36, 0x70, 0x68, 0x19, 0x03, 0x06,
+	0x00, 0x8a, 0xaf, 0x28, 0x82, 0x3d, 0x01, 0x00, 0x00,
 }
 
 func (m *FinderMessage) Marshal() (dAtA []byte, err error) {
@@ -147,6 +190,11 @@ func (m *FinderMessage) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Codec != 0 {
+		i = encodeVarintFinder(dAtA, i, uint64(m.Codec))
+		i--
+		dAtA[i] = 0x18
+	}
 	if len(m.Data) > 0 {
 		i -= len(m.Data)
 		copy(dAtA[i:], m.Data)
@@ -186,6 +234,9 @@ func (m *FinderMessage) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovFinder(uint64(l))
 	}
+	if m.Codec != 0 {
+		n += 1 + sovFinder(uint64(m.Codec))
+	}
 	return n
 }
 
@@ -277,6 +328,25 @@ func (m *FinderMessage) Unmarshal(dAtA []byte) error {
 				m.Data = []byte{}
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Codec", wireType)
+			}
+			m.Codec = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFinder
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Codec |= FinderMessage_Codec(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipFinder(dAtA[iNdEx:])
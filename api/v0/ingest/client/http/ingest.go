@@ -73,6 +73,38 @@ func (c *Client) ListProviders(ctx context.Context) ([]*model.ProviderInfo, erro
 	return providers, nil
 }
 
+// QueryProviders lists the providers selected by the request, in the requested
+// order.  If the request has a limit, the response has a cursor to get the
+// next page.
+func (c *Client) QueryProviders(ctx context.Context, query model.ListProvidersRequest) (*model.ListProvidersResponse, error) {
+	u := c.providersURL
+	if q := query.Query(); len(q) != 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpclient.ReadError(resp.StatusCode, body)
+	}
+
+	return model.UnmarshalListProvidersResponse(body)
+}
+
 func (c *Client) GetProvider(ctx context.Context, providerID peer.ID) (*model.ProviderInfo, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.providersURL+"/"+providerID.String(), nil)
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 type Ingest interface {
 	GetProvider(ctx context.Context, providerID peer.ID) (*model.ProviderInfo, error)
 	ListProviders(ctx context.Context) ([]*model.ProviderInfo, error)
+	QueryProviders(ctx context.Context, req model.ListProvidersRequest) (*model.ListProvidersResponse, error)
 	Register(ctx context.Context, providerID peer.ID, privateKey crypto.PrivKey, addrs []string) error
 	IndexContent(ctx context.Context, providerID peer.ID, privateKey crypto.PrivKey, m multihash.Multihash, contextID []byte, metadata v0.Metadata, addrs []string) error
 }
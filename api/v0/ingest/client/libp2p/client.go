@@ -60,6 +60,26 @@ func (c *Client) ListProviders(ctx context.Context) ([]*model.ProviderInfo, erro
 	return providers, nil
 }
 
+// QueryProviders lists the providers selected by the request, in the requested
+// order.  If the request has a limit, the response has a cursor to get the
+// next page.
+func (c *Client) QueryProviders(ctx context.Context, query model.ListProvidersRequest) (*model.ListProvidersResponse, error) {
+	data, err := json.Marshal(&query)
+	if err != nil {
+		return nil, err
+	}
+	req := &pb.IngestMessage{
+		Type: pb.IngestMessage_LIST_PROVIDERS,
+		Data: data,
+	}
+
+	data, err = c.sendRecv(ctx, req, pb.IngestMessage_LIST_PROVIDERS_RESPONSE)
+	if err != nil {
+		return nil, err
+	}
+	return model.UnmarshalListProvidersResponse(data)
+}
+
 func (c *Client) GetProvider(ctx context.Context, providerID peer.ID) (*model.ProviderInfo, error) {
 	data, err := json.Marshal(providerID)
 	if err != nil {
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort orders for listing providers.  A "-" before the sort order reverses
+// it.
+const (
+	SortByID         = "id"
+	SortByLastAd     = "lastAd"
+	SortByFirstSeen  = "firstSeen"
+	SortByAdCount    = "adCount"
+	SortByIndexCount = "indexCount"
+)
+
+// ListProvidersRequest selects which providers to list, in what order, and a
+// page of the results.  The zero value lists all providers.
+type ListProvidersRequest struct {
+	// AdBefore, if not zero, selects providers whose last advertisement was
+	// received before this time.
+	AdBefore time.Time `json:",omitempty"`
+	// AdAfter, if not zero, selects providers whose last advertisement was
+	// received after this time.
+	AdAfter time.Time `json:",omitempty"`
+	// Type, if not empty, selects providers of this type: "miner", "domain",
+	// or "other".
+	Type string `json:",omitempty"`
+	// HasDiscoveryAddr, if not nil, selects providers that have, or do not
+	// have, a discovery address.
+	HasDiscoveryAddr *bool `json:",omitempty"`
+	// Labels selects providers that have all of these labels.  An empty value
+	// matches any value of the label.
+	Labels map[string]string `json:",omitempty"`
+	// Sort is the order of the providers.  The default is SortByID.
+	Sort string `json:",omitempty"`
+	// Limit, if not zero, is the maximum number of providers to return.  When
+	// there are more, the response has a cursor for the next page.
+	Limit int `json:",omitempty"`
+	// Cursor continues from the previous page of results.  The other
+	// parameters must be the same as for the previous page.
+	Cursor string `json:",omitempty"`
+}
+
+// ListProvidersResponse is a page of providers.
+type ListProvidersResponse struct {
+	Providers []*ProviderInfo
+	// Cursor, if not empty, is given in the next request to get the next page
+	// of providers.
+	Cursor string `json:",omitempty"`
+}
+
+// Paged returns true if the request asks for a page of providers, which is
+// returned as a ListProvidersResponse.  Otherwise, the response is only the
+// list of providers.
+func (r *ListProvidersRequest) Paged() bool {
+	return r.Limit != 0 || r.Cursor != ""
+}
+
+// Query encodes the request as URL query parameters.
+func (r *ListProvidersRequest) Query() url.Values {
+	q := url.Values{}
+	if !r.AdBefore.IsZero() {
+		q.Set("ad_before", r.AdBefore.Format(time.RFC3339Nano))
+	}
+	if !r.AdAfter.IsZero() {
+		q.Set("ad_after", r.AdAfter.Format(time.RFC3339Nano))
+	}
+	if r.Type != "" {
+		q.Set("type", r.Type)
+	}
+	if r.HasDiscoveryAddr != nil {
+		q.Set("has_discovery_addr", strconv.FormatBool(*r.HasDiscoveryAddr))
+	}
+	for k, v := range r.Labels {
+		if v == "" {
+			q.Add("label", k)
+		} else {
+			q.Add("label", k+"="+v)
+		}
+	}
+	if r.Sort != "" {
+		q.Set("sort", r.Sort)
+	}
+	if r.Limit != 0 {
+		q.Set("limit", strconv.Itoa(r.Limit))
+	}
+	if r.Cursor != "" {
+		q.Set("cursor", r.Cursor)
+	}
+	return q
+}
+
+// ParseListProvidersQuery decodes a ListProvidersRequest from URL query
+// parameters.
+func ParseListProvidersQuery(q url.Values) (*ListProvidersRequest, error) {
+	var req ListProvidersRequest
+	var err error
+	if s := q.Get("ad_before"); s != "" {
+		if req.AdBefore, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return nil, fmt.Errorf("bad ad_before parameter: %s", err)
+		}
+	}
+	if s := q.Get("ad_after"); s != "" {
+		if req.AdAfter, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return nil, fmt.Errorf("bad ad_after parameter: %s", err)
+		}
+	}
+	req.Type = q.Get("type")
+	if s := q.Get("has_discovery_addr"); s != "" {
+		has, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad has_discovery_addr parameter: %s", err)
+		}
+		req.HasDiscoveryAddr = &has
+	}
+	for _, label := range q["label"] {
+		k, v := label, ""
+		if i := strings.IndexByte(label, '='); i != -1 {
+			k, v = label[:i], label[i+1:]
+		}
+		if k == "" {
+			return nil, errors.New("bad label parameter: empty label name")
+		}
+		if req.Labels == nil {
+			req.Labels = map[string]string{}
+		}
+		req.Labels[k] = v
+	}
+	req.Sort = q.Get("sort")
+	if s := q.Get("limit"); s != "" {
+		if req.Limit, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("bad limit parameter: %s", err)
+		}
+	}
+	req.Cursor = q.Get("cursor")
+	return &req, nil
+}
+
+// UnmarshalListProvidersResponse decodes the response to a list providers
+// request, which is either a ListProvidersResponse or, for a request that is
+// not paged, the list of providers.
+func UnmarshalListProvidersResponse(data []byte) (*ListProvidersResponse, error) {
+	var rsp ListProvidersResponse
+	if data = bytes.TrimSpace(data); len(data) != 0 && data[0] == '[' {
+		err := json.Unmarshal(data, &rsp.Providers)
+		if err != nil {
+			return nil, err
+		}
+		return &rsp, nil
+	}
+	if err := json.Unmarshal(data, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
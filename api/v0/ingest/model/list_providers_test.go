@@ -0,0 +1,69 @@
+package model
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListProvidersQuery(t *testing.T) {
+	hasDisco := false
+	req := ListProvidersRequest{
+		AdBefore:         time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC),
+		AdAfter:          time.Date(2021, 10, 1, 12, 0, 0, 500, time.UTC),
+		Type:             "miner",
+		HasDiscoveryAddr: &hasDisco,
+		Labels:           map[string]string{"region": "eu", "tier": ""},
+		Sort:             "-" + SortByIndexCount,
+		Limit:            50,
+		Cursor:           "abc",
+	}
+
+	decoded, err := ParseListProvidersQuery(req.Query())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&req, decoded) {
+		t.Fatalf("decoded request does not match original: %+v", decoded)
+	}
+	if !decoded.Paged() {
+		t.Fatal("expected paged request")
+	}
+
+	empty, err := ParseListProvidersQuery(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Paged() || len(empty.Query()) != 0 {
+		t.Fatal("expected empty request")
+	}
+
+	for _, bad := range []string{"limit=x", "ad_before=yesterday", "has_discovery_addr=maybe", "label==eu"} {
+		q, err := url.ParseQuery(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ParseListProvidersQuery(q); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestUnmarshalListProvidersResponse(t *testing.T) {
+	rsp, err := UnmarshalListProvidersResponse([]byte(`[{"AddrInfo":{"ID":"12D3KooWBckWLKiYoUX4k3HTrbrSe4DD5SPNTKgP6vKTva1NaRkJ","Addrs":[]}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Providers) != 1 || rsp.Cursor != "" {
+		t.Fatal("wrong response from provider list")
+	}
+
+	rsp, err = UnmarshalListProvidersResponse([]byte(`{"Providers":[],"Cursor":"next"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Providers) != 0 || rsp.Cursor != "next" {
+		t.Fatal("wrong response from page of providers")
+	}
+}
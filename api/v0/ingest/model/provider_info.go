@@ -5,6 +5,7 @@ import (
 
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multicodec"
 )
 
 // ProviderData describes a provider.
@@ -12,6 +13,43 @@ type ProviderInfo struct {
 	AddrInfo              peer.AddrInfo
 	LastAdvertisement     cid.Cid `json:",omitempty"`
 	LastAdvertisementTime string  `json:",omitempty"`
+	// DiscoveryAddr is the address used to discover the provider, if it was
+	// discovered.
+	DiscoveryAddr string `json:",omitempty"`
+	// Type is how the provider was verified: "miner", "domain", or "other".
+	Type string `json:",omitempty"`
+	// Unverified is true if the provider no longer matches its DiscoveryAddr.
+	Unverified bool `json:",omitempty"`
+	// FirstSeen is when the indexer first registered the provider.
+	FirstSeen string `json:",omitempty"`
+	// AdCount is the number of the provider's advertisements ingested.
+	AdCount uint64 `json:",omitempty"`
+	// IndexCount is the number of multihashes indexed for the provider by
+	// ingesting its advertisements on this indexer, which is the sum of the
+	// multihash counts of the provider's contexts.  Mirrored content is not
+	// counted.
+	IndexCount uint64 `json:",omitempty"`
+	// LastSyncError is the error from the last sync with the provider.
+	LastSyncError string `json:",omitempty"`
+	// Protocols lists the retrieval protocols in the provider's metadata.
+	Protocols []multicodec.Code `json:",omitempty"`
+	// Labels are assigned to the provider by the indexer's operator.
+	Labels map[string]string `json:",omitempty"`
+	// AddrStatus is the result of the latest probe of each probed address.
+	AddrStatus []AddrStatus `json:",omitempty"`
+}
+
+// AddrStatus is the result of the latest probe of a provider address.
+type AddrStatus struct {
+	Addr      string
+	Reachable bool
+	// RTTMillis is how long it took to connect to the address, in
+	// milliseconds.
+	RTTMillis int64 `json:",omitempty"`
+	// Probed is when the address was probed.
+	Probed string
+	// Error is the reason that the address is not reachable.
+	Error string `json:",omitempty"`
 }
 
 func MakeProviderInfo(addrInfo peer.AddrInfo, lastAd cid.Cid, lastAdTime time.Time) ProviderInfo {
@@ -7,4 +7,10 @@ const (
 	FinderProtocolID protocol.ID = "/indexer/finder/0.0.1"
 	// FinderProtocolID is the libp2p protocol that ingest API uses
 	IngestProtocolID protocol.ID = "/indexer/indest/0.0.1"
+	// MirrorProtocolID is the libp2p protocol that indexers use to mirror
+	// the ingestion feed of another indexer
+	MirrorProtocolID protocol.ID = "/indexer/mirror/0.0.1"
+	// ClusterProtocolID is the libp2p protocol that nodes of a sharded
+	// indexer cluster use to forward content to the node that stores it
+	ClusterProtocolID protocol.ID = "/indexer/cluster/0.0.1"
 )
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/filecoin-project/go-indexer-core"
@@ -14,10 +15,23 @@ import (
 	"github.com/filecoin-project/go-indexer-core/store/memory"
 	"github.com/filecoin-project/go-indexer-core/store/pogreb"
 	"github.com/filecoin-project/go-indexer-core/store/storethehash"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/client"
+	finderhttpclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/http"
+	finderp2pclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/libp2p"
 	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/addrprober"
+	"github.com/filecoin-project/storetheindex/internal/cluster"
+	"github.com/filecoin-project/storetheindex/internal/dhtbridge"
+	"github.com/filecoin-project/storetheindex/internal/dnsdiscovery"
+	"github.com/filecoin-project/storetheindex/internal/handler"
 	legingest "github.com/filecoin-project/storetheindex/internal/ingest"
 	"github.com/filecoin-project/storetheindex/internal/lotus"
+	"github.com/filecoin-project/storetheindex/internal/mirror"
+	"github.com/filecoin-project/storetheindex/internal/peerdiscovery"
+	"github.com/filecoin-project/storetheindex/internal/prefilter"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
 	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
 	httpadminserver "github.com/filecoin-project/storetheindex/server/admin/http"
 	httpfinderserver "github.com/filecoin-project/storetheindex/server/finder/http"
 	p2pfinderserver "github.com/filecoin-project/storetheindex/server/finder/libp2p"
@@ -27,7 +41,11 @@ import (
 	"github.com/ipfs/go-ipfs/core/bootstrap"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/urfave/cli/v2"
@@ -102,9 +120,6 @@ func daemonCommand(cctx *cli.Context) error {
 		log.Info("Result cache disabled")
 	}
 
-	// Create indexer core
-	indexerCore := engine.New(resultCache, valueStore)
-
 	// Create datastore
 	dataStorePath, err := config.Path("", cfg.Datastore.Dir)
 	if err != nil {
@@ -119,22 +134,121 @@ func daemonCommand(cctx *cli.Context) error {
 		return err
 	}
 
-	var lotusDiscoverer *lotus.Discoverer
-	if cfg.Discovery.LotusGateway != "" {
-		log.Infow("discovery using lotus", "gateway", cfg.Discovery.LotusGateway)
-		// Create lotus client
-		lotusDiscoverer, err = lotus.NewDiscoverer(cfg.Discovery.LotusGateway)
+	// Create indexer core, wrapped by an index of content for each provider
+	var coreEngine indexer.Interface = engine.New(resultCache, valueStore)
+	finderCfg := cfg.Finder.WithDefaults()
+	if finderCfg.Prefilter.Enable {
+		coreEngine, err = prefilter.New(coreEngine, finderCfg.Prefilter)
+		if err != nil {
+			return fmt.Errorf("cannot create find prefilter: %s", err)
+		}
+		log.Infow("Find prefilter enabled", "expected_multihashes", finderCfg.Prefilter.ExpectedMultihashes)
+	}
+	indexerCore := providerindex.New(coreEngine, dstore)
+
+	// Create libp2p host
+	var (
+		p2pHost          host.Host
+		p2pCtx           context.Context
+		cancelP2pServers context.CancelFunc
+		peerID           peer.ID
+		p2pmaddr         multiaddr.Multiaddr
+	)
+	if !cfg.Addresses.DisableP2P && !cctx.Bool("nop2p") {
+		p2pCtx, cancelP2pServers = context.WithCancel(cctx.Context)
+		defer cancelP2pServers()
+
+		var privKey crypto.PrivKey
+		peerID, privKey, err = cfg.Identity.Decode()
+		if err != nil {
+			return err
+		}
+		p2pmaddr, err = multiaddr.NewMultiaddr(cfg.Addresses.P2PAddr)
+		if err != nil {
+			return fmt.Errorf("bad p2p address in config %s: %s", cfg.Addresses.P2PAddr, err)
+		}
+		p2pHost, err = libp2p.New(p2pCtx,
+			// Use the keypair generated during init
+			libp2p.Identity(privKey),
+			// Listen at specific address
+			libp2p.ListenAddrs(p2pmaddr),
+		)
 		if err != nil {
-			return fmt.Errorf("cannot create lotus client: %s", err)
+			return err
 		}
 	}
 
+	discoverer, err := createDiscoverer(cfg.Discovery, p2pHost)
+	if err != nil {
+		return err
+	}
+
 	// Create registry
-	registry, err := registry.NewRegistry(cfg.Discovery, dstore, lotusDiscoverer)
+	registry, err := registry.NewRegistry(cfg.Discovery, dstore, discoverer)
 	if err != nil {
 		return fmt.Errorf("cannot create provider registry: %s", err)
 	}
 
+	// Changes made by ingestion go through ingestIndexer, so that they are
+	// recorded in the mirror feed if this indexer serves one.
+	var ingestIndexer indexer.Interface = indexerCore
+	var mirrorFeed *mirror.Feed
+	mirrorCfg := cfg.Mirror.WithDefaults()
+	if (mirrorCfg.Serve || mirrorCfg.Primary != "") && (cfg.Addresses.DisableP2P || cctx.Bool("nop2p")) {
+		return errors.New("mirroring requires libp2p")
+	}
+	if mirrorCfg.Serve {
+		if len(mirrorCfg.AllowMirrors) == 0 {
+			return errors.New("serving the mirror feed requires at least one allowed mirror")
+		}
+		mirrorFeed, err = mirror.NewFeed(dstore, indexerCore, registry, mirrorCfg.MaxFeedEvents)
+		if err != nil {
+			return fmt.Errorf("cannot create mirror feed: %s", err)
+		}
+		defer mirrorFeed.Close()
+		ingestIndexer = mirrorFeed.Indexer()
+	}
+
+	// Join the sharded cluster, if this indexer is one of its nodes.  Content
+	// ingested by this indexer is then stored on the nodes that own it.
+	var clust *cluster.Cluster
+	if len(cfg.Cluster.Nodes) != 0 {
+		if p2pHost == nil {
+			return errors.New("cluster mode requires libp2p")
+		}
+		clusterCfg := cfg.Cluster.WithDefaults()
+		nodes, err := clusterCfg.NodeAddrs()
+		if err != nil {
+			return err
+		}
+		clust, err = cluster.New(p2pHost, nodes, ingestIndexer, registry, time.Duration(clusterCfg.Timeout))
+		if err != nil {
+			return fmt.Errorf("cannot join indexer cluster: %s", err)
+		}
+		defer clust.Close()
+		ingestIndexer = clust.Indexer()
+	}
+
+	// Remove the content of providers that the registry removes.
+	registry.OnRemove(func(providerID peer.ID) {
+		if err := ingestIndexer.RemoveProvider(providerID); err != nil {
+			log.Errorw("Cannot remove content of removed provider", "provider", providerID, "err", err)
+		}
+	})
+
+	// Check that provider addresses work, so that the finder can leave out
+	// or deprioritize those that do not.
+	if cfg.AddrProbe.Enable {
+		if p2pHost == nil {
+			return errors.New("address probing requires libp2p")
+		}
+		prober, err := addrprober.New(p2pHost, registry, cfg.AddrProbe)
+		if err != nil {
+			return fmt.Errorf("cannot start address prober: %s", err)
+		}
+		defer prober.Close()
+	}
+
 	// Create finder HTTP server
 	maddr, err := multiaddr.NewMultiaddr(cfg.Addresses.Finder)
 	if err != nil {
@@ -144,7 +258,34 @@ func daemonCommand(cctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	finderSvr, err := httpfinderserver.New(finderAddr.String(), indexerCore, registry)
+	// Get key to sign find responses with, if responses are signed.
+	var signKey crypto.PrivKey
+	if cfg.Finder.SignResponses {
+		_, signKey, err = cfg.Identity.Decode()
+		if err != nil {
+			return fmt.Errorf("cannot get key to sign find responses: %s", err)
+		}
+	}
+
+	// Create clients for upstream indexers that misses are forwarded to.
+	upstreams, upstreamHost, err := createUpstreams(cctx.Context, cfg.Finder.Cascade.Upstreams)
+	if err != nil {
+		return fmt.Errorf("cannot create upstream indexer clients: %s", err)
+	}
+	if upstreamHost != nil {
+		defer upstreamHost.Close()
+	}
+	httpFinderOpts := []httpfinderserver.ServerOption{
+		httpfinderserver.ProviderIndex(indexerCore),
+		httpfinderserver.FinderConfig(cfg.Finder),
+		httpfinderserver.SigningKey(signKey),
+		httpfinderserver.Cluster(clust),
+	}
+	for _, u := range upstreams {
+		httpFinderOpts = append(httpFinderOpts, httpfinderserver.Upstream(u.name, u.finder))
+	}
+
+	finderSvr, err := httpfinderserver.New(finderAddr.String(), indexerCore, registry, httpFinderOpts...)
 	if err != nil {
 		return err
 	}
@@ -158,64 +299,93 @@ func daemonCommand(cctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	ingestSvr, err := httpingestserver.New(ingestAddr.String(), indexerCore, registry)
+	ingestSvr, err := httpingestserver.New(ingestAddr.String(), ingestIndexer, registry)
 	if err != nil {
 		return err
 	}
 
 	var (
-		cancelP2pServers context.CancelFunc
-		ingester         legingest.LegIngester
-		ingestCancel     context.CancelFunc
+		ingester     legingest.LegIngester
+		ingestCancel context.CancelFunc
 	)
-	// Create libp2p host and servers
-	if !cfg.Addresses.DisableP2P && !cctx.Bool("nop2p") {
-		ctx, cancel := context.WithCancel(cctx.Context)
-		defer cancel()
-		cancelP2pServers = cancel
-
-		peerID, privKey, err := cfg.Identity.Decode()
-		if err != nil {
-			return err
+	// Create libp2p servers
+	if p2pHost != nil {
+		ctx := p2pCtx
+
+		p2pFinderOpts := []p2pfinderserver.ServerOption{
+			p2pfinderserver.FinderConfig(cfg.Finder),
+			p2pfinderserver.SigningKey(signKey),
+			p2pfinderserver.Cluster(clust),
 		}
-		p2pmaddr, err := multiaddr.NewMultiaddr(cfg.Addresses.P2PAddr)
-		if err != nil {
-			return fmt.Errorf("bad p2p address in config %s: %s", cfg.Addresses.P2PAddr, err)
+		for _, u := range upstreams {
+			p2pFinderOpts = append(p2pFinderOpts, p2pfinderserver.Upstream(u.name, u.finder))
 		}
-		p2pHost, err := libp2p.New(ctx,
-			// Use the keypair generated during init
-			libp2p.Identity(privKey),
-			// Listen at specific address
-			libp2p.ListenAddrs(p2pmaddr),
-		)
+		_, err = p2pfinderserver.New(ctx, p2pHost, indexerCore, registry, p2pFinderOpts...)
 		if err != nil {
 			return err
 		}
+		p2pingestserver.New(ctx, p2pHost, ingestIndexer, registry)
 
-		p2pfinderserver.New(ctx, p2pHost, indexerCore, registry)
-		p2pingestserver.New(ctx, p2pHost, indexerCore, registry)
+		// Start the DHT bridge to answer provider lookups from the DHT.
+		if cfg.DHTBridge.Enable {
+			dhtPeers, err := cfg.DHTBridge.PeerAddrs()
+			if err != nil {
+				return fmt.Errorf("bad dht bridge bootstrap peer: %s", err)
+			}
+			if len(dhtPeers) == 0 {
+				dhtPeers = dht.GetDefaultBootstrapPeerAddrInfos()
+			}
+			// The bridge finds content as the finder does, without
+			// querying upstream indexers, so that lookups are answered
+			// quickly.
+			bridgeFinder := handler.NewFinderHandler(indexerCore, registry, nil, cfg.Finder, nil, nil, clust)
+			bridge, err := dhtbridge.New(ctx, p2pHost, bridgeFinder, cfg.DHTBridge.ProtocolPrefix, dhtPeers)
+			if err != nil {
+				return fmt.Errorf("cannot start dht bridge: %s", err)
+			}
+			defer bridge.Close()
+		}
 
-		// Initialize ingester.
-		var ingestCtx context.Context
-		ingestCtx, ingestCancel = context.WithCancel(context.Background())
-		defer ingestCancel()
-		ingester, err = legingest.NewLegIngester(ingestCtx, cfg.Ingest, p2pHost, indexerCore, registry, dstore)
-		if err != nil {
-			return err
+		if mirrorFeed != nil {
+			mirrorIDs, err := mirrorCfg.MirrorIDs()
+			if err != nil {
+				return err
+			}
+			mirrorFeed.Serve(p2pHost, mirrorIDs)
 		}
 
-		// Allow listed peers to be pubsub message originators.
-		//
-		// TODO: This is temporary until go-legs can automatically allow peers
-		// based on the indexer's allow/deny policy.
-		for _, pubSubPeer := range cfg.Ingest.PubSubPeers {
-			peerID, err := peer.Decode(pubSubPeer)
+		if mirrorCfg.Primary != "" {
+			// A mirror gets all changes from its primary, and does not ingest
+			// from providers.
+			primary, err := mirrorPrimary(mirrorCfg.Primary)
 			if err != nil {
-				return fmt.Errorf("bad PubSubPeer in config: %s", err)
+				return err
 			}
-			err = ingester.Subscribe(context.Background(), peerID)
+			follower := mirror.NewFollower(p2pHost, primary, ingestIndexer, registry, dstore, time.Duration(mirrorCfg.RetryInterval))
+			defer follower.Close()
+		} else {
+			// Initialize ingester.
+			var ingestCtx context.Context
+			ingestCtx, ingestCancel = context.WithCancel(context.Background())
+			defer ingestCancel()
+			ingester, err = legingest.NewLegIngester(ingestCtx, cfg.Ingest, p2pHost, ingestIndexer, registry, dstore)
 			if err != nil {
-				log.Errorf("Cannot subscribe to provider", "err", err)
+				return err
+			}
+
+			// Allow listed peers to be pubsub message originators.
+			//
+			// TODO: This is temporary until go-legs can automatically allow peers
+			// based on the indexer's allow/deny policy.
+			for _, pubSubPeer := range cfg.Ingest.PubSubPeers {
+				peerID, err := peer.Decode(pubSubPeer)
+				if err != nil {
+					return fmt.Errorf("bad PubSubPeer in config: %s", err)
+				}
+				err = ingester.Subscribe(context.Background(), peerID)
+				if err != nil {
+					log.Errorf("Cannot subscribe to provider", "err", err)
+				}
 			}
 		}
 
@@ -251,7 +421,7 @@ func daemonCommand(cctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	adminSvr, err := httpadminserver.New(cctx.Context, adminAddr.String(), indexerCore, ingester)
+	adminSvr, err := httpadminserver.New(cctx.Context, adminAddr.String(), ingestIndexer, ingester, registry)
 	if err != nil {
 		return err
 	}
@@ -321,7 +491,8 @@ func daemonCommand(cctx *cli.Context) error {
 		}
 	}
 
-	if err = valueStore.Close(); err != nil {
+	// Closing the indexer core closes the value store.
+	if err = indexerCore.Close(); err != nil {
 		log.Errorw("Error closing value store", "err", err)
 		finalErr = ErrDaemonStop
 	}
@@ -332,6 +503,120 @@ func daemonCommand(cctx *cli.Context) error {
 	return finalErr
 }
 
+// mirrorPrimary gets the peer ID and address of the primary indexer from its
+// multiaddr.
+func mirrorPrimary(addr string) (peer.AddrInfo, error) {
+	maddr, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("bad mirror primary %q: %s", addr, err)
+	}
+	info, err := peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("bad mirror primary %q: %s", addr, err)
+	}
+	return *info, nil
+}
+
+// upstreamFinder is a client for an upstream indexer.
+type upstreamFinder struct {
+	name   string
+	finder client.Finder
+}
+
+// createUpstreams creates a finder client for each upstream indexer.  An
+// upstream is either an HTTP URL or a libp2p multiaddr that includes the peer
+// ID.  All libp2p clients share a host that does not listen for connections.
+// The host is returned so that it can be closed when the clients are no longer
+// used, and is nil if there are no libp2p upstreams.
+func createUpstreams(ctx context.Context, addrs []string) ([]upstreamFinder, host.Host, error) {
+	var clientHost host.Host
+	var done bool
+	defer func() {
+		if !done && clientHost != nil {
+			clientHost.Close()
+		}
+	}()
+
+	upstreams := make([]upstreamFinder, 0, len(addrs))
+	for _, addr := range addrs {
+		if !strings.HasPrefix(addr, "/") {
+			c, err := finderhttpclient.New(addr)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad upstream url %q: %s", addr, err)
+			}
+			upstreams = append(upstreams, upstreamFinder{addr, c})
+			continue
+		}
+
+		maddr, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad upstream multiaddr %q: %s", addr, err)
+		}
+		addrInfo, err := peer.AddrInfoFromP2pAddr(maddr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad upstream multiaddr %q: %s", addr, err)
+		}
+		if clientHost == nil {
+			clientHost, err = libp2p.New(ctx, libp2p.NoListenAddrs)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		clientHost.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, peerstore.PermanentAddrTTL)
+		c, err := finderp2pclient.New(clientHost, addrInfo.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		upstreams = append(upstreams, upstreamFinder{addr, c})
+	}
+	done = true
+	return upstreams, clientHost, nil
+}
+
+// createDiscoverer creates a Discoverer that routes each discovery address to
+// the configured discovery method for its scheme.  Returns nil if there are no
+// discovery methods.
+func createDiscoverer(cfg config.Discovery, p2pHost host.Host) (discovery.Discoverer, error) {
+	methods := cfg.Methods
+	if len(methods) == 0 && cfg.LotusGateway != "" {
+		methods = []string{discovery.SchemeFil}
+	}
+	router := discovery.NewRouter()
+	for _, method := range methods {
+		switch method {
+		case discovery.SchemeFil:
+			if cfg.LotusGateway == "" {
+				return nil, errors.New("fil discovery requires a lotus gateway")
+			}
+			log.Infow("discovery using lotus", "gateway", cfg.LotusGateway, "failover", len(cfg.LotusFailover))
+			gateways := []lotus.Gateway{{URL: cfg.LotusGateway, Token: cfg.LotusToken}}
+			for _, gw := range cfg.LotusFailover {
+				gateways = append(gateways, lotus.Gateway{URL: gw.URL, Token: gw.Token})
+			}
+			lotusDiscoverer, err := lotus.NewDiscoverer(gateways...)
+			if err != nil {
+				return nil, fmt.Errorf("cannot create lotus client: %s", err)
+			}
+			router.Add(method, lotusDiscoverer)
+		case discovery.SchemePeer:
+			if p2pHost == nil {
+				return nil, errors.New("peer discovery requires libp2p")
+			}
+			log.Info("discovery using libp2p peer connections")
+			router.Add(method, peerdiscovery.NewDiscoverer(p2pHost))
+		case discovery.SchemeDNS:
+			log.Info("discovery using signed provider records at provider domains")
+			router.Add(method, dnsdiscovery.NewDiscoverer())
+		default:
+			return nil, fmt.Errorf("unknown discovery method %q", method)
+		}
+	}
+	if router.Len() == 0 {
+		return nil, nil
+	}
+	return router, nil
+}
+
 func createValueStore(dir, storeType string) (indexer.Interface, error) {
 	err := checkWritable(dir)
 	if err != nil {
@@ -1,16 +1,18 @@
 package command
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 	"github.com/urfave/cli/v2"
 
 	"github.com/filecoin-project/storetheindex/api/v0/finder/client"
 	httpclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/http"
 	p2pclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/libp2p"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
 )
 
 var FindCmd = &cli.Command{
@@ -20,12 +22,18 @@ var FindCmd = &cli.Command{
 	Action: findCmd,
 }
 
+// finder is a finder client that can filter results.
+type finder interface {
+	client.Finder
+	FindBatchFilter(context.Context, []multihash.Multihash, model.FindFilter) (*model.FindResponse, error)
+}
+
 func findCmd(cctx *cli.Context) error {
 	protocol := cctx.String("protocol")
 
 	mhArgs := cctx.StringSlice("mh")
 	cidArgs := cctx.StringSlice("cid")
-	mhs := make([]multihash.Multihash, 0, len(mhArgs)+len(cidArgs))
+	mhs := make([]multihash.Multihash, 0, len(mhArgs))
 	for i := range mhArgs {
 		m, err := multihash.FromB58String(mhArgs[i])
 		if err != nil {
@@ -33,15 +41,19 @@ func findCmd(cctx *cli.Context) error {
 		}
 		mhs = append(mhs, m)
 	}
+	// CIDs are found in a separate request for each codec, so that only
+	// providers that serve the CID's codec are returned.
+	cidsByCodec := map[multicodec.Code][]multihash.Multihash{}
 	for i := range cidArgs {
-		c, err := cid.Decode(cidArgs[i])
+		c, err := model.DecodeCid(cidArgs[i])
 		if err != nil {
 			return err
 		}
-		mhs = append(mhs, c.Hash())
+		codec := model.CidCodec(c)
+		cidsByCodec[codec] = append(cidsByCodec[codec], c.Hash())
 	}
 
-	var cl client.Finder
+	var cl finder
 	var err error
 
 	switch protocol {
@@ -70,9 +82,19 @@ func findCmd(cctx *cli.Context) error {
 		return fmt.Errorf("unrecognized protocol type for client interaction: %s", protocol)
 	}
 
-	resp, err := cl.FindBatch(cctx.Context, mhs)
-	if err != nil {
-		return err
+	resp := &model.FindResponse{}
+	if len(mhs) != 0 {
+		resp, err = cl.FindBatch(cctx.Context, mhs)
+		if err != nil {
+			return err
+		}
+	}
+	for codec, cidMhs := range cidsByCodec {
+		cidResp, err := cl.FindBatchFilter(cctx.Context, cidMhs, model.FindFilter{Codecs: []multicodec.Code{codec}})
+		if err != nil {
+			return err
+		}
+		resp.MultihashResults = append(resp.MultihashResults, cidResp.MultihashResults...)
 	}
 
 	if len(resp.MultihashResults) == 0 {
@@ -83,6 +105,9 @@ func findCmd(cctx *cli.Context) error {
 	fmt.Println("Content providers:")
 	for i := range resp.MultihashResults {
 		fmt.Println("   Multihash:", resp.MultihashResults[i].Multihash.B58String(), "==>")
+		if data := resp.MultihashResults[i].Data; len(data) != 0 {
+			fmt.Println("       Inline data:", string(data))
+		}
 		for _, pr := range resp.MultihashResults[i].ProviderResults {
 			fmt.Println("       Provider:", pr.Provider)
 			fmt.Println("       ContextID:", string(pr.ContextID))
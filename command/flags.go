@@ -104,6 +104,10 @@ var ingestFlags = []cli.Flag{
 	indexerHostFlag,
 }
 
+var valueStoreFlags = []cli.Flag{
+	indexerHostFlag,
+}
+
 var initFlags = []cli.Flag{
 	cacheSizeFlag,
 	&cli.StringFlag{
@@ -0,0 +1,127 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	httpclient "github.com/filecoin-project/storetheindex/api/v0/admin/client/http"
+	"github.com/filecoin-project/storetheindex/api/v0/admin/model"
+	"github.com/urfave/cli/v2"
+)
+
+// checkPollInterval is how often the status of a value store check is read
+// while waiting for it to finish.
+const checkPollInterval = 2 * time.Second
+
+var check = &cli.Command{
+	Name:   "check",
+	Usage:  "Check value store for corrupt records and values that should be removed",
+	Flags:  valueStoreFlags,
+	Action: checkCmd,
+}
+
+var compact = &cli.Command{
+	Name:   "compact",
+	Usage:  "Remove bad values and values from unknown providers from value store",
+	Flags:  valueStoreFlags,
+	Action: compactCmd,
+}
+
+var checkStatus = &cli.Command{
+	Name:   "status",
+	Usage:  "Show the status of the running or latest value store check",
+	Flags:  valueStoreFlags,
+	Action: checkStatusCmd,
+}
+
+var ValueStoreCmd = &cli.Command{
+	Name:  "valuestore",
+	Usage: "Admin commands to check and compact indexer value store",
+	Subcommands: []*cli.Command{
+		check,
+		compact,
+		checkStatus,
+	},
+}
+
+func checkCmd(cctx *cli.Context) error {
+	cl, err := httpclient.New(cctx.String("indexer"))
+	if err != nil {
+		return err
+	}
+	if _, err = cl.CheckValueStore(cctx.Context); err != nil {
+		return err
+	}
+	fmt.Println("Value store check started")
+	return waitCheck(cctx, cl)
+}
+
+func compactCmd(cctx *cli.Context) error {
+	cl, err := httpclient.New(cctx.String("indexer"))
+	if err != nil {
+		return err
+	}
+	if _, err = cl.CompactValueStore(cctx.Context); err != nil {
+		return err
+	}
+	fmt.Println("Value store compaction started")
+	return waitCheck(cctx, cl)
+}
+
+func checkStatusCmd(cctx *cli.Context) error {
+	cl, err := httpclient.New(cctx.String("indexer"))
+	if err != nil {
+		return err
+	}
+	status, err := cl.ValueStoreStatus(cctx.Context)
+	if err != nil {
+		return err
+	}
+	return printCheckStatus(status)
+}
+
+// waitCheck polls the check status until the check is finished.  Interrupting
+// the command stops waiting, but does not stop the check.
+func waitCheck(cctx *cli.Context, cl *httpclient.Client) error {
+	ticker := time.NewTicker(checkPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-cctx.Done():
+			fmt.Println("Check continues in the background; see \"valuestore status\"")
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(cctx.Context, time.Minute)
+		status, err := cl.ValueStoreStatus(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if !status.Running {
+			return printCheckStatus(status)
+		}
+	}
+}
+
+func printCheckStatus(status *model.CheckStatus) error {
+	action := "check"
+	if status.Compact {
+		action = "compaction"
+	}
+	switch {
+	case status.Started == "":
+		fmt.Println("No value store check has run")
+	case status.Running:
+		fmt.Printf("Value store %s running since %s\n", action, status.Started)
+	case status.Error != "":
+		return fmt.Errorf("value store %s failed: %s", action, status.Error)
+	default:
+		fmt.Printf("Value store %s complete at %s\n", action, status.Finished)
+		if status.Report != nil {
+			fmt.Print(status.Report)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import "time"
+
+const (
+	defaultAddrProbeInterval    = Duration(time.Hour)
+	defaultAddrProbeTimeout     = Duration(10 * time.Second)
+	defaultAddrProbeConcurrency = 16
+)
+
+// AddrProbe configures periodic checking of registered provider addresses.
+// Each address is dialed on the indexer's libp2p host, and whether it is
+// reachable, and how long it took to connect, is recorded in the registry.
+type AddrProbe struct {
+	// Enable turns on address probing.  This requires libp2p to be enabled.
+	Enable bool
+	// Interval is how often all provider addresses are probed.  The addresses
+	// of a provider are also probed when it is registered or its addresses
+	// change.  A value of 0 uses the default.
+	Interval Duration
+	// Timeout is the maximum time to wait to connect to an address.  A value
+	// of 0 uses the default.
+	Timeout Duration
+	// Concurrency is the number of providers probed at the same time.  A
+	// value of 0 uses the default.
+	Concurrency int
+}
+
+// WithDefaults returns a copy of the AddrProbe config with zero values
+// replaced by default values.
+func (a AddrProbe) WithDefaults() AddrProbe {
+	if a.Interval == 0 {
+		a.Interval = defaultAddrProbeInterval
+	}
+	if a.Timeout == 0 {
+		a.Timeout = defaultAddrProbeTimeout
+	}
+	if a.Concurrency == 0 {
+		a.Concurrency = defaultAddrProbeConcurrency
+	}
+	return a
+}
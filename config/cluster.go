@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const defaultClusterTimeout = Duration(5 * time.Second)
+
+// Cluster configures a sharded cluster of indexers.  The multihash keyspace
+// is divided into equal ranges, one for each node, and each node stores only
+// the multihashes in its range.  Nodes forward the content they ingest to the
+// node that owns it, and find requests are sent to the nodes that own the
+// requested multihashes.  This requires libp2p to be enabled.
+type Cluster struct {
+	// Nodes is the list of libp2p multiaddrs, including the /p2p/ peer ID, of
+	// all nodes in the cluster, including this one.  Every node must have the
+	// same list, in the same order, since the order determines which range
+	// each node owns.  If empty, the indexer does not run as part of a
+	// cluster.
+	Nodes []string
+	// Timeout is the maximum time to wait for another node to respond.  A
+	// value of 0 uses the default.
+	Timeout Duration
+}
+
+// WithDefaults returns a copy of the Cluster config with zero values replaced
+// by default values.
+func (c Cluster) WithDefaults() Cluster {
+	if c.Timeout == 0 {
+		c.Timeout = defaultClusterTimeout
+	}
+	return c
+}
+
+// NodeAddrs returns the cluster nodes as a list of AddrInfo, in the same
+// order as they are listed.
+func (c Cluster) NodeAddrs() ([]peer.AddrInfo, error) {
+	nodes := make([]peer.AddrInfo, len(c.Nodes))
+	for i, addr := range c.Nodes {
+		node, err := peer.AddrInfoFromString(addr)
+		if err != nil {
+			return nil, fmt.Errorf("bad cluster node %q: %s", addr, err)
+		}
+		nodes[i] = *node
+	}
+	return nodes, nil
+}
@@ -13,11 +13,16 @@ import (
 type Config struct {
 	Identity  Identity  // peer identity
 	Addresses Addresses // addresses to listen on
+	AddrProbe AddrProbe // provider address health checking
 	Bootstrap Bootstrap // Peers to connect to for gossip
+	Cluster   Cluster   // sharded cluster configuration
 	Datastore Datastore // datastore config
+	DHTBridge DHTBridge // DHT provider lookup configuration
 	Discovery Discovery // provider pubsub peers
+	Finder    Finder    // finder server configuration
 	Indexer   Indexer   // indexer code configuration
 	Ingest    Ingest    // ingestion related configuration.
+	Mirror    Mirror    // indexer replication configuration
 }
 
 const (
@@ -0,0 +1,21 @@
+package config
+
+import "github.com/libp2p/go-libp2p-core/peer"
+
+// DHTBridge configures a libp2p DHT node that runs on the indexer's libp2p
+// host and answers provider lookups for content in the indexer.
+type DHTBridge struct {
+	// Enable turns on the DHT bridge.  This requires libp2p to be enabled.
+	Enable bool
+	// BootstrapPeers are the addresses of DHT peers to connect to, to join
+	// the DHT network.  If empty, the default IPFS bootstrap peers are used.
+	BootstrapPeers []string
+	// ProtocolPrefix is the DHT protocol prefix.  If empty, the IPFS DHT
+	// protocol prefix, "/ipfs", is used.
+	ProtocolPrefix string
+}
+
+// PeerAddrs returns the bootstrap peers as a list of AddrInfo.
+func (d DHTBridge) PeerAddrs() ([]peer.AddrInfo, error) {
+	return parsePeers(d.BootstrapPeers)
+}
@@ -11,6 +11,8 @@ const (
 	defaultPollInterval     = Duration(24 * time.Hour)
 	defaultRediscoverWait   = Duration(5 * time.Minute)
 	defaultDiscoveryTimeout = Duration(2 * time.Minute)
+	defaultReverifyInterval = Duration(24 * time.Hour)
+	defaultSequenceMaxAge   = Duration(48 * time.Hour)
 )
 
 // Discovery holds addresses of peers to from which to receive index
@@ -20,8 +22,28 @@ type Discovery struct {
 	// Bootstrap is a Set of nodes to try to connect to at startup
 	Bootstrap []string
 	// LotusGateway is the address for a lotus gateway used to collect chain
-	// information when discovering providers
+	// information when discovering providers.  This is an http, https, ws, or
+	// wss URL.  Without a scheme, https is used, and without a path, /rpc/v1
+	// is used.
 	LotusGateway string
+	// LotusToken, if not empty, is sent as a bearer token to the
+	// LotusGateway.  This is needed to use the API of a lotus node.
+	LotusToken string `json:",omitempty"`
+	// LotusFailover lists more lotus gateways, which are tried in order when
+	// the LotusGateway cannot be reached.
+	LotusFailover []LotusEndpoint `json:",omitempty"`
+	// Methods lists the enabled discovery methods.  Each method handles the
+	// discovery addresses that start with its scheme, such as "fil:f01234".
+	// The methods are:
+	//
+	//   "fil"  - Filecoin miner address, looked up using the LotusGateway
+	//   "peer" - libp2p multiaddr of the provider, verified by connecting to it
+	//   "dns"  - domain of the provider, which publishes a signed provider
+	//            record in a DNS TXT record or an HTTPS well-known document
+	//
+	// Discovery addresses without a scheme use the first method.  If empty,
+	// "fil" is the only method, when there is a LotusGateway.
+	Methods []string
 	// Peers lists nodes to attempt to stay connected with
 	Peers []peer.AddrInfo
 	// Policy configures which providers are allowed and blocked
@@ -33,7 +55,29 @@ type Discovery struct {
 	// RediscoverWait is the amount of time that must pass before a provider
 	// can be discovered following a previous discovery attempt
 	RediscoverWait Duration
+	// RemoveUnverified removes a provider and its content from the indexer
+	// when re-verification finds that its discovery address now belongs to a
+	// different peer.  Otherwise, the provider is flagged as unverified and
+	// its content is left out of find results.
+	RemoveUnverified bool
+	// ReverifyInterval is how often discovered providers are verified again,
+	// to get any change to their addresses and to check that their discovery
+	// address still identifies them.  Zero disables re-verification.
+	ReverifyInterval Duration
+	// SequenceMaxAge is how old the sequence number of a signed request from
+	// a provider can be.  Older requests are rejected, and newer ones must
+	// have a greater sequence than the last request from the same provider.
+	// The last sequence from each provider is kept in the datastore, so that
+	// requests cannot be replayed after a restart.  Zero uses 48 hours.
+	SequenceMaxAge Duration
 	// Timeout is the maximum amount of time that the indexer will spend trying
 	// to discover and verify a new provider.
 	Timeout Duration
 }
+
+// LotusEndpoint is the address, and optional bearer token, of a lotus gateway
+// or lotus node API.
+type LotusEndpoint struct {
+	URL   string
+	Token string `json:",omitempty"`
+}
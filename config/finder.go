@@ -0,0 +1,191 @@
+package config
+
+import "time"
+
+const (
+	defaultMaxBatchSize       = 10000
+	defaultMaxStreamBatchSize = 1000000
+	defaultMaxProviderResults = 1000
+
+	defaultFreshnessHalfLife = Duration(7 * 24 * time.Hour)
+	defaultReachableWithin   = Duration(24 * time.Hour)
+
+	defaultCascadeTimeout   = Duration(2 * time.Second)
+	defaultNegativeCacheTTL = Duration(time.Minute)
+
+	defaultExpectedMultihashes = 10000000
+	defaultFalsePositiveRate   = 0.01
+	defaultNegativeCacheSize   = 100000
+)
+
+// Finder holds configuration for the finder servers.
+type Finder struct {
+	// MaxBatchSize is the maximum number of multihashes allowed in a single
+	// find request.  A value of 0 uses the default limit.
+	MaxBatchSize int
+	// MaxStreamBatchSize is the maximum number of multihashes allowed in a
+	// single streaming (newline-delimited JSON) find request.  Streaming
+	// requests are answered one multihash at a time, so this can be much
+	// larger than MaxBatchSize.  A value of 0 uses the default limit.
+	MaxStreamBatchSize int
+	// MaxProviderResults is the maximum number of provider results returned
+	// for each multihash in a find response.  When there are more results, a
+	// cursor is returned to continue reading results in a subsequent
+	// request.  A value of 0 uses the default limit.
+	MaxProviderResults int
+	// Ranking configures how provider results are ordered in find responses.
+	Ranking Ranking
+	// SignResponses, when true, signs find responses using the indexer's
+	// identity, so that clients can verify which indexer a response came
+	// from.  Streamed find results are not signed.
+	SignResponses bool
+	// Cascade configures forwarding of find requests, for multihashes that
+	// are not found locally, to upstream indexers.
+	Cascade Cascade
+	// Prefilter configures answering find requests for multihashes that are
+	// not indexed without reading the value store.
+	Prefilter Prefilter
+	// HTTPCache configures the HTTP caching headers sent in responses to
+	// single multihash and CID find requests.
+	HTTPCache HTTPCache
+	// UnreachableAddrs selects what is done with provider addresses that the
+	// address prober found unreachable, when returning provider results:
+	//
+	//   ""             - return the addresses as registered
+	//   "deprioritize" - list reachable addresses first, fastest first, and
+	//                    unreachable addresses last
+	//   "omit"         - order addresses as for "deprioritize", and leave
+	//                    out unreachable addresses
+	//
+	// Addresses that have not been probed are listed after reachable ones.
+	// This has no effect unless AddrProbe is enabled.
+	UnreachableAddrs string
+}
+
+// Values of Finder.UnreachableAddrs.
+const (
+	UnreachableAddrsKeep         = ""
+	UnreachableAddrsDeprioritize = "deprioritize"
+	UnreachableAddrsOmit         = "omit"
+)
+
+// Cascade is the configuration for querying upstream indexers when a
+// multihash is not found in this indexer.  Results from upstream indexers are
+// merged, deduplicated, and marked with the upstream they came from.
+type Cascade struct {
+	// Upstreams is a list of upstream indexers.  Each is either the URL of
+	// an indexer's HTTP finder API, or the multiaddr, including the /p2p/
+	// peer ID, of an indexer's libp2p finder.  Requests sent upstream are
+	// marked so that the upstream does not cascade them further, so
+	// upstreams may cascade back to this indexer.
+	Upstreams []string
+	// Timeout is the maximum time to wait for each upstream indexer to
+	// respond.  A value of 0 uses the default.
+	Timeout Duration
+	// NegativeCacheTTL is how long a multihash that no upstream indexer has
+	// is remembered, so that upstreams are not queried again for it.  A
+	// value of 0 uses the default.
+	NegativeCacheTTL Duration
+}
+
+// Prefilter is the configuration for the in-memory bloom filter of indexed
+// multihashes and the cache of multihashes recently not found.  A multihash
+// that is not in the bloom filter, or that is in the negative cache, is
+// reported as not found without reading the value store.
+type Prefilter struct {
+	// Enable turns on the bloom filter and negative cache.  The bloom filter
+	// is built from the value store when the indexer starts, and finds are
+	// not filtered until it is built.
+	Enable bool
+	// ExpectedMultihashes is the number of multihashes the bloom filter is
+	// sized for.  If more multihashes are indexed, the false positive rate
+	// increases.  A value of 0 uses the default.
+	ExpectedMultihashes int
+	// FalsePositiveRate is the fraction of multihashes that are not indexed
+	// but that the bloom filter does not filter out, when the expected number
+	// of multihashes are indexed.  A value of 0 uses the default.
+	FalsePositiveRate float64
+	// NegativeCacheSize is the number of multihashes, not found in the value
+	// store, that are remembered.  A value of 0 uses the default.
+	NegativeCacheSize int
+}
+
+// HTTPCache is the configuration of HTTP caching for GET find requests, which
+// allows a CDN or other HTTP cache to answer repeated requests.  Responses with
+// results always include an ETag, derived from the response content, and a
+// Last-Modified time, which is the latest advertisement time of the providers
+// in the response.
+type HTTPCache struct {
+	// MaxAge is how long a response with results may be cached.  A value of 0
+	// sends no Cache-Control header.
+	MaxAge Duration
+	// MissMaxAge is how long a response that has no results may be cached.
+	// A value of 0 sends no Cache-Control header.
+	MissMaxAge Duration
+}
+
+// Ranking is the policy used to rank the provider results for each multihash.
+// When enabled, each provider is given a score from 0 to 1, which is the
+// weighted average of the score for each criterion.  Results are returned in
+// order of highest to lowest score.
+type Ranking struct {
+	// Enabled turns on ranking of provider results.  When false, results are
+	// returned in the order they are stored, and no score is returned.
+	Enabled bool
+	// FreshnessWeight is the weight given to how recently the provider
+	// published its latest advertisement.
+	FreshnessWeight float64
+	// FreshnessHalfLife is the advertisement age at which the freshness score
+	// drops to half.  A value of 0 uses the default.
+	FreshnessHalfLife Duration
+	// SyncWeight is the weight given to whether the most recent sync with the
+	// provider succeeded.
+	SyncWeight float64
+	// ReachabilityWeight is the weight given to whether the provider has been
+	// in contact with the indexer within the ReachableWithin time.
+	ReachabilityWeight float64
+	// ReachableWithin is how recently the provider must have been in contact
+	// to be considered reachable.  A value of 0 uses the default.
+	ReachableWithin Duration
+	// PreferenceWeight is the weight given to the provider's position in the
+	// Preferred list.
+	PreferenceWeight float64
+	// Preferred is a list of provider IDs, most preferred first.
+	Preferred []string
+}
+
+// WithDefaults returns a copy of the Finder config with zero values replaced
+// by default values.
+func (f Finder) WithDefaults() Finder {
+	if f.MaxBatchSize == 0 {
+		f.MaxBatchSize = defaultMaxBatchSize
+	}
+	if f.MaxStreamBatchSize == 0 {
+		f.MaxStreamBatchSize = defaultMaxStreamBatchSize
+	}
+	if f.MaxProviderResults == 0 {
+		f.MaxProviderResults = defaultMaxProviderResults
+	}
+	if f.Ranking.FreshnessHalfLife == 0 {
+		f.Ranking.FreshnessHalfLife = defaultFreshnessHalfLife
+	}
+	if f.Ranking.ReachableWithin == 0 {
+		f.Ranking.ReachableWithin = defaultReachableWithin
+	}
+	if f.Cascade.Timeout == 0 {
+		f.Cascade.Timeout = defaultCascadeTimeout
+	}
+	if f.Cascade.NegativeCacheTTL == 0 {
+		f.Cascade.NegativeCacheTTL = defaultNegativeCacheTTL
+	}
+	if f.Prefilter.ExpectedMultihashes == 0 {
+		f.Prefilter.ExpectedMultihashes = defaultExpectedMultihashes
+	}
+	if f.Prefilter.FalsePositiveRate == 0 {
+		f.Prefilter.FalsePositiveRate = defaultFalsePositiveRate
+	}
+	if f.Prefilter.NegativeCacheSize == 0 {
+		f.Prefilter.NegativeCacheSize = defaultNegativeCacheSize
+	}
+	return f
+}
@@ -41,13 +41,30 @@ func InitWithIdentity(identity Identity) (*Config, error) {
 
 		Discovery: Discovery{
 			LotusGateway: defaultLotusGateway,
+			Methods:      []string{"fil"},
 			Policy: Policy{
 				Allow: defaultAllow,
 				Trust: defaultTrust,
 			},
-			PollInterval:   defaultPollInterval,
-			RediscoverWait: defaultRediscoverWait,
-			Timeout:        defaultDiscoveryTimeout,
+			PollInterval:     defaultPollInterval,
+			RediscoverWait:   defaultRediscoverWait,
+			ReverifyInterval: defaultReverifyInterval,
+			SequenceMaxAge:   defaultSequenceMaxAge,
+			Timeout:          defaultDiscoveryTimeout,
+		},
+
+		Finder: Finder{
+			MaxBatchSize:       defaultMaxBatchSize,
+			MaxProviderResults: defaultMaxProviderResults,
+			Ranking: Ranking{
+				FreshnessWeight:    1,
+				FreshnessHalfLife:  defaultFreshnessHalfLife,
+				SyncWeight:         1,
+				ReachabilityWeight: 1,
+				ReachableWithin:    defaultReachableWithin,
+				PreferenceWeight:   1,
+			},
+			SignResponses: true,
 		},
 
 		Ingest: Ingest{
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	defaultMaxFeedEvents       = 100000
+	defaultMirrorRetryInterval = Duration(10 * time.Second)
+)
+
+// Mirror configures replication of ingested content between indexers.  An
+// indexer that serves its feed publishes every change to its index and
+// registry over libp2p.  An indexer that has a primary follows that feed and
+// applies the same changes locally, instead of ingesting from providers.
+// Both require libp2p to be enabled.
+type Mirror struct {
+	// Serve, when true, publishes this indexer's ingestion feed so that other
+	// indexers can mirror it.
+	Serve bool
+	// AllowMirrors is the list of peer IDs of the indexers that are allowed
+	// to mirror this indexer.  The feed is not served to any other peer.
+	AllowMirrors []string
+	// MaxFeedEvents is the number of most recent changes kept in the feed.
+	// A mirror that falls further behind than this gets a full snapshot of
+	// the index.  A value of 0 uses the default.
+	MaxFeedEvents int
+	// Primary is the multiaddr, including the /p2p/ peer ID, of the indexer
+	// to mirror.  When set, this indexer is a read replica of the primary and
+	// does not ingest advertisements from providers.
+	Primary string
+	// RetryInterval is the time to wait before reconnecting to the primary
+	// after the connection is lost.  A value of 0 uses the default.
+	RetryInterval Duration
+}
+
+// WithDefaults returns a copy of the Mirror config with zero values replaced
+// by default values.
+func (m Mirror) WithDefaults() Mirror {
+	if m.MaxFeedEvents == 0 {
+		m.MaxFeedEvents = defaultMaxFeedEvents
+	}
+	if m.RetryInterval == 0 {
+		m.RetryInterval = defaultMirrorRetryInterval
+	}
+	return m
+}
+
+// MirrorIDs returns the peer IDs of the indexers that are allowed to mirror
+// this indexer.
+func (m Mirror) MirrorIDs() ([]peer.ID, error) {
+	ids := make([]peer.ID, len(m.AllowMirrors))
+	for i, s := range m.AllowMirrors {
+		id, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad mirror peer id %q: %s", s, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
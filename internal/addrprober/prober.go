@@ -0,0 +1,194 @@
+// Package addrprober checks that the addresses of registered providers work.
+//
+// Each address of each provider is dialed on the indexer's libp2p host, using
+// a new connection to only that address, and whether the address is reachable
+// and how long the connection took is recorded in the registry.  The finder
+// uses this to leave out, or list last, addresses that do not work.
+package addrprober
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/transport"
+	"github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("indexer/addrprober")
+
+// eventBuffer is the number of registry events buffered while providers are
+// being probed.
+const eventBuffer = 1024
+
+// transportDialer is implemented by the libp2p swarm.  Dialing with the
+// transport for an address, instead of connecting to the peer, makes a new
+// connection to exactly that address.
+type transportDialer interface {
+	TransportForDialing(multiaddr.Multiaddr) transport.Transport
+}
+
+// Prober periodically probes the addresses of all registered providers, and
+// probes the addresses of providers that are newly registered or whose
+// addresses change.
+type Prober struct {
+	dialer      transportDialer
+	registry    *registry.Registry
+	interval    time.Duration
+	timeout     time.Duration
+	concurrency int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Prober that dials provider addresses on the libp2p host, and
+// starts probing.
+func New(h host.Host, reg *registry.Registry, cfg config.AddrProbe) (*Prober, error) {
+	cfg = cfg.WithDefaults()
+	dialer, ok := h.Network().(transportDialer)
+	if !ok {
+		return nil, errors.New("libp2p host cannot dial individual addresses")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Prober{
+		dialer:      dialer,
+		registry:    reg,
+		interval:    time.Duration(cfg.Interval),
+		timeout:     time.Duration(cfg.Timeout),
+		concurrency: cfg.Concurrency,
+
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go p.run(ctx)
+
+	log.Infow("Provider address probing started", "interval", p.interval)
+	return p, nil
+}
+
+// Close stops probing and waits for probes in progress to be canceled.
+func (p *Prober) Close() {
+	p.cancel()
+	<-p.done
+}
+
+func (p *Prober) run(ctx context.Context) {
+	defer close(p.done)
+
+	events, unsubscribe := p.registry.Subscribe(eventBuffer)
+	defer func() {
+		unsubscribe()
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			// A subscription that fell behind, while probing took too long,
+			// is renewed.  Providers registered in the meantime are probed
+			// now.
+			if events == nil {
+				events, unsubscribe = p.registry.Subscribe(eventBuffer)
+			}
+			p.probeAll(ctx)
+			timer.Reset(p.interval)
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if ev.Type == registry.EventRegistered || ev.Type == registry.EventAddrChanged {
+				p.probeProvider(ctx, ev.Provider)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// probeAll probes the addresses of all registered providers, probing up to
+// the configured number of providers at the same time.
+func (p *Prober) probeAll(ctx context.Context) {
+	sem := make(chan struct{}, p.concurrency)
+	var wg sync.WaitGroup
+	for _, info := range p.registry.AllProviderInfo() {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(info *registry.ProviderInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			p.probeProvider(ctx, info)
+		}(info)
+	}
+	wg.Wait()
+}
+
+// probeProvider probes each of the provider's addresses and records the
+// results in the registry.
+func (p *Prober) probeProvider(ctx context.Context, info *registry.ProviderInfo) {
+	provID := info.AddrInfo.ID
+	statuses := make([]registry.AddrStatus, 0, len(info.AddrInfo.Addrs))
+	for _, addr := range info.AddrInfo.Addrs {
+		status, ok := p.probeAddr(ctx, provID, addr)
+		if ctx.Err() != nil {
+			return
+		}
+		if ok {
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		return
+	}
+	p.registry.RecordAddrStatus(provID, statuses)
+	log.Debugw("Probed provider addresses", "provider", provID, "addrs", len(statuses))
+}
+
+// probeAddr connects to the provider at the address.  Returns false if the
+// host has no transport that can dial the address, in which case whether the
+// address works is not known.
+func (p *Prober) probeAddr(ctx context.Context, provID peer.ID, addr multiaddr.Multiaddr) (registry.AddrStatus, bool) {
+	status := registry.AddrStatus{
+		Addr: addr,
+	}
+	dialAddr, _ := peer.SplitAddr(addr)
+	if dialAddr == nil {
+		return status, false
+	}
+	tpt := p.dialer.TransportForDialing(dialAddr)
+	if tpt == nil || !tpt.CanDial(dialAddr) {
+		return status, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := tpt.Dial(ctx, dialAddr, provID)
+	status.Probed = time.Now()
+	if err != nil {
+		status.Error = err.Error()
+		return status, true
+	}
+	status.RTT = status.Probed.Sub(start)
+	status.Reachable = true
+	conn.Close()
+	return status, true
+}
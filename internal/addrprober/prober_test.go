@@ -0,0 +1,132 @@
+package addrprober
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+func newHost(t *testing.T) host.Host {
+	h, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// closedAddr returns a local address that nothing listens on.
+func closedAddr(t *testing.T) multiaddr.Multiaddr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	maddr, err := manet.FromNetAddr(l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	return maddr
+}
+
+func TestProber(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	indexerHost := newHost(t)
+	provHost := newHost(t)
+
+	goodAddr := provHost.Addrs()[0]
+	badAddr := closedAddr(t)
+	dnsAddr := multiaddr.StringCast("/dns4/provider.example.com/tcp/3003")
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provHost.ID(),
+			Addrs: []multiaddr.Multiaddr{dnsAddr, badAddr, goodAddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prober, err := New(indexerHost, reg, config.AddrProbe{
+		Enable:  true,
+		Timeout: config.Duration(5 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prober.Close()
+
+	var info *registry.ProviderInfo
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info = reg.ProviderInfo(provHost.ID())
+		if _, ok := info.AddrStatus(goodAddr); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("provider addresses were not probed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status, _ := info.AddrStatus(goodAddr)
+	if !status.Reachable || status.RTT == 0 || status.Error != "" {
+		t.Fatalf("expected %s to be reachable, got %+v", goodAddr, status)
+	}
+	status, ok := info.AddrStatus(badAddr)
+	if !ok || status.Reachable || status.Error == "" {
+		t.Fatalf("expected %s to be unreachable, got %+v", badAddr, status)
+	}
+	if _, ok = info.AddrStatus(dnsAddr); ok {
+		t.Fatal("address that cannot be dialed should not be probed")
+	}
+	if info.LastContactTime().IsZero() {
+		t.Fatal("reachable address did not count as contact")
+	}
+
+	// A newly registered provider is probed without waiting for the interval.
+	provHost2 := newHost(t)
+	goodAddr2 := provHost2.Addrs()[0]
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provHost2.ID(),
+			Addrs: []multiaddr.Multiaddr{goodAddr2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		info = reg.ProviderInfo(provHost2.ID())
+		if status, ok = info.AddrStatus(goodAddr2); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new provider addresses were not probed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !status.Reachable {
+		t.Fatalf("expected %s to be reachable, got %+v", goodAddr2, status)
+	}
+}
@@ -0,0 +1,347 @@
+// Package cluster runs an indexer as one node of a sharded cluster of
+// indexers.
+//
+// The multihash keyspace is divided into equal contiguous ranges, one for each
+// node, in the order the nodes are configured.  Multihashes are hashed before
+// being assigned to a range, so that content is spread evenly over the nodes
+// even when multihashes are not cryptographic hashes.  Each node only stores
+// the multihashes in its own range.  Content that a node ingests is forwarded
+// to the nodes that own it, and find requests are sent to the nodes that own
+// the requested multihashes.
+//
+// Nodes communicate over libp2p, which authenticates each node's peer ID.
+// Only the nodes in the cluster are allowed to forward content.
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	finderp2pclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/libp2p"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("indexer/cluster")
+
+// Operations forwarded to other nodes.
+const (
+	opPut            = "put"
+	opRemove         = "remove"
+	opRemoveProvider = "removeProvider"
+	opRemoveContext  = "removeContext"
+)
+
+// Cluster is this indexer's view of the sharded cluster it is part of.
+type Cluster struct {
+	host     host.Host
+	nodes    []peer.ID
+	self     int
+	local    indexer.Interface
+	registry *registry.Registry
+	finders  []*finderp2pclient.Client
+	timeout  time.Duration
+}
+
+// writeRequest is a change to the index that is forwarded to another node.
+type writeRequest struct {
+	Op          string
+	Value       *indexer.Value        `json:",omitempty"`
+	Multihashes []multihash.Multihash `json:",omitempty"`
+	ProviderID  peer.ID               `json:",omitempty"`
+	ContextID   []byte                `json:",omitempty"`
+	// Provider is the forwarding node's registry information about the
+	// provider of the content, so that the receiving node can return the
+	// provider's addresses in find results.
+	Provider *registry.ProviderInfo `json:",omitempty"`
+}
+
+// writeResponse is the result of applying a forwarded change.
+type writeResponse struct {
+	// Count is the number of multihashes that a put added to, or a remove
+	// removed from, the receiving node's index.  Multihashes that the node
+	// already had, or did not have, are not counted, so a change that is
+	// forwarded again is not counted twice.
+	Count int    `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// New joins the host to the cluster made up of the nodes, one of which must
+// be the host.  The local indexer stores the content that this node owns,
+// and the registry is updated with the providers of content forwarded from
+// other nodes.  Requests to other nodes time out after the timeout.
+func New(h host.Host, nodes []peer.AddrInfo, local indexer.Interface, reg *registry.Registry, timeout time.Duration) (*Cluster, error) {
+	c := &Cluster{
+		host:     h,
+		nodes:    make([]peer.ID, len(nodes)),
+		self:     -1,
+		local:    local,
+		registry: reg,
+		finders:  make([]*finderp2pclient.Client, len(nodes)),
+		timeout:  timeout,
+	}
+
+	seen := make(map[peer.ID]struct{}, len(nodes))
+	for i, node := range nodes {
+		if _, ok := seen[node.ID]; ok {
+			return nil, fmt.Errorf("cluster node %s listed more than once", node.ID)
+		}
+		seen[node.ID] = struct{}{}
+		c.nodes[i] = node.ID
+
+		if node.ID == h.ID() {
+			c.self = i
+			continue
+		}
+		h.Peerstore().AddAddrs(node.ID, node.Addrs, peerstore.PermanentAddrTTL)
+		finder, err := finderp2pclient.New(h, node.ID)
+		if err != nil {
+			return nil, err
+		}
+		c.finders[i] = finder
+	}
+	if c.self == -1 {
+		return nil, errors.New("this indexer is not one of the cluster nodes")
+	}
+
+	h.SetStreamHandler(v0.ClusterProtocolID, c.handleStream)
+	log.Infow("Joined indexer cluster", "nodes", len(nodes), "shard", c.self)
+	return c, nil
+}
+
+// Close stops accepting content from other nodes.
+func (c *Cluster) Close() {
+	c.host.RemoveStreamHandler(v0.ClusterProtocolID)
+}
+
+// Shard returns the index of the node that owns the multihash.
+func (c *Cluster) Shard(mh multihash.Multihash) int {
+	sum := sha256.Sum256(mh)
+	// Scale the first 64 bits of the hash to the number of nodes, which
+	// divides the keyspace into equal contiguous ranges.
+	shard, _ := bits.Mul64(binary.BigEndian.Uint64(sum[:8]), uint64(len(c.nodes)))
+	return int(shard)
+}
+
+// IsLocal returns true if this node owns the multihash.
+func (c *Cluster) IsLocal(mh multihash.Multihash) bool {
+	return c.Shard(mh) == c.self
+}
+
+// Indexer returns an indexer that stores the multihashes this node owns in
+// the local indexer, and forwards all others to the nodes that own them.
+func (c *Cluster) Indexer() indexer.Interface {
+	return &shardedIndexer{
+		Interface: c.local,
+		cluster:   c,
+	}
+}
+
+// Find sends a find request to the nodes that own its multihashes, and merges
+// the results.  The request must only have multihashes that other nodes own.
+// The cursors and filter in the request are sent along with the multihashes.
+// Nodes that cannot be reached are skipped.
+func (c *Cluster) Find(req *model.FindRequest) []model.MultihashResult {
+	shardReqs := map[int]*model.FindRequest{}
+	for i, mh := range req.Multihashes {
+		shard := c.Shard(mh)
+		shardReq, ok := shardReqs[shard]
+		if !ok {
+			shardReq = &model.FindRequest{FindFilter: req.FindFilter}
+			shardReqs[shard] = shardReq
+		}
+		shardReq.Multihashes = append(shardReq.Multihashes, mh)
+		if len(req.Cursors) != 0 {
+			shardReq.Cursors = append(shardReq.Cursors, req.Cursors[i])
+		}
+	}
+
+	var lock sync.Mutex
+	var results []model.MultihashResult
+	var wg sync.WaitGroup
+	for shard, shardReq := range shardReqs {
+		if shard == c.self {
+			log.Errorw("Local multihashes sent to find on other nodes", "count", len(shardReq.Multihashes))
+			continue
+		}
+		wg.Add(1)
+		go func(shard int, shardReq *model.FindRequest) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			rsp, err := c.finders[shard].FindBatchRequest(ctx, shardReq)
+			if err != nil {
+				log.Warnw("Cannot find on cluster node", "node", c.nodes[shard], "err", err)
+				return
+			}
+			lock.Lock()
+			results = append(results, rsp.MultihashResults...)
+			lock.Unlock()
+		}(shard, shardReq)
+	}
+	wg.Wait()
+	return results
+}
+
+// forward sends a change to the node at index shard, and returns the count
+// that the node acknowledged.
+func (c *Cluster) forward(shard int, req *writeRequest) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	s, err := c.host.NewStream(ctx, c.nodes[shard], v0.ClusterProtocolID)
+	if err != nil {
+		return 0, fmt.Errorf("cannot connect to cluster node %s: %w", c.nodes[shard], err)
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err = json.NewEncoder(s).Encode(req); err != nil {
+		s.Reset()
+		return 0, err
+	}
+	var rsp writeResponse
+	if err = json.NewDecoder(s).Decode(&rsp); err != nil {
+		s.Reset()
+		return 0, fmt.Errorf("cannot read response from cluster node %s: %w", c.nodes[shard], err)
+	}
+	if rsp.Error != "" {
+		return 0, fmt.Errorf("cluster node %s: %s", c.nodes[shard], rsp.Error)
+	}
+	return rsp.Count, nil
+}
+
+// broadcast sends a change to all other nodes at the same time.  Returns the
+// sum of the counts acknowledged by the nodes, and the first error from any
+// node.
+func (c *Cluster) broadcast(req *writeRequest) (int, error) {
+	counts := make([]int, len(c.nodes))
+	errs := make([]error, len(c.nodes))
+	var wg sync.WaitGroup
+	for shard := range c.nodes {
+		if shard == c.self {
+			continue
+		}
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			counts[shard], errs[shard] = c.forward(shard, req)
+		}(shard)
+	}
+	wg.Wait()
+	var count int
+	var firstErr error
+	for shard, err := range errs {
+		count += counts[shard]
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return count, firstErr
+}
+
+// handleStream applies a change forwarded from another node.
+func (c *Cluster) handleStream(s network.Stream) {
+	defer s.Close()
+
+	from := s.Conn().RemotePeer()
+	if !c.IsNode(from) {
+		log.Warnw("Rejected content from peer that is not a cluster node", "peer", from)
+		s.Reset()
+		return
+	}
+
+	var req writeRequest
+	if err := json.NewDecoder(s).Decode(&req); err != nil {
+		log.Errorw("Cannot read request from cluster node", "node", from, "err", err)
+		s.Reset()
+		return
+	}
+
+	var rsp writeResponse
+	var err error
+	rsp.Count, err = c.apply(&req)
+	if err != nil {
+		log.Errorw("Cannot apply change from cluster node", "node", from, "op", req.Op, "err", err)
+		rsp.Error = err.Error()
+	}
+	if err = json.NewEncoder(s).Encode(&rsp); err != nil {
+		log.Errorw("Cannot send response to cluster node", "node", from, "err", err)
+	}
+}
+
+// apply makes a forwarded change to the local indexer, and returns the number
+// of multihashes put or removed.
+func (c *Cluster) apply(req *writeRequest) (int, error) {
+	if req.Provider != nil {
+		if err := c.updateProvider(req.Provider); err != nil {
+			return 0, err
+		}
+	}
+
+	switch req.Op {
+	case opPut, opRemove:
+		if req.Value == nil {
+			return 0, errors.New("missing value")
+		}
+		if req.Op == opPut {
+			return providerindex.CountPut(c.local, *req.Value, req.Multihashes...)
+		}
+		return providerindex.CountRemove(c.local, *req.Value, req.Multihashes...)
+	case opRemoveProvider:
+		return 0, c.local.RemoveProvider(req.ProviderID)
+	case opRemoveContext:
+		return providerindex.CountRemoveProviderContext(c.local, req.ProviderID, req.ContextID)
+	}
+	return 0, fmt.Errorf("unknown operation %q", req.Op)
+}
+
+// updateProvider stores the provider information from another node, if it is
+// different from what is in the registry.
+func (c *Cluster) updateProvider(info *registry.ProviderInfo) error {
+	current := c.registry.ProviderInfo(info.AddrInfo.ID)
+	if current != nil && current.LastAdvertisement == info.LastAdvertisement && sameAddrs(current.AddrInfo, info.AddrInfo) {
+		return nil
+	}
+	return c.registry.Replicate(info)
+}
+
+// IsNode returns true if the peer is one of the nodes of the cluster.
+func (c *Cluster) IsNode(peerID peer.ID) bool {
+	for _, id := range c.nodes {
+		if id == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+func sameAddrs(a, b peer.AddrInfo) bool {
+	if len(a.Addrs) != len(b.Addrs) {
+		return false
+	}
+	for i := range a.Addrs {
+		if !a.Addrs[i].Equal(b.Addrs[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,382 @@
+package cluster_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/cluster"
+	"github.com/filecoin-project/storetheindex/internal/handler"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	p2pfinderserver "github.com/filecoin-project/storetheindex/server/finder/libp2p"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	providerID   = "12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA"
+	providerAddr = "/ip4/127.0.0.1/tcp/9999"
+	numNodes     = 3
+)
+
+// maxProviderResults is the number of provider results in each page of
+// results that a node returns, small enough that results take several pages.
+const maxProviderResults = 2
+
+type testNode struct {
+	host     host.Host
+	store    indexer.Interface
+	registry *registry.Registry
+	cluster  *cluster.Cluster
+}
+
+// countingFinder is an upstream indexer that has no content, and counts the
+// number of times it is queried.
+type countingFinder struct {
+	lock    sync.Mutex
+	queries int
+}
+
+func (f *countingFinder) Find(ctx context.Context, mh multihash.Multihash) (*model.FindResponse, error) {
+	return f.FindBatch(ctx, []multihash.Multihash{mh})
+}
+
+func (f *countingFinder) FindBatch(ctx context.Context, mhs []multihash.Multihash) (*model.FindResponse, error) {
+	return f.FindBatchRequest(ctx, &model.FindRequest{Multihashes: mhs})
+}
+
+func (f *countingFinder) FindBatchRequest(ctx context.Context, req *model.FindRequest) (*model.FindResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.queries++
+	return &model.FindResponse{}, nil
+}
+
+func (f *countingFinder) queryCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.queries
+}
+
+func TestCluster(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maddr, err := multiaddr.NewMultiaddr(providerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := startCluster(t, nil)
+
+	// Only the node that ingests the content knows about its provider.
+	err = nodes[0].registry.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: []byte("metadata"),
+	}
+	mhs := util.RandomMultihashes(30)
+	if err = nodes[0].cluster.Indexer().Put(value, mhs...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each multihash is stored only on the node that owns it.
+	for _, mh := range mhs {
+		shard := nodes[0].cluster.Shard(mh)
+		for i, node := range nodes {
+			if node.cluster.Shard(mh) != shard {
+				t.Fatal("nodes disagree about which node owns multihash")
+			}
+			if found := hasValue(t, node.store, mh); found != (i == shard) {
+				t.Fatalf("multihash owned by node %d found=%t on node %d", shard, found, i)
+			}
+		}
+	}
+
+	// Nodes that received content learned about its provider.
+	for i, node := range nodes {
+		if !node.registry.IsRegistered(provID) {
+			t.Fatalf("provider not registered on node %d", i)
+		}
+	}
+
+	// Any node gets values from the node that owns them.
+	for i, node := range nodes {
+		for _, mh := range mhs {
+			values, found, err := node.cluster.Indexer().Get(mh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found || len(values) != 1 || !values[0].Equal(value) {
+				t.Fatalf("node %d did not get value for multihash", i)
+			}
+		}
+	}
+
+	// A find request to any node returns results for all multihashes.
+	h := handler.NewFinderHandler(nodes[1].store, nodes[1].registry, nil, config.Finder{}, nil, nil, nodes[1].cluster)
+	results, err := h.MakeFindResults(&model.FindRequest{Multihashes: mhs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(mhs) {
+		t.Fatalf("expected %d results, got %d", len(mhs), len(results))
+	}
+	for _, mhr := range results {
+		if len(mhr.ProviderResults) != 1 {
+			t.Fatalf("expected 1 provider result, got %d", len(mhr.ProviderResults))
+		}
+		addrs := mhr.ProviderResults[0].Provider.Addrs
+		if len(addrs) != 1 || !addrs[0].Equal(maddr) {
+			t.Fatalf("wrong provider addresses in result: %v", addrs)
+		}
+	}
+
+	// Removing the provider removes its content from all nodes.
+	if err = nodes[2].cluster.Indexer().RemoveProvider(provID); err != nil {
+		t.Fatal(err)
+	}
+	for i, node := range nodes {
+		for _, mh := range mhs {
+			if hasValue(t, node.store, mh) {
+				t.Fatalf("content of removed provider still on node %d", i)
+			}
+		}
+	}
+}
+
+func TestClusterWriteRetry(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := startCluster(t, nil)
+	idxr := nodes[0].cluster.Indexer().(providerindex.Counter)
+
+	value := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: []byte("metadata"),
+	}
+	mhs := util.RandomMultihashes(40)
+	count, err := idxr.PutCount(value, mhs[:30]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 30 {
+		t.Fatalf("expected count of 30, got %d", count)
+	}
+
+	// While the last node is not accepting content, a put fails, and only
+	// the new multihashes that the other nodes stored are counted.
+	nodes[2].cluster.Close()
+	count, err = idxr.PutCount(value, mhs...)
+	if err == nil {
+		t.Fatal("expected error writing to node that is not accepting content")
+	}
+	var expect int
+	for _, mh := range mhs[30:] {
+		if nodes[0].cluster.Shard(mh) != 2 {
+			expect++
+		}
+	}
+	if count != expect {
+		t.Fatalf("expected count of %d, got %d", expect, count)
+	}
+
+	// Retrying the put only counts the multihashes that were not stored.
+	addrs := make([]peer.AddrInfo, len(nodes))
+	for i, node := range nodes {
+		addrs[i] = peer.AddrInfo{ID: node.host.ID(), Addrs: node.host.Addrs()}
+	}
+	c, err := cluster.New(nodes[2].host, addrs, nodes[2].store, nodes[2].registry, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	retryCount, err := idxr.PutCount(value, mhs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count+retryCount != 10 {
+		t.Fatalf("expected total count of 10, got %d", count+retryCount)
+	}
+
+	// Removing the context counts all of its multihashes, on all nodes.
+	count, err = idxr.RemoveProviderContextCount(provID, value.ContextID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(mhs) {
+		t.Fatalf("expected count of %d for removed context, got %d", len(mhs), count)
+	}
+}
+
+func TestNotNode(t *testing.T) {
+	h := newHost(t)
+	other := newHost(t)
+	_, err := cluster.New(h, []peer.AddrInfo{{ID: other.ID(), Addrs: other.Addrs()}}, memory.New(), nil, time.Second)
+	if err == nil {
+		t.Fatal("expected error when host is not a cluster node")
+	}
+}
+
+func TestShard(t *testing.T) {
+	c := startCluster(t, nil)[0].cluster
+	counts := make([]int, numNodes)
+	for _, mh := range util.RandomMultihashes(3000) {
+		counts[c.Shard(mh)]++
+	}
+	for i, n := range counts {
+		if n < 800 || n > 1200 {
+			t.Fatalf("node %d owns %d of 3000 multihashes", i, n)
+		}
+	}
+}
+
+func TestClusterPagesAndUpstream(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &countingFinder{}
+	nodes := startCluster(t, upstream)
+
+	// A multihash with more values than fit in one page of results.
+	mhs := util.RandomMultihashes(2)
+	mh, missing := mhs[0], mhs[1]
+	owner := nodes[0].cluster.Shard(mh)
+	other := (owner + 1) % numNodes
+	const numValues = 3*maxProviderResults + 1
+	for i := 0; i < numValues; i++ {
+		value := indexer.Value{
+			ProviderID:    provID,
+			ContextID:     []byte{byte(i)},
+			MetadataBytes: []byte("metadata"),
+		}
+		if err = nodes[owner].store.Put(value, mh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Getting from another node reads all pages.
+	values, found, err := nodes[other].cluster.Indexer().Get(mh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || len(values) != numValues {
+		t.Fatalf("expected %d values, got %d", numValues, len(values))
+	}
+
+	// A multihash that no node has is only looked for upstream by the node
+	// that the request was sent to.
+	if nodes[other].cluster.IsLocal(missing) {
+		other = (nodes[other].cluster.Shard(missing) + 1) % numNodes
+	}
+	h := handler.NewFinderHandler(nodes[other].store, nodes[other].registry, nil, config.Finder{}, nil,
+		[]handler.Upstream{{Name: "upstream", Finder: upstream}}, nodes[other].cluster)
+	results, err := h.MakeFindResults(&model.FindRequest{Multihashes: []multihash.Multihash{missing}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Fatal("expected no results for missing multihash")
+	}
+	if n := upstream.queryCount(); n != 1 {
+		t.Fatalf("expected 1 upstream query, got %d", n)
+	}
+}
+
+// startCluster starts a cluster of nodes, each with a finder server so that
+// other nodes can find content on it.  If upstream is not nil, then each
+// node's finder server looks for missing content there.
+func startCluster(t *testing.T, upstream *countingFinder) []*testNode {
+	nodes := make([]*testNode, numNodes)
+	addrs := make([]peer.AddrInfo, numNodes)
+	for i := range nodes {
+		h := newHost(t)
+		nodes[i] = &testNode{
+			host:     h,
+			store:    providerindex.New(memory.New(), dssync.MutexWrap(datastore.NewMapDatastore())),
+			registry: newRegistry(t),
+		}
+		addrs[i] = peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	}
+	for _, node := range nodes {
+		c, err := cluster.New(node.host, addrs, node.store, node.registry, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		node.cluster = c
+
+		opts := []p2pfinderserver.ServerOption{
+			p2pfinderserver.FinderConfig(config.Finder{MaxProviderResults: maxProviderResults}),
+			p2pfinderserver.Cluster(c),
+		}
+		if upstream != nil {
+			opts = append(opts, p2pfinderserver.Upstream("upstream", upstream))
+		}
+		_, err = p2pfinderserver.New(context.Background(), node.host, node.store, node.registry, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nodes
+}
+
+func hasValue(t *testing.T, store indexer.Interface, mh multihash.Multihash) bool {
+	_, found, err := store.Get(mh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func newRegistry(t *testing.T) *registry.Registry {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reg.Close() })
+	return reg
+}
+
+func newHost(t *testing.T) host.Host {
+	h, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
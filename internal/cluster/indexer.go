@@ -0,0 +1,181 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+// shardedIndexer is an indexer that stores content in the node of the
+// cluster that owns it.
+type shardedIndexer struct {
+	indexer.Interface
+	cluster *Cluster
+}
+
+// Get gets the values for a multihash from the node that owns it.  Results
+// from another node are read a page at a time, following the cursor of each
+// page until the last page.
+func (s *shardedIndexer) Get(mh multihash.Multihash) ([]indexer.Value, bool, error) {
+	shard := s.cluster.Shard(mh)
+	if shard == s.cluster.self {
+		return s.Interface.Get(mh)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cluster.timeout)
+	defer cancel()
+
+	var values []indexer.Value
+	var cursor string
+	for {
+		rsp, err := s.cluster.finders[shard].FindBatchCursors(ctx, []multihash.Multihash{mh}, []string{cursor})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(rsp.MultihashResults) == 0 {
+			break
+		}
+		mhr := rsp.MultihashResults[0]
+		for _, pr := range mhr.ProviderResults {
+			metadata, err := pr.Metadata.MarshalBinary()
+			if err != nil {
+				return nil, false, err
+			}
+			values = append(values, indexer.Value{
+				ProviderID:    pr.Provider.ID,
+				ContextID:     pr.ContextID,
+				MetadataBytes: metadata,
+			})
+		}
+		if mhr.Cursor == "" || len(mhr.ProviderResults) == 0 {
+			break
+		}
+		cursor = mhr.Cursor
+	}
+	return values, len(values) != 0, nil
+}
+
+func (s *shardedIndexer) Put(value indexer.Value, mhs ...multihash.Multihash) error {
+	_, err := s.write(opPut, value, mhs)
+	return err
+}
+
+// PutCount is Put, and also returns the number of multihashes newly indexed,
+// as acknowledged by the nodes that own them.
+func (s *shardedIndexer) PutCount(value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	return s.write(opPut, value, mhs)
+}
+
+func (s *shardedIndexer) Remove(value indexer.Value, mhs ...multihash.Multihash) error {
+	_, err := s.write(opRemove, value, mhs)
+	return err
+}
+
+// RemoveCount is Remove, and also returns the number of multihashes removed,
+// as acknowledged by the nodes that owned them.
+func (s *shardedIndexer) RemoveCount(value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	return s.write(opRemove, value, mhs)
+}
+
+func (s *shardedIndexer) RemoveProvider(providerID peer.ID) error {
+	if err := s.Interface.RemoveProvider(providerID); err != nil {
+		return err
+	}
+	_, err := s.cluster.broadcast(&writeRequest{
+		Op:         opRemoveProvider,
+		ProviderID: providerID,
+	})
+	return err
+}
+
+func (s *shardedIndexer) RemoveProviderContext(providerID peer.ID, contextID []byte) error {
+	_, err := s.RemoveProviderContextCount(providerID, contextID)
+	return err
+}
+
+// RemoveProviderContextCount is RemoveProviderContext, and also returns the
+// number of multihashes that were indexed for the context, as acknowledged by
+// all nodes.
+func (s *shardedIndexer) RemoveProviderContextCount(providerID peer.ID, contextID []byte) (int, error) {
+	count, err := providerindex.CountRemoveProviderContext(s.Interface, providerID, contextID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.cluster.broadcast(&writeRequest{
+		Op:         opRemoveContext,
+		ProviderID: providerID,
+		ContextID:  contextID,
+	})
+	return count + n, err
+}
+
+// write puts or removes the multihashes owned by this node locally, and
+// forwards the others to the nodes that own them.  All nodes are written to
+// at the same time.  A write without any multihashes updates values that may
+// be on any node, so it is sent to all nodes.
+//
+// The returned count is the sum of the counts acknowledged by the nodes that
+// were written to, and is returned even if some nodes could not be written
+// to.  Since each node only counts the multihashes that its write changed,
+// the whole write can be retried after a failure without counting any
+// multihash twice.
+func (s *shardedIndexer) write(op string, value indexer.Value, mhs []multihash.Multihash) (int, error) {
+	localWrite := providerindex.CountPut
+	if op == opRemove {
+		localWrite = providerindex.CountRemove
+	}
+	provider := s.cluster.registry.ProviderInfo(value.ProviderID)
+
+	if len(mhs) == 0 {
+		if _, err := localWrite(s.Interface, value); err != nil {
+			return 0, err
+		}
+		_, err := s.cluster.broadcast(&writeRequest{
+			Op:       op,
+			Value:    &value,
+			Provider: provider,
+		})
+		return 0, err
+	}
+
+	shardMhs := map[int][]multihash.Multihash{}
+	for _, mh := range mhs {
+		shard := s.cluster.Shard(mh)
+		shardMhs[shard] = append(shardMhs[shard], mh)
+	}
+
+	counts := make([]int, len(s.cluster.nodes))
+	errs := make([]error, len(s.cluster.nodes))
+	var wg sync.WaitGroup
+	for shard, mhs := range shardMhs {
+		wg.Add(1)
+		go func(shard int, mhs []multihash.Multihash) {
+			defer wg.Done()
+			if shard == s.cluster.self {
+				counts[shard], errs[shard] = localWrite(s.Interface, value, mhs...)
+				return
+			}
+			counts[shard], errs[shard] = s.cluster.forward(shard, &writeRequest{
+				Op:          op,
+				Value:       &value,
+				Multihashes: mhs,
+				Provider:    provider,
+			})
+		}(shard, mhs)
+	}
+	wg.Wait()
+
+	var count int
+	var firstErr error
+	for shard := range counts {
+		count += counts[shard]
+		if errs[shard] != nil && firstErr == nil {
+			firstErr = errs[shard]
+		}
+	}
+	return count, firstErr
+}
@@ -0,0 +1,172 @@
+// Package dhtbridge runs a libp2p Kademlia DHT node that answers provider
+// record lookups using the content in the indexer.  This makes indexed content
+// discoverable to unmodified libp2p DHT clients.
+//
+// The DHT reads provider records from its datastore.  The bridge gives the DHT
+// a datastore that generates provider records for a multihash by finding it
+// the same way as the indexer's finder, and adds the addresses of each
+// provider to the host's peerstore so that they are included in the DHT
+// response.
+// Provider records that other peers try to store on this node are discarded.
+package dhtbridge
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/providers"
+	"github.com/multiformats/go-base32"
+	"github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("indexer/dhtbridge")
+
+// Bridge is a DHT server node that answers provider lookups from the indexer.
+type Bridge struct {
+	dht *dht.IpfsDHT
+}
+
+// Finder finds the providers of a multihash.
+type Finder interface {
+	FindProviders(multihash.Multihash) ([]peer.AddrInfo, error)
+}
+
+// New creates a DHT server node on the host, that answers provider lookups for
+// multihashes using the finder.  The DHT uses the protocol prefix, such as
+// "/ipfs", and connects to the bootstrap peers to join the DHT network.
+func New(ctx context.Context, h host.Host, finder Finder, protocolPrefix string, bootstrapPeers []peer.AddrInfo) (*Bridge, error) {
+	dstore := &providerDatastore{
+		Batching:  dssync.MutexWrap(datastore.NewMapDatastore()),
+		finder:    finder,
+		peerstore: h.Peerstore(),
+	}
+
+	opts := []dht.Option{
+		dht.Mode(dht.ModeServer),
+		dht.Datastore(dstore),
+		// Do not cache provider records, so that lookups always reflect the
+		// current content of the indexer.
+		dht.ProvidersOptions([]providers.Option{providers.Cache(nopCache{})}),
+		dht.BootstrapPeers(bootstrapPeers...),
+	}
+	if protocolPrefix != "" {
+		opts = append(opts, dht.ProtocolPrefix(protocol.ID(protocolPrefix)))
+	}
+
+	d, err := dht.New(ctx, h, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.Bootstrap(ctx); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	log.Infow("DHT bridge started", "host_id", h.ID(), "bootstrap_peers", len(bootstrapPeers))
+	return &Bridge{dht: d}, nil
+}
+
+// DHT returns the DHT node used by the bridge.
+func (b *Bridge) DHT() *dht.IpfsDHT {
+	return b.dht
+}
+
+// Close stops the DHT node.
+func (b *Bridge) Close() error {
+	return b.dht.Close()
+}
+
+// providerDatastore is the datastore used by the DHT.  Queries for the
+// provider records of a key are answered by the finder, and writes of
+// provider records are discarded.  All other data is kept in the wrapped
+// datastore.
+type providerDatastore struct {
+	datastore.Batching
+	finder    Finder
+	peerstore peerstore.Peerstore
+}
+
+func (d *providerDatastore) Put(key datastore.Key, value []byte) error {
+	if strings.HasPrefix(key.String(), providers.ProvidersKeyPrefix) {
+		return nil
+	}
+	return d.Batching.Put(key, value)
+}
+
+func (d *providerDatastore) Query(q query.Query) (query.Results, error) {
+	// Only a query for the provider records of a single key is answered by
+	// the finder.  Queries for all provider records, done periodically to
+	// remove expired records, go to the wrapped datastore.
+	encKey := strings.TrimPrefix(q.Prefix, providers.ProvidersKeyPrefix)
+	if encKey == q.Prefix || encKey == "" || strings.Contains(encKey, "/") {
+		return d.Batching.Query(q)
+	}
+
+	mh, err := base32.RawStdEncoding.DecodeString(encKey)
+	if err != nil {
+		return query.ResultsWithEntries(q, nil), nil
+	}
+	provIDs, err := d.findProviders(mh)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider records are given the current time, so that they are not
+	// expired.
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(buf, time.Now().UnixNano())
+	timeValue := buf[:n]
+
+	entries := make([]query.Entry, len(provIDs))
+	for i, provID := range provIDs {
+		entries[i] = query.Entry{
+			Key:   q.Prefix + "/" + base32.RawStdEncoding.EncodeToString([]byte(provID)),
+			Value: timeValue,
+			Size:  len(timeValue),
+		}
+	}
+	return query.ResultsWithEntries(q, entries), nil
+}
+
+// findProviders gets the unique providers of a multihash from the finder, and
+// adds the addresses of each provider to the peerstore.
+func (d *providerDatastore) findProviders(mh multihash.Multihash) ([]peer.ID, error) {
+	provs, err := d.finder.FindProviders(mh)
+	if err != nil {
+		return nil, err
+	}
+	provIDs := make([]peer.ID, len(provs))
+	for i := range provs {
+		provIDs[i] = provs[i].ID
+		if len(provs[i].Addrs) != 0 {
+			d.peerstore.AddAddrs(provs[i].ID, provs[i].Addrs, peerstore.ProviderAddrTTL)
+		}
+	}
+	return provIDs, nil
+}
+
+// nopCache is a provider record cache that does not cache anything.
+type nopCache struct{}
+
+func (nopCache) Add(key, value interface{}) bool                { return false }
+func (nopCache) Get(key interface{}) (interface{}, bool)        { return nil, false }
+func (nopCache) Contains(key interface{}) bool                  { return false }
+func (nopCache) Peek(key interface{}) (interface{}, bool)       { return nil, false }
+func (nopCache) Remove(key interface{}) bool                    { return false }
+func (nopCache) RemoveOldest() (interface{}, interface{}, bool) { return nil, nil, false }
+func (nopCache) GetOldest() (interface{}, interface{}, bool)    { return nil, nil, false }
+func (nopCache) Keys() []interface{}                            { return nil }
+func (nopCache) Len() int                                       { return 0 }
+func (nopCache) Purge()                                         {}
+func (nopCache) Resize(int) int                                 { return 0 }
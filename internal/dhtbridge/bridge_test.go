@@ -0,0 +1,160 @@
+package dhtbridge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/handler"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	providerID     = "12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA"
+	unverifiedID   = "12D3KooWSG3JuvEjRkSxt93ADTjQxqe4ExbBwSkQ9Zyk1WfBaZJF"
+	providerAddr   = "/ip4/127.0.0.1/tcp/9999"
+	protocolPrefix = "/indexertest"
+)
+
+func TestGetProviders(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maddr, err := multiaddr.NewMultiaddr(providerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Provider whose discovery address belongs to a different peer.
+	unverID, err := peer.Decode(unverifiedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.Replicate(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    unverID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+		Unverified: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mhs := util.RandomMultihashes(2)
+	store := memory.New()
+	for _, id := range []peer.ID{provID, unverID} {
+		value := indexer.Value{
+			ProviderID:    id,
+			ContextID:     []byte("ctx"),
+			MetadataBytes: []byte("metadata"),
+		}
+		if err = store.Put(value, mhs[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	finder := handler.NewFinderHandler(store, reg, nil, config.Finder{}, nil, nil, nil)
+
+	// Start the bridge and a plain DHT client node on a local network.
+	bridgeHost := newHost(t)
+	defer bridgeHost.Close()
+	bridge, err := New(ctx, bridgeHost, finder, protocolPrefix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bridge.Close()
+
+	clientHost := newHost(t)
+	defer clientHost.Close()
+	bridgeInfo := peer.AddrInfo{
+		ID:    bridgeHost.ID(),
+		Addrs: bridgeHost.Addrs(),
+	}
+	client, err := dht.New(ctx, clientHost,
+		dht.Mode(dht.ModeServer),
+		dht.ProtocolPrefix(protocolPrefix),
+		dht.BootstrapPeers(bridgeInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err = clientHost.Connect(ctx, bridgeInfo); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the bridge to be in the client's routing table.
+	for client.RoutingTable().Find(bridgeHost.ID()) == "" {
+		select {
+		case <-ctx.Done():
+			t.Fatal("bridge not added to client routing table")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	provs, err := client.FindProviders(ctx, cid.NewCidV1(cid.Raw, mhs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) != 1 {
+		t.Fatalf("expected 1 provider, got %d", len(provs))
+	}
+	if provs[0].ID != provID {
+		t.Fatalf("expected provider %s, got %s", provID, provs[0].ID)
+	}
+	if len(provs[0].Addrs) != 1 || !provs[0].Addrs[0].Equal(maddr) {
+		t.Fatalf("wrong provider addresses: %v", provs[0].Addrs)
+	}
+
+	// Multihash that is not indexed has no providers.
+	provs, err = client.FindProviders(ctx, cid.NewCidV1(cid.Raw, mhs[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) != 0 {
+		t.Fatalf("expected no providers, got %d", len(provs))
+	}
+}
+
+func newHost(t *testing.T) host.Host {
+	h, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
@@ -0,0 +1,210 @@
+package dnsdiscovery
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
+	"github.com/filecoin-project/storetheindex/internal/syserr"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
+	"github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("indexer/dnsdiscovery")
+
+const (
+	// TXTPrefix is the name, prepended to the provider's domain, of the DNS
+	// TXT record that holds the provider record.
+	TXTPrefix = "_storetheindex."
+	// TXTKey starts the value of the TXT record, and is followed by the
+	// base64 encoded provider record.
+	TXTKey = "provider="
+	// WellKnownPath is the path, on the provider's domain, of the HTTPS
+	// document that holds the provider record.
+	WellKnownPath = "/.well-known/storetheindex-provider"
+)
+
+// maxRecordSize limits the size of a provider record that is read.
+const maxRecordSize = 1 << 16
+
+// Discoverer verifies a provider using a signed provider record published at
+// the provider's domain.  The record is a libp2p signed peer record, so the
+// signature proves that the provider has the private key for its peer ID.
+//
+// The record is looked up in the DNS TXT record at TXTPrefix + domain, and if
+// that is not found, fetched from https://domain + WellKnownPath.
+type Discoverer struct {
+	lookupTXT  func(context.Context, string) ([]string, error)
+	httpClient *http.Client
+	scheme     string
+}
+
+// NewDiscoverer creates a new DNS Discoverer.
+func NewDiscoverer() *Discoverer {
+	return &Discoverer{
+		lookupTXT:  net.DefaultResolver.LookupTXT,
+		httpClient: http.DefaultClient,
+		scheme:     "https",
+	}
+}
+
+// Discover gets the signed provider record for the domain, which is the
+// discovery address, and checks that the record is for the provider.
+func (d *Discoverer) Discover(ctx context.Context, peerID peer.ID, domain string) (*discovery.Discovered, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if err := checkDomain(domain); err != nil {
+		return nil, syserr.New(err, http.StatusBadRequest)
+	}
+
+	data, err := d.lookupDNS(ctx, domain)
+	if err != nil {
+		log.Debugw("No provider record in DNS, trying well-known document", "domain", domain, "err", err)
+		var wkErr error
+		data, wkErr = d.fetchWellKnown(ctx, domain)
+		if wkErr != nil {
+			err = fmt.Errorf("cannot get provider record for %s: dns: %s, https: %s", domain, err, wkErr)
+			return nil, syserr.New(err, http.StatusBadGateway)
+		}
+	}
+
+	rec, err := OpenRecord(data)
+	if err != nil {
+		return nil, syserr.New(err, http.StatusBadRequest)
+	}
+	if rec.PeerID != peerID {
+		return nil, discovery.ErrProviderMismatch
+	}
+
+	return &discovery.Discovered{
+		AddrInfo: peer.AddrInfo{
+			ID:    rec.PeerID,
+			Addrs: rec.Addrs,
+		},
+		Type: discovery.DomainType,
+	}, nil
+}
+
+// checkDomain checks that the domain is a DNS host name, so that it cannot be
+// used to make the indexer fetch a document from an IP address, port, or path
+// other than the provider domain's well-known document.
+func checkDomain(domain string) error {
+	if domain == "" {
+		return errors.New("empty provider domain")
+	}
+	if len(domain) > 253 {
+		return errors.New("provider domain too long")
+	}
+	if net.ParseIP(domain) != nil {
+		return errors.New("provider domain cannot be an ip address")
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return errors.New("provider domain must have a top-level domain")
+	}
+	for _, label := range labels {
+		if !validLabel(label) {
+			return fmt.Errorf("invalid provider domain %q", domain)
+		}
+	}
+	// A top-level domain is never numeric, and names like 127.1 may be
+	// resolved as IP addresses.
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return errors.New("provider domain cannot be an ip address")
+	}
+	return nil
+}
+
+// validLabel returns true if the label is a valid DNS host name label: 1 to
+// 63 letters, digits, or hyphens, that does not start or end with a hyphen.
+func validLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupDNS returns the provider record from the domain's TXT record.
+func (d *Discoverer) lookupDNS(ctx context.Context, domain string) ([]byte, error) {
+	txts, err := d.lookupTXT(ctx, TXTPrefix+domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		if strings.HasPrefix(txt, TXTKey) {
+			return base64.StdEncoding.DecodeString(txt[len(TXTKey):])
+		}
+	}
+	return nil, errors.New("no provider record in txt records")
+}
+
+// fetchWellKnown returns the provider record from the domain's well-known
+// document.
+func (d *Discoverer) fetchWellKnown(ctx context.Context, domain string) ([]byte, error) {
+	u := d.scheme + "://" + domain + WellKnownPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRecordSize))
+}
+
+// SignRecord creates a provider record, for the peer ID of the private key,
+// that has the given addresses.  The record is published as the body of the
+// well-known document, or base64 encoded in a TXT record with TXTRecord.
+func SignRecord(privKey crypto.PrivKey, addrs []multiaddr.Multiaddr) ([]byte, error) {
+	peerID, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	rec := peer.PeerRecordFromAddrInfo(peer.AddrInfo{
+		ID:    peerID,
+		Addrs: addrs,
+	})
+	env, err := record.Seal(rec, privKey)
+	if err != nil {
+		return nil, err
+	}
+	return env.Marshal()
+}
+
+// TXTRecord returns the value of the DNS TXT record for a provider record.
+func TXTRecord(data []byte) string {
+	return TXTKey + base64.StdEncoding.EncodeToString(data)
+}
+
+// OpenRecord verifies the signature of a provider record and returns the
+// peer record in it.  The record must be signed with the key of its peer ID.
+func OpenRecord(data []byte) (*peer.PeerRecord, error) {
+	var rec peer.PeerRecord
+	env, err := record.ConsumeTypedEnvelope(data, &rec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provider record: %s", err)
+	}
+	if !rec.PeerID.MatchesPublicKey(env.PublicKey) {
+		return nil, errors.New("provider record not signed by its peer id")
+	}
+	return &rec, nil
+}
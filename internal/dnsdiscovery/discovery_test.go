@@ -0,0 +1,193 @@
+package dnsdiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const testDomain = "provider.example.com"
+
+func newRecord(t *testing.T) (peer.ID, crypto.PrivKey, []multiaddr.Multiaddr, []byte) {
+	privKey, _, err := p2ptest.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerID, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.4/tcp/3003")}
+	data, err := SignRecord(privKey, addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peerID, privKey, addrs, data
+}
+
+func newDNSDiscoverer(txts map[string][]string) *Discoverer {
+	d := NewDiscoverer()
+	d.lookupTXT = func(ctx context.Context, name string) ([]string, error) {
+		txt, ok := txts[name]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return txt, nil
+	}
+	return d
+}
+
+func checkDiscovered(t *testing.T, discovered *discovery.Discovered, peerID peer.ID, addrs []multiaddr.Multiaddr) {
+	if discovered.AddrInfo.ID != peerID {
+		t.Fatal("wrong provider id")
+	}
+	if len(discovered.AddrInfo.Addrs) != len(addrs) || !discovered.AddrInfo.Addrs[0].Equal(addrs[0]) {
+		t.Fatal("wrong provider addresses:", discovered.AddrInfo.Addrs)
+	}
+	if discovered.Type != discovery.DomainType {
+		t.Fatal("wrong provider type")
+	}
+}
+
+func TestDiscoverDNS(t *testing.T) {
+	peerID, _, addrs, data := newRecord(t)
+	d := newDNSDiscoverer(map[string][]string{
+		TXTPrefix + testDomain: {"v=other", TXTRecord(data)},
+	})
+
+	discovered, err := d.Discover(context.Background(), peerID, testDomain+".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiscovered(t, discovered, peerID, addrs)
+
+	otherID, _, _, _ := newRecord(t)
+	_, err = d.Discover(context.Background(), otherID, testDomain)
+	if !errors.Is(err, discovery.ErrProviderMismatch) {
+		t.Fatal("expected provider mismatch, got:", err)
+	}
+}
+
+func TestDiscoverWellKnown(t *testing.T) {
+	peerID, _, addrs, data := newRecord(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != WellKnownPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	// Send requests for the test domain to the test server.
+	d := newDNSDiscoverer(nil)
+	d.httpClient = srv.Client()
+	srvAddr := srv.Listener.Addr().String()
+	transport := d.httpClient.Transport.(*http.Transport)
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr != testDomain+":443" {
+			return nil, fmt.Errorf("unexpected address %s", addr)
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, srvAddr)
+	}
+
+	discovered, err := d.Discover(context.Background(), peerID, testDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiscovered(t, discovered, peerID, addrs)
+
+	// Neither a TXT record nor a well-known document.
+	srv.Close()
+	_, err = d.Discover(context.Background(), peerID, testDomain)
+	if err == nil {
+		t.Fatal("expected error when there is no provider record")
+	}
+}
+
+func TestDiscoverBadDomain(t *testing.T) {
+	peerID, _, _, _ := newRecord(t)
+	d := newDNSDiscoverer(nil)
+	d.httpClient = &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			t.Fatal("unexpected request to", r.URL)
+			return nil, nil
+		}),
+	}
+
+	for _, domain := range []string{
+		"",
+		"localhost",
+		"127.0.0.1",
+		"127.1",
+		"::1",
+		"[::1]",
+		"provider.example.com:8080",
+		"169.254.169.254/latest",
+		"provider.example.com/path",
+		"provider.example.com?q=1",
+		"user@provider.example.com",
+		"provider.example.com#frag",
+		"-provider.example.com",
+		"provider..example.com",
+	} {
+		_, err := d.Discover(context.Background(), peerID, domain)
+		if err == nil {
+			t.Fatalf("expected error for domain %q", domain)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestOpenRecord(t *testing.T) {
+	peerID, _, _, data := newRecord(t)
+	rec, err := OpenRecord(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.PeerID != peerID {
+		t.Fatal("wrong peer id in record")
+	}
+
+	// Tampered record.
+	bad := append([]byte{}, data...)
+	bad[len(bad)-1] ^= 0xff
+	if _, err = OpenRecord(bad); err == nil {
+		t.Fatal("expected error for tampered record")
+	}
+
+	// Record for a peer ID signed by another key.
+	_, otherKey, _, _ := newRecord(t)
+	rec.Seq++
+	env, err := sealRecord(rec, otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenRecord(env); err == nil {
+		t.Fatal("expected error for record signed by another peer")
+	}
+}
+
+func sealRecord(rec *peer.PeerRecord, privKey crypto.PrivKey) ([]byte, error) {
+	env, err := record.Seal(rec, privKey)
+	if err != nil {
+		return nil, err
+	}
+	return env.Marshal()
+}
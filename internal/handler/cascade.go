@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/client"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+)
+
+// maxNegativeCacheSize is the maximum number of multihashes remembered as not
+// found by upstream indexers.
+const maxNegativeCacheSize = 64 * 1024
+
+// Upstream is an indexer that is queried for multihashes that are not found
+// in this indexer.
+type Upstream struct {
+	// Name identifies the upstream indexer in the results that came from it.
+	Name string
+	// Finder is the client used to query the upstream indexer.
+	Finder client.Finder
+}
+
+// requestFinder is implemented by finder clients that can send a whole find
+// request.  This lets the request carry a filter, so that the upstream
+// indexer only returns the provider results that the filter selects, and
+// tell the upstream indexer not to cascade the request further.
+type requestFinder interface {
+	FindBatchRequest(context.Context, *model.FindRequest) (*model.FindResponse, error)
+}
+
+// cascader queries upstream indexers for the multihashes that are not found
+// locally, and remembers which multihashes no upstream indexer has.
+type cascader struct {
+	upstreams   []Upstream
+	timeout     time.Duration
+	negativeTTL time.Duration
+
+	negMutex sync.Mutex
+	negCache map[string]time.Time
+}
+
+// provCtx identifies a provider result by provider and context ID.
+type provCtx struct {
+	id  peer.ID
+	ctx string
+}
+
+// newCascader creates a cascader for the upstream indexers.  Returns nil if
+// there are no upstream indexers.
+func newCascader(upstreams []Upstream, cfg config.Cascade) *cascader {
+	if len(upstreams) == 0 {
+		return nil
+	}
+	return &cascader{
+		upstreams:   upstreams,
+		timeout:     time.Duration(cfg.Timeout),
+		negativeTTL: time.Duration(cfg.NegativeCacheTTL),
+		negCache:    map[string]time.Time{},
+	}
+}
+
+// find queries all upstream indexers, in parallel, for the multihashes.  The
+// results from all upstreams are merged, with the provider results for each
+// multihash deduplicated by provider and context ID.  Each provider result is
+// marked with the name of the upstream it came from.  Upstreams that fail or
+// do not respond within the timeout are skipped.
+//
+// The filter is sent to upstreams whose client supports it, and is also
+// applied to the results, since not all upstreams support filtering.  Requests
+// are marked so that upstreams do not cascade them, and only upstreams whose
+// client can send the mark are queried.
+func (c *cascader) find(mhs []multihash.Multihash, filter *model.FindFilter, maxResults int) map[string][]model.ProviderResult {
+	now := time.Now()
+	mhs = c.removeNegative(mhs, now)
+	if len(mhs) == 0 {
+		return nil
+	}
+
+	rsps := make([]*model.FindResponse, len(c.upstreams))
+	var wg sync.WaitGroup
+	for i := range c.upstreams {
+		finder, ok := c.upstreams[i].Finder.(requestFinder)
+		if !ok {
+			log.Warnw("Upstream indexer client cannot mark forwarded requests, skipping", "upstream", c.upstreams[i].Name)
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			rsp, err := finder.FindBatchRequest(ctx, &model.FindRequest{
+				Multihashes: mhs,
+				FindFilter:  *filter,
+				NoCascade:   true,
+			})
+			if err != nil {
+				log.Warnw("Cannot query upstream indexer", "upstream", c.upstreams[i].Name, "err", err)
+				return
+			}
+			rsps[i] = rsp
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]map[provCtx]struct{}{}
+	merged := map[string][]model.ProviderResult{}
+	complete := true
+	for i, rsp := range rsps {
+		if rsp == nil {
+			complete = false
+			continue
+		}
+		for _, mhr := range rsp.MultihashResults {
+			k := string(mhr.Multihash)
+			mhSeen, ok := seen[k]
+			if !ok {
+				mhSeen = map[provCtx]struct{}{}
+				seen[k] = mhSeen
+			}
+			for _, pr := range mhr.ProviderResults {
+				if len(merged[k]) >= maxResults {
+					break
+				}
+				if !matchProviderResult(&pr, filter) {
+					continue
+				}
+				key := provCtx{pr.Provider.ID, string(pr.ContextID)}
+				if _, ok = mhSeen[key]; ok {
+					continue
+				}
+				mhSeen[key] = struct{}{}
+				pr.Upstream = c.upstreams[i].Name
+				merged[k] = append(merged[k], pr)
+			}
+		}
+	}
+
+	// Only remember that upstreams do not have a multihash if all upstreams
+	// answered and none had any results for it.  Upstreams that were sent a
+	// filter may have results that the filter did not select.
+	if complete && filter.IsEmpty() {
+		c.addNegative(mhs, seen, now)
+	}
+	return merged
+}
+
+// removeNegative returns the multihashes that are not in the negative cache.
+func (c *cascader) removeNegative(mhs []multihash.Multihash, now time.Time) []multihash.Multihash {
+	c.negMutex.Lock()
+	defer c.negMutex.Unlock()
+
+	var remaining []multihash.Multihash
+	for _, mh := range mhs {
+		expires, ok := c.negCache[string(mh)]
+		if ok {
+			if now.Before(expires) {
+				continue
+			}
+			delete(c.negCache, string(mh))
+		}
+		remaining = append(remaining, mh)
+	}
+	return remaining
+}
+
+// addNegative adds the multihashes that no upstream returned to the negative
+// cache.  If the cache is full, expired entries are removed, and if it is
+// still full, the cache is cleared.
+func (c *cascader) addNegative(mhs []multihash.Multihash, found map[string]map[provCtx]struct{}, now time.Time) {
+	c.negMutex.Lock()
+	defer c.negMutex.Unlock()
+
+	expires := now.Add(c.negativeTTL)
+	for _, mh := range mhs {
+		if _, ok := found[string(mh)]; ok {
+			continue
+		}
+		if len(c.negCache) >= maxNegativeCacheSize {
+			for k, exp := range c.negCache {
+				if !now.Before(exp) {
+					delete(c.negCache, k)
+				}
+			}
+			if len(c.negCache) >= maxNegativeCacheSize {
+				c.negCache = map[string]time.Time{}
+			}
+		}
+		c.negCache[string(mh)] = expires
+	}
+}
+
+// matchProviderResult checks if a provider result from an upstream indexer is
+// selected by the filter.
+func matchProviderResult(pr *model.ProviderResult, filter *model.FindFilter) bool {
+	if filter.IsEmpty() {
+		return true
+	}
+	if !bytes.HasPrefix(pr.ContextID, filter.ContextIDPrefix) {
+		return false
+	}
+	if containsPeer(filter.ExcludeProviders, pr.Provider.ID) {
+		return false
+	}
+	if len(filter.Providers) != 0 && !containsPeer(filter.Providers, pr.Provider.ID) {
+		return false
+	}
+	return len(filter.Protocols) == 0 || containsProtocol(filter.Protocols, pr.Metadata)
+}
+
+func containsProtocol(protocols []multicodec.Code, metadata v0.Metadata) bool {
+	for _, proto := range protocols {
+		if metadata.ProtocolID == proto {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+// mockFinder is an upstream indexer that returns fixed results, and counts
+// the number of times it is queried.  Filters sent to it are recorded but not
+// applied.
+type mockFinder struct {
+	results map[string][]model.ProviderResult
+	block   bool
+
+	lock      sync.Mutex
+	queries   int
+	filter    model.FindFilter
+	noCascade bool
+}
+
+func (f *mockFinder) Find(ctx context.Context, mh multihash.Multihash) (*model.FindResponse, error) {
+	return f.FindBatch(ctx, []multihash.Multihash{mh})
+}
+
+func (f *mockFinder) FindBatch(ctx context.Context, mhs []multihash.Multihash) (*model.FindResponse, error) {
+	f.lock.Lock()
+	f.queries++
+	f.lock.Unlock()
+
+	if f.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	rsp := &model.FindResponse{}
+	for _, mh := range mhs {
+		if provResults, ok := f.results[string(mh)]; ok {
+			rsp.MultihashResults = append(rsp.MultihashResults, model.MultihashResult{
+				Multihash:       mh,
+				ProviderResults: provResults,
+			})
+		}
+	}
+	return rsp, nil
+}
+
+func (f *mockFinder) FindBatchRequest(ctx context.Context, req *model.FindRequest) (*model.FindResponse, error) {
+	f.lock.Lock()
+	f.filter = req.FindFilter
+	f.noCascade = req.NoCascade
+	f.lock.Unlock()
+	return f.FindBatch(ctx, req.Multihashes)
+}
+
+func (f *mockFinder) lastFilter() model.FindFilter {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.filter
+}
+
+func (f *mockFinder) lastNoCascade() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.noCascade
+}
+
+func (f *mockFinder) queryCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.queries
+}
+
+func TestCascade(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	provA := decodePeer(t, freshProviderID)
+	provB := decodePeer(t, failedProviderID)
+	metadata := v0.Metadata{ProtocolID: 0x300000, Data: []byte("data")}
+	mhs := util.RandomMultihashes(3)
+	local, upstreamOnly, missing := mhs[0], mhs[1], mhs[2]
+
+	// The local multihash is in this indexer.
+	metadataBytes, err := metadata.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memory.New()
+	err = store.Put(indexer.Value{
+		ProviderID:    provA,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: metadataBytes,
+	}, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both upstreams have a result from provider A for the upstream-only
+	// multihash, and the second also has one from provider B.
+	resultA := model.ProviderResult{
+		ContextID: []byte("ctx"),
+		Metadata:  metadata,
+		Provider:  peer.AddrInfo{ID: provA},
+	}
+	resultB := model.ProviderResult{
+		ContextID: []byte("ctx"),
+		Metadata:  metadata,
+		Provider:  peer.AddrInfo{ID: provB},
+	}
+	upstream1 := &mockFinder{
+		results: map[string][]model.ProviderResult{
+			string(upstreamOnly): {resultA},
+		},
+	}
+	upstream2 := &mockFinder{
+		results: map[string][]model.ProviderResult{
+			string(upstreamOnly): {resultA, resultB},
+		},
+	}
+	upstreams := []Upstream{
+		{Name: "upstream1", Finder: upstream1},
+		{Name: "upstream2", Finder: upstream2},
+	}
+
+	h := NewFinderHandler(store, reg, nil, config.Finder{}, nil, upstreams, nil)
+	resp, err := h.MakeFindResponse(&model.FindRequest{Multihashes: mhs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.MultihashResults) != 2 {
+		t.Fatalf("expected 2 multihash results, got %d", len(resp.MultihashResults))
+	}
+
+	// Local results are not marked, and local hits are not sent upstream.
+	if !bytes.Equal(resp.MultihashResults[0].Multihash, local) {
+		t.Fatal("expected first result for local multihash")
+	}
+	if resp.MultihashResults[0].ProviderResults[0].Upstream != "" {
+		t.Fatal("local result marked as upstream result")
+	}
+
+	// Upstream results are merged and deduplicated.
+	upResult := resp.MultihashResults[1]
+	if !bytes.Equal(upResult.Multihash, upstreamOnly) {
+		t.Fatal("expected second result for upstream multihash")
+	}
+	if len(upResult.ProviderResults) != 2 {
+		t.Fatalf("expected 2 upstream provider results, got %d", len(upResult.ProviderResults))
+	}
+	if upResult.ProviderResults[0].Provider.ID != provA || upResult.ProviderResults[0].Upstream != "upstream1" {
+		t.Fatalf("unexpected first upstream result: %+v", upResult.ProviderResults[0])
+	}
+	if upResult.ProviderResults[1].Provider.ID != provB || upResult.ProviderResults[1].Upstream != "upstream2" {
+		t.Fatalf("unexpected second upstream result: %+v", upResult.ProviderResults[1])
+	}
+
+	// Filters apply to upstream results.
+	resp, err = h.MakeFindResponse(&model.FindRequest{
+		Multihashes: []multihash.Multihash{upstreamOnly},
+		FindFilter:  model.FindFilter{ExcludeProviders: []peer.ID{provA}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.MultihashResults) != 1 || len(resp.MultihashResults[0].ProviderResults) != 1 {
+		t.Fatal("expected 1 filtered upstream result")
+	}
+	if resp.MultihashResults[0].ProviderResults[0].Provider.ID != provB {
+		t.Fatal("filtered upstream result has excluded provider")
+	}
+	// The filter is forwarded to upstreams.
+	filter := upstream2.lastFilter()
+	if len(filter.ExcludeProviders) != 1 || filter.ExcludeProviders[0] != provA {
+		t.Fatal("filter not sent to upstream")
+	}
+	if !upstream2.lastNoCascade() {
+		t.Fatal("request sent upstream not marked as forwarded")
+	}
+
+	// The multihash that no upstream has is in the negative cache, so
+	// upstreams are not asked again.
+	queries := upstream1.queryCount()
+	resp, err = h.MakeFindResponse(&model.FindRequest{Multihashes: []multihash.Multihash{missing}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.MultihashResults) != 0 {
+		t.Fatal("expected no results for missing multihash")
+	}
+	if upstream1.queryCount() != queries {
+		t.Fatal("upstream queried for multihash in negative cache")
+	}
+}
+
+func TestCascadeTimeout(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	mhs := util.RandomMultihashes(1)
+	provID := decodePeer(t, freshProviderID)
+	fast := &mockFinder{
+		results: map[string][]model.ProviderResult{
+			string(mhs[0]): {{
+				ContextID: []byte("ctx"),
+				Provider:  peer.AddrInfo{ID: provID},
+			}},
+		},
+	}
+	slow := &mockFinder{block: true}
+	upstreams := []Upstream{
+		{Name: "slow", Finder: slow},
+		{Name: "fast", Finder: fast},
+	}
+	cfg := config.Finder{
+		Cascade: config.Cascade{
+			Timeout: config.Duration(50 * time.Millisecond),
+		},
+	}
+
+	h := NewFinderHandler(memory.New(), reg, nil, cfg, nil, upstreams, nil)
+	start := time.Now()
+	resp, err := h.MakeFindResponse(&model.FindRequest{Multihashes: mhs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("slow upstream was not timed out")
+	}
+	if len(resp.MultihashResults) != 1 || resp.MultihashResults[0].ProviderResults[0].Upstream != "fast" {
+		t.Fatal("expected result from fast upstream")
+	}
+
+	// Since the slow upstream did not answer, nothing is put in the negative
+	// cache, and upstreams are asked again.
+	other := util.RandomMultihashes(1)
+	for i := 0; i < 2; i++ {
+		if _, err = h.MakeFindResponse(&model.FindRequest{Multihashes: other}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fast.queryCount() != 3 {
+		t.Fatalf("expected 3 queries to upstream, got %d", fast.queryCount())
+	}
+}
+
+// handlerFinder is an upstream that is another indexer's finder handler, and
+// counts the requests it answers.
+type handlerFinder struct {
+	h       *FinderHandler
+	lock    sync.Mutex
+	queries int
+}
+
+func (f *handlerFinder) Find(ctx context.Context, mh multihash.Multihash) (*model.FindResponse, error) {
+	return f.FindBatch(ctx, []multihash.Multihash{mh})
+}
+
+func (f *handlerFinder) FindBatch(ctx context.Context, mhs []multihash.Multihash) (*model.FindResponse, error) {
+	return f.FindBatchRequest(ctx, &model.FindRequest{Multihashes: mhs})
+}
+
+func (f *handlerFinder) FindBatchRequest(ctx context.Context, req *model.FindRequest) (*model.FindResponse, error) {
+	f.lock.Lock()
+	f.queries++
+	f.lock.Unlock()
+	return f.h.MakeFindResponse(req)
+}
+
+func (f *handlerFinder) queryCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.queries
+}
+
+func TestCascadeLoop(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	// Indexers A and B each have the other as their upstream.
+	toA := &handlerFinder{}
+	toB := &handlerFinder{}
+	cfg := config.Finder{
+		Cascade: config.Cascade{
+			Timeout: config.Duration(time.Second),
+		},
+	}
+	storeA := memory.New()
+	toA.h = NewFinderHandler(storeA, reg, nil, cfg, nil, []Upstream{{Name: "b", Finder: toB}}, nil)
+	toB.h = NewFinderHandler(memory.New(), reg, nil, cfg, nil, []Upstream{{Name: "a", Finder: toA}}, nil)
+
+	// A multihash that neither indexer has is asked for once upstream.
+	mhs := util.RandomMultihashes(2)
+	resp, err := toA.h.MakeFindResponse(&model.FindRequest{Multihashes: mhs[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.MultihashResults) != 0 {
+		t.Fatal("expected no results for missing multihash")
+	}
+	if toA.queryCount() != 0 || toB.queryCount() != 1 {
+		t.Fatalf("expected 0 queries to A and 1 to B, got %d and %d", toA.queryCount(), toB.queryCount())
+	}
+
+	// A multihash that only A has is found by B through A.
+	provID := decodePeer(t, freshProviderID)
+	err = storeA.Put(indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: []byte("data"),
+	}, mhs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = toB.h.MakeFindResponse(&model.FindRequest{Multihashes: mhs[1:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.MultihashResults) != 1 || resp.MultihashResults[0].ProviderResults[0].Upstream != "a" {
+		t.Fatal("expected result from upstream a")
+	}
+	if toA.queryCount() != 1 || toB.queryCount() != 1 {
+		t.Fatalf("expected 1 query to each indexer, got %d and %d", toA.queryCount(), toB.queryCount())
+	}
+}
@@ -1,79 +1,554 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/filecoin-project/go-indexer-core"
 	v0 "github.com/filecoin-project/storetheindex/api/v0"
 	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/cluster"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
 	"github.com/filecoin-project/storetheindex/internal/registry"
 	"github.com/filecoin-project/storetheindex/internal/syserr"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 )
 
+var log = logging.Logger("indexer/finder")
+
 // FinderHandler provides request handling functionality for the finder server
 // that is common to all protocols.
 type FinderHandler struct {
-	indexer  indexer.Interface
-	registry *registry.Registry
+	indexer   indexer.Interface
+	registry  *registry.Registry
+	provIndex *providerindex.Index
+
+	maxBatchSize       int
+	maxStreamBatchSize int
+	maxProviderResults int
+	ranker             *ranker
+	signKey            crypto.PrivKey
+	cascader           *cascader
+	cluster            *cluster.Cluster
+	unreachableAddrs   string
+}
+
+// providerData is the registry information about a provider that is used to
+// build provider results.  It is looked up once for each provider in a find
+// request.
+type providerData struct {
+	addrs      []multiaddr.Multiaddr
+	codecs     []multicodec.Code
+	score      float64
+	unverified bool
 }
 
-func NewFinderHandler(indexer indexer.Interface, registry *registry.Registry) *FinderHandler {
+// maxContextMultihashes is the maximum number of multihashes returned in one
+// page of a provider context listing.
+const maxContextMultihashes = 10000
+
+// NewFinderHandler creates a new FinderHandler.  If provIndex is nil, then
+// listing the content indexed for a provider is not available.  If signKey is
+// not nil, then find responses are signed with it.  Multihashes that are not
+// found are looked up in the upstream indexers, if any.  If clust is not nil,
+// then multihashes owned by other nodes of the cluster are looked up on those
+// nodes.
+func NewFinderHandler(indexer indexer.Interface, registry *registry.Registry, provIndex *providerindex.Index, cfg config.Finder, signKey crypto.PrivKey, upstreams []Upstream, clust *cluster.Cluster) *FinderHandler {
+	cfg = cfg.WithDefaults()
+	switch cfg.UnreachableAddrs {
+	case config.UnreachableAddrsKeep, config.UnreachableAddrsDeprioritize, config.UnreachableAddrsOmit:
+	default:
+		log.Warnw("Unknown UnreachableAddrs setting, returning addresses as registered", "setting", cfg.UnreachableAddrs)
+		cfg.UnreachableAddrs = config.UnreachableAddrsKeep
+	}
 	return &FinderHandler{
-		indexer:  indexer,
-		registry: registry,
+		indexer:   indexer,
+		registry:  registry,
+		provIndex: provIndex,
+
+		maxBatchSize:       cfg.MaxBatchSize,
+		maxStreamBatchSize: cfg.MaxStreamBatchSize,
+		maxProviderResults: cfg.MaxProviderResults,
+		ranker:             newRanker(cfg.Ranking),
+		signKey:            signKey,
+		cascader:           newCascader(upstreams, cfg.Cascade),
+		cluster:            clust,
+		unreachableAddrs:   cfg.UnreachableAddrs,
 	}
 }
 
+// MaxBatchSize returns the maximum number of multihashes allowed in a find
+// request.
+func (h *FinderHandler) MaxBatchSize() int {
+	return h.maxBatchSize
+}
+
+// MaxStreamBatchSize returns the maximum number of multihashes allowed in a
+// streaming find request.
+func (h *FinderHandler) MaxStreamBatchSize() int {
+	return h.maxStreamBatchSize
+}
+
+// CheckBatchSize returns an error if the number of multihashes in a find
+// request exceeds the maximum batch size.
+func (h *FinderHandler) CheckBatchSize(size int) error {
+	if size > h.maxBatchSize {
+		err := fmt.Errorf("batch of %d multihashes exceeds maximum batch size of %d", size, h.maxBatchSize)
+		return syserr.New(err, http.StatusRequestEntityTooLarge)
+	}
+	return nil
+}
+
 // MakeFindResponse reads from indexer core to populate a response from a list
-// of multihashes.
-func (h *FinderHandler) MakeFindResponse(mhashes []multihash.Multihash) (*model.FindResponse, error) {
+// of multihashes.  The response is signed if the handler has a signing key.
+func (h *FinderHandler) MakeFindResponse(req *model.FindRequest) (*model.FindResponse, error) {
+	return h.makeFindResponse(req, true)
+}
+
+// MakeClusterFindResponse is MakeFindResponse for a request from another node
+// of the cluster.  Upstream indexers are not queried, since the requesting
+// node queries them for the multihashes that no node has.
+func (h *FinderHandler) MakeClusterFindResponse(req *model.FindRequest) (*model.FindResponse, error) {
+	return h.makeFindResponse(req, false)
+}
+
+func (h *FinderHandler) makeFindResponse(req *model.FindRequest, cascade bool) (*model.FindResponse, error) {
+	results, err := h.findResults(req, cascade)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &model.FindResponse{
+		MultihashResults: results,
+	}
+	if h.signKey != nil {
+		if err = rsp.Sign(h.signKey); err != nil {
+			return nil, syserr.New(fmt.Errorf("cannot sign find response: %s", err), http.StatusInternalServerError)
+		}
+	}
+	return rsp, nil
+}
+
+// MakeFindResults reads from indexer core to get the results for a list of
+// multihashes, without making a signed response.
+func (h *FinderHandler) MakeFindResults(req *model.FindRequest) ([]model.MultihashResult, error) {
+	return h.findResults(req, true)
+}
+
+// findResults gets the results for a list of multihashes.  If cascade is true,
+// then upstream indexers are queried for the multihashes that are not found
+// locally or on other cluster nodes.  Requests that were forwarded by another
+// indexer are never cascaded.
+func (h *FinderHandler) findResults(req *model.FindRequest, cascade bool) ([]model.MultihashResult, error) {
+	cascade = cascade && !req.NoCascade
+	mhashes := req.Multihashes
+	if err := h.CheckBatchSize(len(mhashes)); err != nil {
+		return nil, err
+	}
+	if len(req.Cursors) != 0 && len(req.Cursors) != len(mhashes) {
+		return nil, syserr.New(errors.New("number of cursors does not match number of multihashes"), http.StatusBadRequest)
+	}
+
 	results := make([]model.MultihashResult, 0, len(mhashes))
-	provAddrs := map[peer.ID][]multiaddr.Multiaddr{}
+	provData := map[peer.ID]*providerData{}
+	var missing []multihash.Multihash
+	var remoteReq *model.FindRequest
 
 	for i := range mhashes {
-		values, found, err := h.indexer.Get(mhashes[i])
+		var cursor string
+		if len(req.Cursors) != 0 {
+			cursor = req.Cursors[i]
+		}
+		// An identity multihash holds its content, so return that instead of
+		// looking for providers.
+		if data, ok := model.InlineData(mhashes[i]); ok {
+			results = append(results, model.MultihashResult{
+				Multihash: mhashes[i],
+				Data:      data,
+			})
+			continue
+		}
+		// Collect the multihashes owned by other cluster nodes, to find on
+		// those nodes.
+		if h.cluster != nil && !h.cluster.IsLocal(mhashes[i]) {
+			if remoteReq == nil {
+				remoteReq = &model.FindRequest{FindFilter: req.FindFilter}
+			}
+			remoteReq.Multihashes = append(remoteReq.Multihashes, mhashes[i])
+			if len(req.Cursors) != 0 {
+				remoteReq.Cursors = append(remoteReq.Cursors, cursor)
+			}
+			continue
+		}
+		result, err := h.findMultihash(mhashes[i], cursor, &req.FindFilter, provData)
 		if err != nil {
-			return nil, syserr.New(fmt.Errorf("failed to query %q: %s", mhashes[i], err), 500)
+			return nil, err
 		}
-		if !found {
+		if result == nil {
+			// Upstream indexers do not continue from local cursors, so only
+			// look for multihashes upstream when starting from the first
+			// result.
+			if cursor == "" {
+				missing = append(missing, mhashes[i])
+			}
 			continue
 		}
 
-		provResults := make([]model.ProviderResult, len(values))
-		for j := range values {
-			provID := values[j].ProviderID
-			// Lookup provider info for each unique provider, look in local map
-			// before going to registry.
-			addrs, ok := provAddrs[provID]
-			if !ok {
-				pinfo := h.registry.ProviderInfo(provID)
-				if pinfo != nil {
-					addrs = pinfo.AddrInfo.Addrs
-					provAddrs[provID] = addrs
+		// Add the result to the list of index results.
+		results = append(results, *result)
+	}
+
+	if remoteReq != nil {
+		remoteResults := h.cluster.Find(remoteReq)
+		results = append(results, remoteResults...)
+
+		// Other nodes do not query upstream indexers, so look upstream for
+		// the multihashes they did not find.
+		if cascade && h.cascader != nil {
+			found := make(map[string]struct{}, len(remoteResults))
+			for i := range remoteResults {
+				found[string(remoteResults[i].Multihash)] = struct{}{}
+			}
+			for i, mh := range remoteReq.Multihashes {
+				if len(remoteReq.Cursors) != 0 && remoteReq.Cursors[i] != "" {
+					continue
+				}
+				if _, ok := found[string(mh)]; !ok {
+					missing = append(missing, mh)
 				}
 			}
+		}
+	}
 
-			provResults[j], err = providerResultFromValue(values[j], addrs)
-			if err != nil {
-				return nil, err
+	if cascade && h.cascader != nil && len(missing) != 0 {
+		upstreamResults := h.cascader.find(missing, &req.FindFilter, h.maxProviderResults)
+		for _, mh := range missing {
+			provResults := upstreamResults[string(mh)]
+			if len(provResults) == 0 {
+				continue
 			}
+			results = append(results, model.MultihashResult{
+				Multihash:       mh,
+				ProviderResults: provResults,
+			})
 		}
+	}
 
-		// Add the result to the list of index results.
-		results = append(results, model.MultihashResult{
-			Multihash:       mhashes[i],
-			ProviderResults: provResults,
+	return results, nil
+}
+
+// findMultihash gets the provider results, selected by filter, for a single
+// multihash, starting at the position given by cursor.  If ranking is enabled,
+// the results are ordered by provider score.  Returns nil if the multihash is
+// not found.
+func (h *FinderHandler) findMultihash(mh multihash.Multihash, cursor string, filter *model.FindFilter, provData map[peer.ID]*providerData) (*model.MultihashResult, error) {
+	start, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, syserr.New(err, http.StatusBadRequest)
+	}
+
+	values, found, err := h.indexer.Get(mh)
+	if err != nil {
+		return nil, syserr.New(fmt.Errorf("failed to query %q: %s", mh, err), 500)
+	}
+	if !found {
+		return nil, nil
+	}
+	values = filterValues(values, filter)
+	now := time.Now()
+	values = h.skipUnverified(values, provData, now)
+	if len(filter.Codecs) != 0 {
+		values = filterCodecs(values, filter.Codecs, func(provID peer.ID) []multicodec.Code {
+			return h.providerData(provID, provData, now).codecs
+		})
+	}
+	if start >= len(values) {
+		return nil, nil
+	}
+	if h.ranker != nil {
+		values = rankValues(values, func(provID peer.ID) float64 {
+			return h.providerData(provID, provData, now).score
 		})
 	}
 
-	return &model.FindResponse{
-		MultihashResults: results,
+	var nextCursor string
+	values = values[start:]
+	if len(values) > h.maxProviderResults {
+		values = values[:h.maxProviderResults]
+		nextCursor = encodeCursor(start + len(values))
+	}
+
+	provResults := make([]model.ProviderResult, len(values))
+	for j := range values {
+		pd := h.providerData(values[j].ProviderID, provData, now)
+		provResults[j], err = providerResultFromValue(values[j], pd.addrs)
+		if err != nil {
+			return nil, err
+		}
+		if h.ranker != nil {
+			provResults[j].Score = pd.score
+		}
+	}
+
+	return &model.MultihashResult{
+		Multihash:       mh,
+		ProviderResults: provResults,
+		Cursor:          nextCursor,
+	}, nil
+}
+
+// FindProviders returns the unique providers of a multihash, with the
+// addresses given in find results.  All pages of results are read.  Upstream
+// indexers are not queried.
+func (h *FinderHandler) FindProviders(mh multihash.Multihash) ([]peer.AddrInfo, error) {
+	req := &model.FindRequest{
+		Multihashes: []multihash.Multihash{mh},
+	}
+	seen := map[peer.ID]struct{}{}
+	var provs []peer.AddrInfo
+	for {
+		results, err := h.findResults(req, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			return provs, nil
+		}
+		for _, pr := range results[0].ProviderResults {
+			if _, ok := seen[pr.Provider.ID]; ok {
+				continue
+			}
+			seen[pr.Provider.ID] = struct{}{}
+			provs = append(provs, pr.Provider)
+		}
+		if results[0].Cursor == "" {
+			return provs, nil
+		}
+		req.Cursors = []string{results[0].Cursor}
+	}
+}
+
+// MakeRoutingProvidersResponse finds the providers of a multihash, and returns
+// a delegated routing record for each unique provider and transport.  Returns
+// nil if there are no providers.
+func (h *FinderHandler) MakeRoutingProvidersResponse(mh multihash.Multihash) (*model.RoutingProvidersResponse, error) {
+	results, err := h.MakeFindResults(&model.FindRequest{
+		Multihashes: []multihash.Multihash{mh},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0].ProviderResults) == 0 {
+		return nil, nil
+	}
+
+	type provProto struct {
+		id    peer.ID
+		proto string
+	}
+	seen := map[provProto]struct{}{}
+	var records []model.RoutingProviderRecord
+	for _, pr := range results[0].ProviderResults {
+		protocol, schema := model.RoutingTransport(pr.Metadata.ProtocolID)
+		key := provProto{pr.Provider.ID, protocol}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		addrs := make([]string, len(pr.Provider.Addrs))
+		for i := range pr.Provider.Addrs {
+			addrs[i] = pr.Provider.Addrs[i].String()
+		}
+		records = append(records, model.RoutingProviderRecord{
+			Protocol: protocol,
+			Schema:   schema,
+			ID:       pr.Provider.ID,
+			Addrs:    addrs,
+		})
+	}
+
+	return &model.RoutingProvidersResponse{
+		Providers: records,
+	}, nil
+}
+
+// skipUnverified removes the values of providers whose discovery address
+// belongs to a different peer, since their content cannot be trusted.
+func (h *FinderHandler) skipUnverified(values []indexer.Value, provData map[peer.ID]*providerData, now time.Time) []indexer.Value {
+	var filtered []indexer.Value
+	for i := range values {
+		if h.providerData(values[i].ProviderID, provData, now).unverified {
+			if filtered == nil {
+				filtered = append(make([]indexer.Value, 0, len(values)-1), values[:i]...)
+			}
+			continue
+		}
+		if filtered != nil {
+			filtered = append(filtered, values[i])
+		}
+	}
+	if filtered == nil {
+		return values
+	}
+	return filtered
+}
+
+// providerData gets the registry information for a provider.  Look in the
+// local map before going to the registry, so that each unique provider is
+// only looked up once.
+func (h *FinderHandler) providerData(provID peer.ID, provData map[peer.ID]*providerData, now time.Time) *providerData {
+	pd, ok := provData[provID]
+	if ok {
+		return pd
+	}
+	pd = new(providerData)
+	pinfo := h.registry.ProviderInfo(provID)
+	if pinfo != nil {
+		pd.addrs = h.providerAddrs(pinfo)
+		pd.codecs = pinfo.Codecs
+		pd.unverified = pinfo.Unverified
+	}
+	if h.ranker != nil {
+		pd.score = h.ranker.score(provID, pinfo, now)
+	}
+	provData[provID] = pd
+	return pd
+}
+
+// providerAddrs returns the provider's addresses to put in provider results.
+// Unless configured to keep them as registered, reachable addresses are
+// ordered by connection time, followed by addresses that have not been probed,
+// and then unreachable addresses if they are not omitted.
+func (h *FinderHandler) providerAddrs(pinfo *registry.ProviderInfo) []multiaddr.Multiaddr {
+	addrs := pinfo.AddrInfo.Addrs
+	if h.unreachableAddrs == config.UnreachableAddrsKeep {
+		return addrs
+	}
+
+	type probedAddr struct {
+		addr   multiaddr.Multiaddr
+		status registry.AddrStatus
+		probed bool
+	}
+	probed := make([]probedAddr, 0, len(addrs))
+	var anyProbed bool
+	for _, addr := range addrs {
+		status, ok := pinfo.AddrStatus(addr)
+		if ok && !status.Reachable && h.unreachableAddrs == config.UnreachableAddrsOmit {
+			continue
+		}
+		anyProbed = anyProbed || ok
+		probed = append(probed, probedAddr{addr, status, ok})
+	}
+	if !anyProbed && len(probed) == len(addrs) {
+		return addrs
+	}
+
+	rank := func(pa probedAddr) int {
+		switch {
+		case !pa.probed:
+			return 1
+		case pa.status.Reachable:
+			return 0
+		}
+		return 2
+	}
+	sort.SliceStable(probed, func(i, j int) bool {
+		ri, rj := rank(probed[i]), rank(probed[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return ri == 0 && probed[i].status.RTT < probed[j].status.RTT
+	})
+	ordered := make([]multiaddr.Multiaddr, len(probed))
+	for i := range probed {
+		ordered[i] = probed[i].addr
+	}
+	return ordered
+}
+
+// MakeProviderContextsResponse lists the contexts indexed for a provider.
+func (h *FinderHandler) MakeProviderContextsResponse(providerID peer.ID) (*model.ProviderContextsResponse, error) {
+	if h.provIndex == nil {
+		return nil, syserr.New(errors.New("provider content listing not available"), http.StatusNotImplemented)
+	}
+
+	infos, err := h.provIndex.Contexts(providerID)
+	if err != nil {
+		return nil, syserr.New(fmt.Errorf("cannot read provider contexts: %s", err), http.StatusInternalServerError)
+	}
+
+	contexts := make([]model.ContextResult, len(infos))
+	for i := range infos {
+		var metadata v0.Metadata
+		err = metadata.UnmarshalBinary(infos[i].MetadataBytes)
+		if err != nil {
+			log.Errorw("Cannot decode metadata for provider context", "provider", providerID, "err", err)
+		}
+		contexts[i] = model.ContextResult{
+			ContextID:      infos[i].ContextID,
+			Metadata:       metadata,
+			MultihashCount: infos[i].Count,
+		}
+	}
+
+	return &model.ProviderContextsResponse{
+		Provider: providerID,
+		Contexts: contexts,
 	}, nil
 }
 
+// MakeContextMultihashesResponse lists one page of the multihashes indexed
+// for a provider context, starting at offset.  A limit of 0, or greater than
+// the maximum page size, returns a page of maximum size.  Returns nil if the
+// context is not indexed for the provider.
+func (h *FinderHandler) MakeContextMultihashesResponse(providerID peer.ID, contextID []byte, offset, limit int) (*model.ContextMultihashesResponse, error) {
+	if h.provIndex == nil {
+		return nil, syserr.New(errors.New("provider content listing not available"), http.StatusNotImplemented)
+	}
+	if offset < 0 || limit < 0 {
+		return nil, syserr.New(errors.New("offset and limit must not be negative"), http.StatusBadRequest)
+	}
+	if limit == 0 || limit > maxContextMultihashes {
+		limit = maxContextMultihashes
+	}
+
+	info, err := h.provIndex.Context(providerID, contextID)
+	if err != nil {
+		return nil, syserr.New(fmt.Errorf("cannot read provider context: %s", err), http.StatusInternalServerError)
+	}
+	if info == nil {
+		return nil, nil
+	}
+
+	mhs, err := h.provIndex.Multihashes(providerID, contextID, offset, limit)
+	if err != nil {
+		return nil, syserr.New(fmt.Errorf("cannot read context multihashes: %s", err), http.StatusInternalServerError)
+	}
+
+	rsp := &model.ContextMultihashesResponse{
+		Provider:    providerID,
+		ContextID:   contextID,
+		Multihashes: mhs,
+	}
+	if uint64(offset+len(mhs)) < info.Count {
+		rsp.NextOffset = offset + len(mhs)
+	}
+	return rsp, nil
+}
+
 func providerResultFromValue(value indexer.Value, addrs []multiaddr.Multiaddr) (model.ProviderResult, error) {
 	var metadata v0.Metadata
 	err := metadata.UnmarshalBinary(value.MetadataBytes)
@@ -90,3 +565,97 @@ func providerResultFromValue(value indexer.Value, addrs []multiaddr.Multiaddr) (
 		},
 	}, nil
 }
+
+// filterValues returns the values that are selected by the filter.  The
+// original values are not modified, since they may be shared with the cache.
+func filterValues(values []indexer.Value, filter *model.FindFilter) []indexer.Value {
+	if filter.IsEmpty() {
+		return values
+	}
+	filtered := make([]indexer.Value, 0, len(values))
+	for i := range values {
+		if matchFilter(values[i], filter) {
+			filtered = append(filtered, values[i])
+		}
+	}
+	return filtered
+}
+
+func matchFilter(value indexer.Value, filter *model.FindFilter) bool {
+	if !bytes.HasPrefix(value.ContextID, filter.ContextIDPrefix) {
+		return false
+	}
+	if containsPeer(filter.ExcludeProviders, value.ProviderID) {
+		return false
+	}
+	if len(filter.Providers) != 0 && !containsPeer(filter.Providers, value.ProviderID) {
+		return false
+	}
+	if len(filter.Protocols) != 0 {
+		var metadata v0.Metadata
+		if err := metadata.UnmarshalBinary(value.MetadataBytes); err != nil {
+			return false
+		}
+		if !containsProtocol(filter.Protocols, metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterCodecs returns the values from providers that serve one of the codecs.
+// Values from providers that have not advertised their codecs are kept.
+func filterCodecs(values []indexer.Value, codecs []multicodec.Code, codecsOf func(peer.ID) []multicodec.Code) []indexer.Value {
+	filtered := make([]indexer.Value, 0, len(values))
+	for i := range values {
+		provCodecs := codecsOf(values[i].ProviderID)
+		if len(provCodecs) == 0 || containsCodec(provCodecs, codecs) {
+			filtered = append(filtered, values[i])
+		}
+	}
+	return filtered
+}
+
+// containsCodec returns true if any of the codecs is in have.
+func containsCodec(have, codecs []multicodec.Code) bool {
+	for _, c := range codecs {
+		for _, h := range have {
+			if c == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsPeer(peers []peer.ID, id peer.ID) bool {
+	for i := range peers {
+		if peers[i] == id {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCursor encodes the position of the next provider result to read as an
+// opaque cursor string.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor decodes a cursor string into the position of the next provider
+// result to read.  An empty cursor starts at the first result.
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
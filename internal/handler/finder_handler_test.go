@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/libp2p/go-libp2p-core/peer"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestUnreachableAddrs(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	provID := decodePeer(t, freshProviderID)
+	unprobed := multiaddr.StringCast("/ip4/127.0.0.1/tcp/9001")
+	dead := multiaddr.StringCast("/ip4/127.0.0.1/tcp/9002")
+	slow := multiaddr.StringCast("/ip4/127.0.0.1/tcp/9003")
+	fast := multiaddr.StringCast("/ip4/127.0.0.1/tcp/9004")
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provID,
+			Addrs: []multiaddr.Multiaddr{unprobed, dead, slow, fast},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	reg.RecordAddrStatus(provID, []registry.AddrStatus{
+		{Addr: dead, Probed: now, Error: "connection refused"},
+		{Addr: slow, Probed: now, Reachable: true, RTT: 200 * time.Millisecond},
+		{Addr: fast, Probed: now, Reachable: true, RTT: 10 * time.Millisecond},
+	})
+
+	metadata, err := v0.Metadata{ProtocolID: 0x300000, Data: []byte("data")}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mhs := util.RandomMultihashes(1)
+	store := memory.New()
+	value := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: metadata,
+	}
+	if err = store.Put(value, mhs...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting  string
+		expected []multiaddr.Multiaddr
+	}{
+		{config.UnreachableAddrsKeep, []multiaddr.Multiaddr{unprobed, dead, slow, fast}},
+		{config.UnreachableAddrsDeprioritize, []multiaddr.Multiaddr{fast, slow, unprobed, dead}},
+		{config.UnreachableAddrsOmit, []multiaddr.Multiaddr{fast, slow, unprobed}},
+	}
+	for _, test := range tests {
+		h := NewFinderHandler(store, reg, nil, config.Finder{UnreachableAddrs: test.setting}, nil, nil, nil)
+		resp, err := h.MakeFindResponse(&model.FindRequest{Multihashes: []multihash.Multihash{mhs[0]}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs := resp.MultihashResults[0].ProviderResults[0].Provider.Addrs
+		if len(addrs) != len(test.expected) {
+			t.Fatalf("%q: expected %d addresses, got %d", test.setting, len(test.expected), len(addrs))
+		}
+		for i := range addrs {
+			if !addrs[i].Equal(test.expected[i]) {
+				t.Fatalf("%q: expected address %d to be %s, got %s", test.setting, i, test.expected[i], addrs[i])
+			}
+		}
+	}
+
+	// Probe results are kept when the provider is registered again.
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provID,
+			Addrs: []multiaddr.Multiaddr{unprobed, dead, slow, fast},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reg.ProviderInfo(provID).AddrStatus(fast); !ok {
+		t.Fatal("address status lost when provider registered again")
+	}
+}
+
+func TestSkipUnverified(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	verifiedID := decodePeer(t, freshProviderID)
+	unverifiedID := decodePeer(t, failedProviderID)
+	maddr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/9001")
+	for _, provID := range []peer.ID{verifiedID, unverifiedID} {
+		err = reg.Replicate(&registry.ProviderInfo{
+			AddrInfo: peer.AddrInfo{
+				ID:    provID,
+				Addrs: []multiaddr.Multiaddr{maddr},
+			},
+			Unverified: provID == unverifiedID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mhs := util.RandomMultihashes(1)
+	store := memory.New()
+	for _, provID := range []peer.ID{unverifiedID, verifiedID} {
+		value := indexer.Value{
+			ProviderID:    provID,
+			ContextID:     []byte("ctx"),
+			MetadataBytes: []byte("metadata"),
+		}
+		if err = store.Put(value, mhs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewFinderHandler(store, reg, nil, config.Finder{}, nil, nil, nil)
+	resp, err := h.MakeFindResponse(&model.FindRequest{Multihashes: mhs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provResults := resp.MultihashResults[0].ProviderResults
+	if len(provResults) != 1 || provResults[0].Provider.ID != verifiedID {
+		t.Fatal("expected only results from verified provider:", provResults)
+	}
+}
+
+func TestFindProviders(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	provIDs := []peer.ID{decodePeer(t, freshProviderID), decodePeer(t, preferredProviderID)}
+	maddr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/9001")
+	mhs := util.RandomMultihashes(1)
+	store := memory.New()
+	for _, provID := range provIDs {
+		err = reg.Register(&registry.ProviderInfo{
+			AddrInfo: peer.AddrInfo{
+				ID:    provID,
+				Addrs: []multiaddr.Multiaddr{maddr},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Two values for each provider.
+		for _, ctxID := range []string{"ctx1", "ctx2"} {
+			value := indexer.Value{
+				ProviderID:    provID,
+				ContextID:     []byte(ctxID),
+				MetadataBytes: []byte("metadata"),
+			}
+			if err = store.Put(value, mhs...); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Providers are found from all pages of results.
+	h := NewFinderHandler(store, reg, nil, config.Finder{MaxProviderResults: 1}, nil, nil, nil)
+	provs, err := h.FindProviders(mhs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(provs))
+	}
+	for _, prov := range provs {
+		if len(prov.Addrs) != 1 || !prov.Addrs[0].Equal(maddr) {
+			t.Fatal("wrong provider addresses:", prov.Addrs)
+		}
+	}
+}
+
+// BenchmarkMakeFindResponse measures find throughput, with and without other
+// providers being registered at the same time.  Each find looks up the
+// registry information of several providers.
+func BenchmarkMakeFindResponse(b *testing.B) {
+	const providerCount = 10
+	for _, registering := range []bool{false, true} {
+		b.Run(fmt.Sprint("registering=", registering), func(b *testing.B) {
+			benchmarkMakeFindResponse(b, providerCount, registering)
+		})
+	}
+}
+
+func benchmarkMakeFindResponse(b *testing.B, providerCount int, registering bool) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer reg.Close()
+
+	maddr, err := multiaddr.NewMultiaddr(providerAddr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	metadata, err := v0.Metadata{ProtocolID: 0x300000, Data: []byte("data")}.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	mhs := util.RandomMultihashes(1)
+	store := memory.New()
+	for i := 0; i < providerCount; i++ {
+		provID, err := p2ptest.RandPeerID()
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = reg.Register(&registry.ProviderInfo{
+			AddrInfo: peer.AddrInfo{
+				ID:    provID,
+				Addrs: []multiaddr.Multiaddr{maddr},
+			},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		value := indexer.Value{
+			ProviderID:    provID,
+			ContextID:     []byte("ctx"),
+			MetadataBytes: metadata,
+		}
+		if err = store.Put(value, mhs...); err != nil {
+			b.Fatal(err)
+		}
+	}
+	h := NewFinderHandler(store, reg, nil, config.Finder{}, nil, nil, nil)
+	req := &model.FindRequest{Multihashes: []multihash.Multihash{mhs[0]}}
+
+	var stop int32
+	done := make(chan struct{})
+	if registering {
+		go func() {
+			defer close(done)
+			for atomic.LoadInt32(&stop) == 0 {
+				provID, err := p2ptest.RandPeerID()
+				if err != nil {
+					panic(err)
+				}
+				err = reg.Register(&registry.ProviderInfo{
+					AddrInfo: peer.AddrInfo{
+						ID:    provID,
+						Addrs: []multiaddr.Multiaddr{maddr},
+					},
+				})
+				if err != nil {
+					panic(err)
+				}
+			}
+		}()
+	} else {
+		close(done)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := h.MakeFindResponse(req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(resp.MultihashResults[0].ProviderResults) != providerCount {
+				b.Fatal("wrong number of provider results")
+			}
+		}
+	})
+	b.StopTimer()
+	atomic.StoreInt32(&stop, 1)
+	<-done
+}
@@ -5,10 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/filecoin-project/go-indexer-core"
 	"github.com/filecoin-project/storetheindex/api/v0/ingest/model"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
 	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
 	"github.com/filecoin-project/storetheindex/internal/syserr"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -64,28 +67,47 @@ func (h *IngestHandler) RegisterProvider(data []byte) error {
 	return h.registry.Register(info)
 }
 
-func (h *IngestHandler) ListProviders() ([]byte, error) {
-	infos := h.registry.AllProviderInfo()
-
-	responses := make([]model.ProviderInfo, len(infos))
-	for i := range infos {
-		responses[i] = model.MakeProviderInfo(infos[i].AddrInfo, infos[i].LastAdvertisement, infos[i].LastAdvertisementTime)
-	}
-
-	return json.Marshal(responses)
-}
-
 func (h *IngestHandler) GetProvider(providerID peer.ID) ([]byte, error) {
 	info := h.registry.ProviderInfo(providerID)
 	if info == nil {
 		return nil, nil
 	}
 
-	rsp := model.MakeProviderInfo(info.AddrInfo, info.LastAdvertisement, info.LastAdvertisementTime)
+	rsp := makeProviderInfo(info)
 
 	return json.Marshal(&rsp)
 }
 
+// makeProviderInfo makes the API response from a registry ProviderInfo.
+func makeProviderInfo(info *registry.ProviderInfo) model.ProviderInfo {
+	pinfo := model.MakeProviderInfo(info.AddrInfo, info.LastAdvertisement, info.LastAdvertisementTime)
+	pinfo.DiscoveryAddr = info.DiscoveryAddr
+	pinfo.Type = discovery.TypeName(info.Type)
+	pinfo.Unverified = info.Unverified
+	if !info.FirstSeen.IsZero() {
+		pinfo.FirstSeen = info.FirstSeen.UTC().Format(time.RFC3339)
+	}
+	pinfo.AdCount = info.AdCount
+	pinfo.IndexCount = info.IndexCount
+	pinfo.LastSyncError = info.LastSyncError
+	pinfo.Protocols = info.Protocols
+	pinfo.Labels = info.Labels
+	for _, addr := range info.AddrInfo.Addrs {
+		status, ok := info.AddrStatus(addr)
+		if !ok {
+			continue
+		}
+		pinfo.AddrStatus = append(pinfo.AddrStatus, model.AddrStatus{
+			Addr:      addr.String(),
+			Reachable: status.Reachable,
+			RTTMillis: status.RTT.Milliseconds(),
+			Probed:    status.Probed.UTC().Format(time.RFC3339),
+			Error:     status.Error,
+		})
+	}
+	return pinfo
+}
+
 // IndexContent handles an IngestRequest
 //
 // Returning error is the same as return syserr.New(err, http.StatusBadRequest)
@@ -114,11 +136,12 @@ func (h *IngestHandler) IndexContent(data []byte) error {
 		ContextID:     ingReq.ContextID,
 		MetadataBytes: encMetadata,
 	}
-	err = h.indexer.Put(value, ingReq.Multihash)
+	count, err := providerindex.CountPut(h.indexer, value, ingReq.Multihash)
 	if err != nil {
 		err = fmt.Errorf("cannot index content: %s", err)
 		return syserr.New(err, http.StatusInternalServerError)
 	}
+	h.registry.RecordIndexed(ingReq.ProviderID, ingReq.Metadata.ProtocolID, count, false)
 
 	// TODO: update last update time for provider
 
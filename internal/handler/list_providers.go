@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/model"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
+	"github.com/filecoin-project/storetheindex/internal/syserr"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// maxListProviders is the largest page of providers returned for a paged list
+// providers request.
+const maxListProviders = 1000
+
+// listCursor is the position after the last provider of a page.  It holds the
+// sort key of that provider, so that the next page starts after it even if
+// providers are added or removed between requests.
+type listCursor struct {
+	Sort string  `json:"s"`
+	Key  int64   `json:"k,omitempty"`
+	ID   peer.ID `json:"id"`
+}
+
+type listItem struct {
+	info *registry.ProviderInfo
+	key  int64
+}
+
+// ListProviders returns the providers selected by the request, in the
+// requested order.  A paged request gets a model.ListProvidersResponse, and
+// any other request gets the list of providers.
+func (h *IngestHandler) ListProviders(req *model.ListProvidersRequest) ([]byte, error) {
+	sortBy, reverse := req.Sort, false
+	if strings.HasPrefix(sortBy, "-") {
+		sortBy, reverse = sortBy[1:], true
+	}
+	if sortBy == "" {
+		sortBy = model.SortByID
+	}
+	sortKey, err := listSortKey(sortBy)
+	if err != nil {
+		return nil, syserr.New(err, http.StatusBadRequest)
+	}
+	if req.Limit < 0 {
+		return nil, syserr.New(errors.New("limit must not be negative"), http.StatusBadRequest)
+	}
+
+	infos := h.registry.AllProviderInfo()
+	items := make([]listItem, 0, len(infos))
+	for _, info := range infos {
+		if listMatch(req, info) {
+			items = append(items, listItem{info, sortKey(info)})
+		}
+	}
+	less := func(a, b listItem) bool {
+		if reverse {
+			a, b = b, a
+		}
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return a.info.AddrInfo.ID < b.info.AddrInfo.ID
+	}
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+
+	if !req.Paged() {
+		responses := make([]model.ProviderInfo, len(items))
+		for i := range items {
+			responses[i] = makeProviderInfo(items[i].info)
+		}
+		return json.Marshal(responses)
+	}
+
+	if req.Cursor != "" {
+		cur, err := decodeListCursor(req.Cursor)
+		if err != nil || cur.Sort != req.Sort {
+			return nil, syserr.New(errors.New("invalid cursor"), http.StatusBadRequest)
+		}
+		after := listItem{
+			info: &registry.ProviderInfo{AddrInfo: peer.AddrInfo{ID: cur.ID}},
+			key:  cur.Key,
+		}
+		start := sort.Search(len(items), func(i int) bool { return less(after, items[i]) })
+		items = items[start:]
+	}
+
+	limit := req.Limit
+	if limit == 0 || limit > maxListProviders {
+		limit = maxListProviders
+	}
+	var rsp model.ListProvidersResponse
+	if len(items) > limit {
+		items = items[:limit]
+		last := items[limit-1]
+		rsp.Cursor = encodeListCursor(listCursor{
+			Sort: req.Sort,
+			Key:  last.key,
+			ID:   last.info.AddrInfo.ID,
+		})
+	}
+	rsp.Providers = make([]*model.ProviderInfo, len(items))
+	for i := range items {
+		pinfo := makeProviderInfo(items[i].info)
+		rsp.Providers[i] = &pinfo
+	}
+	return json.Marshal(&rsp)
+}
+
+// listSortKey returns the function that gets the sort key of a provider for
+// the sort order.  Providers with the same key are ordered by ID.
+func listSortKey(sortBy string) (func(*registry.ProviderInfo) int64, error) {
+	switch sortBy {
+	case model.SortByID:
+		return func(*registry.ProviderInfo) int64 { return 0 }, nil
+	case model.SortByLastAd:
+		return func(info *registry.ProviderInfo) int64 { return timeKey(info.LastAdvertisementTime) }, nil
+	case model.SortByFirstSeen:
+		return func(info *registry.ProviderInfo) int64 { return timeKey(info.FirstSeen) }, nil
+	case model.SortByAdCount:
+		return func(info *registry.ProviderInfo) int64 { return int64(info.AdCount) }, nil
+	case model.SortByIndexCount:
+		return func(info *registry.ProviderInfo) int64 { return int64(info.IndexCount) }, nil
+	}
+	return nil, fmt.Errorf("unknown sort order %q", sortBy)
+}
+
+func timeKey(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// listMatch checks that the provider is selected by the request's filters.
+func listMatch(req *model.ListProvidersRequest, info *registry.ProviderInfo) bool {
+	if !req.AdBefore.IsZero() && (info.LastAdvertisementTime.IsZero() || !info.LastAdvertisementTime.Before(req.AdBefore)) {
+		return false
+	}
+	if !req.AdAfter.IsZero() && !info.LastAdvertisementTime.After(req.AdAfter) {
+		return false
+	}
+	if req.Type != "" && req.Type != discovery.TypeName(info.Type) {
+		return false
+	}
+	if req.HasDiscoveryAddr != nil && *req.HasDiscoveryAddr != (info.DiscoveryAddr != "") {
+		return false
+	}
+	for k, v := range req.Labels {
+		value, ok := info.Labels[k]
+		if !ok || (v != "" && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeListCursor(cur listCursor) string {
+	data, _ := json.Marshal(&cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	var cur listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, err
+	}
+	err = json.Unmarshal(data, &cur)
+	return cur, err
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ranker scores providers using registry information, according to the
+// configured ranking policy.
+type ranker struct {
+	cfg         config.Ranking
+	preferred   map[peer.ID]int
+	totalWeight float64
+}
+
+// newRanker creates a ranker from the ranking policy.  Returns nil if ranking
+// is not enabled.
+func newRanker(cfg config.Ranking) *ranker {
+	if !cfg.Enabled {
+		return nil
+	}
+	preferred := make(map[peer.ID]int, len(cfg.Preferred))
+	for i, pref := range cfg.Preferred {
+		provID, err := peer.Decode(pref)
+		if err != nil {
+			log.Errorw("Ignoring bad preferred provider ID in ranking config", "id", pref, "err", err)
+			continue
+		}
+		if _, ok := preferred[provID]; !ok {
+			preferred[provID] = i
+		}
+	}
+	return &ranker{
+		cfg:         cfg,
+		preferred:   preferred,
+		totalWeight: cfg.FreshnessWeight + cfg.SyncWeight + cfg.ReachabilityWeight + cfg.PreferenceWeight,
+	}
+}
+
+// score returns a score from 0 to 1 for the provider.  The info is nil if the
+// provider is not registered.
+func (r *ranker) score(provID peer.ID, info *registry.ProviderInfo, now time.Time) float64 {
+	if r.totalWeight <= 0 {
+		return 0
+	}
+
+	var total float64
+	if i, ok := r.preferred[provID]; ok {
+		n := float64(len(r.cfg.Preferred))
+		total += r.cfg.PreferenceWeight * (n - float64(i)) / n
+	}
+	if info == nil {
+		return total / r.totalWeight
+	}
+
+	// Freshness halves every half-life since the last advertisement.
+	if !info.LastAdvertisementTime.IsZero() {
+		age := now.Sub(info.LastAdvertisementTime)
+		if age < 0 {
+			age = 0
+		}
+		halfLife := time.Duration(r.cfg.FreshnessHalfLife)
+		total += r.cfg.FreshnessWeight * math.Exp2(-float64(age)/float64(halfLife))
+	}
+
+	// A provider that has not been synced with scores between one whose last
+	// sync succeeded and one whose last sync failed.
+	syncTime, syncOK := info.LastSync()
+	if syncTime.IsZero() {
+		total += r.cfg.SyncWeight * 0.5
+	} else if syncOK {
+		total += r.cfg.SyncWeight
+	}
+
+	lastContact := info.LastContactTime()
+	if info.LastAdvertisementTime.After(lastContact) {
+		lastContact = info.LastAdvertisementTime
+	}
+	if !lastContact.IsZero() && now.Sub(lastContact) <= time.Duration(r.cfg.ReachableWithin) {
+		total += r.cfg.ReachabilityWeight
+	}
+
+	return total / r.totalWeight
+}
+
+// rankValues returns a copy of the values ordered by provider score, from
+// highest to lowest.  Values with the same score keep their stored order, so
+// that cursors remain valid as long as provider scores do not change.
+func rankValues(values []indexer.Value, scoreOf func(peer.ID) float64) []indexer.Value {
+	ranked := make([]indexer.Value, len(values))
+	copy(ranked, values)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scoreOf(ranked[i].ProviderID) > scoreOf(ranked[j].ProviderID)
+	})
+	return ranked
+}
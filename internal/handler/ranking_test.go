@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	freshProviderID     = "12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA"
+	failedProviderID    = "12D3KooWSG3JuvEjRkSxt93ADTjQxqe4ExbBwSkQ9Zyk1WfBaZJF"
+	preferredProviderID = "12D3KooWPw6bfQbJHfKa2o5XpusChoq67iZoqgfnhecygjKsQRmG"
+	providerAddr        = "/ip4/127.0.0.1/tcp/9999"
+)
+
+func TestRanking(t *testing.T) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Close()
+
+	freshID := decodePeer(t, freshProviderID)
+	failedID := decodePeer(t, failedProviderID)
+	preferredID := decodePeer(t, preferredProviderID)
+
+	// Fresh provider has a recent advertisement.
+	adCid, err := cid.Decode("bafybeigvgzoolc3drupxhlevdp2ugqcrbcsqfmcek2zxiw5wctk3xjpjwy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reg.RegisterOrUpdate(freshID, []string{providerAddr}, adCid); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed provider has no advertisement and its last sync failed.
+	maddr, err := multiaddr.NewMultiaddr(providerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    failedID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.RecordSync(failedID, errors.New("sync failed"))
+	// The registry records the sync asynchronously.
+	for i := 0; i < 100; i++ {
+		if syncTime, _ := reg.ProviderInfo(failedID).LastSync(); !syncTime.IsZero() {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Preferred provider is not registered.
+	cfg := config.Finder{
+		Ranking: config.Ranking{
+			Enabled:            true,
+			FreshnessWeight:    1,
+			SyncWeight:         1,
+			ReachabilityWeight: 1,
+			PreferenceWeight:   1,
+			Preferred:          []string{preferredProviderID},
+		},
+	}
+
+	metadata, err := v0.Metadata{ProtocolID: 0x300000, Data: []byte("data")}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mhs := util.RandomMultihashes(1)
+	store := memory.New()
+	for _, provID := range []peer.ID{failedID, preferredID, freshID} {
+		value := indexer.Value{
+			ProviderID:    provID,
+			ContextID:     []byte("ctx"),
+			MetadataBytes: metadata,
+		}
+		if err = store.Put(value, mhs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewFinderHandler(store, reg, nil, cfg, nil, nil, nil)
+	resp, err := h.MakeFindResponse(&model.FindRequest{Multihashes: []multihash.Multihash{mhs[0]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := resp.MultihashResults[0].ProviderResults
+	if len(results) != 3 {
+		t.Fatalf("expected 3 provider results, got %d", len(results))
+	}
+
+	expected := []struct {
+		id    peer.ID
+		score float64
+	}{
+		// Fresh, reachable and not yet synced.
+		{freshID, (1 + 1 + 0.5) / 4},
+		// Only preferred.
+		{preferredID, 1.0 / 4},
+		// Nothing in its favor.
+		{failedID, 0},
+	}
+	for i := range expected {
+		if results[i].Provider.ID != expected[i].id {
+			t.Fatalf("result %d is from provider %s, expected %s", i, results[i].Provider.ID, expected[i].id)
+		}
+		if math.Abs(results[i].Score-expected[i].score) > 0.01 {
+			t.Fatalf("result %d has score %f, expected %f", i, results[i].Score, expected[i].score)
+		}
+	}
+
+	// Disabled ranking returns results in stored order with no score.
+	h = NewFinderHandler(store, reg, nil, config.Finder{}, nil, nil, nil)
+	resp, err = h.MakeFindResponse(&model.FindRequest{Multihashes: []multihash.Multihash{mhs[0]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range resp.MultihashResults[0].ProviderResults {
+		if result.Score != 0 {
+			t.Fatal("expected no score when ranking is disabled")
+		}
+	}
+}
+
+func decodePeer(t *testing.T, id string) peer.ID {
+	provID, err := peer.Decode(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provID
+}
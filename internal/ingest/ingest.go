@@ -2,9 +2,10 @@ package ingest
 
 import (
 	"context"
+	"errors"
 	"time"
 
-	indexer "github.com/filecoin-project/go-indexer-core/engine"
+	indexer "github.com/filecoin-project/go-indexer-core"
 	coremetrics "github.com/filecoin-project/go-indexer-core/metrics"
 	"github.com/filecoin-project/go-legs"
 	"github.com/filecoin-project/storetheindex/config"
@@ -49,7 +50,8 @@ type legIngester struct {
 	host    host.Host
 	ds      datastore.Batching
 	lms     legs.LegMultiSubscriber
-	indexer *indexer.Engine
+	indexer indexer.Interface
+	reg     *registry.Registry
 
 	newClient func(context.Context, host.Host, peer.ID) (pclient.Provider, error)
 
@@ -70,7 +72,7 @@ type subscriber struct {
 
 // NewLegIngester creates a new go-legs-backed ingester.
 func NewLegIngester(ctx context.Context, cfg config.Ingest, h host.Host,
-	idxr *indexer.Engine, reg *registry.Registry, ds datastore.Batching) (LegIngester, error) {
+	idxr indexer.Interface, reg *registry.Registry, ds datastore.Batching) (LegIngester, error) {
 
 	lsys := mkLinkSystem(ds, reg)
 
@@ -100,6 +102,7 @@ func NewLegIngester(ctx context.Context, cfg config.Ingest, h host.Host,
 		host:      h,
 		ds:        ds,
 		indexer:   idxr,
+		reg:       reg,
 		newClient: newClient,
 		lms:       lms,
 		subs:      make(map[peer.ID]*subscriber),
@@ -153,6 +156,7 @@ func (li *legIngester) Sync(ctx context.Context, peerID peer.ID, opts ...SyncOpt
 	c, err := li.getLatestAdvID(ctx, peerID)
 	if err != nil {
 		log.Errorf("Error getting latest advertisement for sync: %s", err)
+		li.recordSync(peerID, err)
 		return nil, err
 	}
 
@@ -191,6 +195,7 @@ func (li *legIngester) Sync(ctx context.Context, peerID peer.ID, opts ...SyncOpt
 	if err != nil {
 		log.Errorf("Errored while syncing: %s", err)
 		cancel()
+		li.recordSync(peerID, err)
 		return nil, err
 	}
 	// Merge cancelfuncs
@@ -274,7 +279,17 @@ func (li *legIngester) listenSyncUpdate(peerID peer.ID, watcher <-chan cid.Cid,
 		out <- c.Hash()
 
 		stats.Record(context.Background(), metrics.SyncLatency.M(coremetrics.MsecSince(startTime)))
+		li.recordSync(peerID, nil)
 		li.sigUpdate <- struct{}{}
+	} else {
+		li.recordSync(peerID, errors.New("sync did not complete"))
+	}
+}
+
+// recordSync records the result of a sync in the registry, if there is one.
+func (li *legIngester) recordSync(peerID peer.ID, err error) {
+	if li.reg != nil {
+		li.reg.RecordSync(peerID, err)
 	}
 }
 
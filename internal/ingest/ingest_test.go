@@ -3,6 +3,7 @@ package ingest
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"runtime"
@@ -31,6 +32,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 )
@@ -181,13 +183,82 @@ func TestMultipleSubscriptions(t *testing.T) {
 
 }
 
+// BenchmarkProcessEntries measures the ingestion of entry chunks, with
+// thousands of other providers registered.  Ingesting each chunk records the
+// indexed content in the registry.
+func BenchmarkProcessEntries(b *testing.B) {
+	for _, providerCount := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprint("providers=", providerCount), func(b *testing.B) {
+			benchmarkProcessEntries(b, providerCount)
+		})
+	}
+}
+
+func benchmarkProcessEntries(b *testing.B, providerCount int) {
+	reg := mkRegistry(b)
+	defer reg.Close()
+	maddr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/9999")
+	for i := 0; i < providerCount; i++ {
+		_, pubKey, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+		require.NoError(b, err)
+		provID, err := peer.IDFromPublicKey(pubKey)
+		require.NoError(b, err)
+		err = reg.Register(&registry.ProviderInfo{
+			AddrInfo: peer.AddrInfo{
+				ID:    provID,
+				Addrs: []multiaddr.Multiaddr{maddr},
+			},
+		})
+		require.NoError(b, err)
+	}
+
+	// Only the parts of the ingester that process entries are needed.
+	store := dssync.MutexWrap(datastore.NewMapDatastore())
+	i := &legIngester{
+		ds:        store,
+		indexer:   mkIndexer(b, false),
+		reg:       reg,
+		batchSize: 256,
+	}
+
+	// Store an advertisement, for a registered provider, that links to a
+	// chunk of entries.
+	priv, pubKey, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(b, err)
+	provID, err := peer.IDFromPublicKey(pubKey)
+	require.NoError(b, err)
+	addrs := []string{maddr.String()}
+	require.NoError(b, reg.RegisterOrUpdate(provID, addrs, cid.Undef))
+	lsys := mkProvLinkSystem(store)
+	mhs := util.RandomMultihashes(100)
+	mhsLnk, chunk, err := schema.NewLinkedListOfMhs(lsys, mhs, nil)
+	require.NoError(b, err)
+	metadata := v0.Metadata{
+		ProtocolID: testProtocolID,
+		Data:       mhs[0],
+	}
+	_, adLnk, err := schema.NewAdvertisementWithLink(lsys, priv, nil, mhsLnk, []byte("test-context-id"), metadata, false, provID.String(), addrs)
+	require.NoError(b, err)
+	lnk, err := adLnk.AsLink()
+	require.NoError(b, err)
+	adCid := lnk.(cidlink.Link).Cid
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err = i.processEntries(adCid, provID, chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func mkTestHost() host.Host {
 	h, _ := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"))
 	return h
 }
 
 // Make new indexer engine
-func mkIndexer(t *testing.T, withCache bool) *engine.Engine {
+func mkIndexer(t testing.TB, withCache bool) *engine.Engine {
 	var tmpDir string
 	var err error
 	if runtime.GOOS == "windows" {
@@ -209,7 +280,7 @@ func mkIndexer(t *testing.T, withCache bool) *engine.Engine {
 	return engine.New(resultCache, valueStore)
 }
 
-func mkRegistry(t *testing.T) *registry.Registry {
+func mkRegistry(t testing.TB) *registry.Registry {
 	discoveryCfg := config.Discovery{
 		Policy: config.Policy{
 			Allow: true,
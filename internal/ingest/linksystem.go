@@ -9,6 +9,7 @@ import (
 	"github.com/filecoin-project/go-indexer-core"
 	v0 "github.com/filecoin-project/storetheindex/api/v0"
 	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
 	"github.com/filecoin-project/storetheindex/internal/registry"
 	"github.com/filecoin-project/storetheindex/internal/syserr"
 	"github.com/ipfs/go-cid"
@@ -19,6 +20,7 @@ import (
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 )
 
@@ -254,7 +256,8 @@ func (li *legIngester) processEntries(adCid cid.Cid, p peer.ID, nentries ipld.No
 	}
 
 	// Check for valid metadata
-	err = new(v0.Metadata).UnmarshalBinary(metadataBytes)
+	var metadata v0.Metadata
+	err = metadata.UnmarshalBinary(metadataBytes)
 	if err != nil {
 		log.Errorf("Error decoding metadata: %s", err)
 		return err
@@ -270,7 +273,7 @@ func (li *legIngester) processEntries(adCid cid.Cid, p peer.ID, nentries ipld.No
 	// TODO: Once we change the syncing process, there may never be a need
 	// to remove individual entries, and only a need remove all entries for
 	// the context ID in the advertisement.  For now, handle both cases.
-	errChan := li.batchIndexerEntries(mhChan, value, isRm)
+	errChan := li.batchIndexerEntries(mhChan, value, metadata.ProtocolID, isRm)
 
 	var count int
 	nchunk := nb.Build().(schema.EntryChunk)
@@ -302,7 +305,10 @@ func (li *legIngester) processEntries(adCid cid.Cid, p peer.ID, nentries ipld.No
 
 	// Handle remove in the case where there are no individual entries.
 	if isRm && count == 0 {
-		err = li.indexer.RemoveProviderContext(p, contextID)
+		removed, err := providerindex.CountRemoveProviderContext(li.indexer, p, contextID)
+		if li.reg != nil && removed != 0 {
+			li.reg.RecordIndexed(p, metadata.ProtocolID, removed, true)
+		}
 		if err != nil {
 			return err
 		}
@@ -332,17 +338,19 @@ func (li *legIngester) processEntries(adCid cid.Cid, p peer.ID, nentries ipld.No
 // one occurs during processing.  This also indicates the goroutine has exited
 // (and will no longer read its input channel).
 //
+// The number of multihashes that the indexer reports as newly put or removed
+// is recorded in the registry when the goroutine exits, including when there
+// is an error.  Multihashes that are put or removed again when the entries
+// are retried are then not counted again.
+//
 // The goroutine exits when the input channel is closed.  It closes the error
 // channel to indicate completion.
-func (li *legIngester) batchIndexerEntries(mhChan <-chan multihash.Multihash, value indexer.Value, isRm bool) <-chan error {
-	var indexFunc func(indexer.Value, ...multihash.Multihash) error
-	var opName string
+func (li *legIngester) batchIndexerEntries(mhChan <-chan multihash.Multihash, value indexer.Value, protocol multicodec.Code, isRm bool) <-chan error {
+	indexFunc := providerindex.CountPut
+	opName := "put"
 	if isRm {
-		indexFunc = li.indexer.Remove
+		indexFunc = providerindex.CountRemove
 		opName = "remove"
-	} else {
-		indexFunc = li.indexer.Put
-		opName = "put"
 	}
 
 	errChan := make(chan error, 1)
@@ -350,12 +358,19 @@ func (li *legIngester) batchIndexerEntries(mhChan <-chan multihash.Multihash, va
 	go func(batchSize int) {
 		defer close(errChan)
 		batch := make([]multihash.Multihash, 0, batchSize)
-		var count int
+		var count, indexed int
+		defer func() {
+			if li.reg != nil && indexed != 0 {
+				li.reg.RecordIndexed(value.ProviderID, protocol, indexed, isRm)
+			}
+		}()
 		for m := range mhChan {
 			batch = append(batch, m)
 			if len(batch) == batchSize {
 				// Process full batch of multihashes
-				if err := indexFunc(value, batch...); err != nil {
+				n, err := indexFunc(li.indexer, value, batch...)
+				indexed += n
+				if err != nil {
 					errChan <- err
 					log.Errorf("Cannot %s entries in indexer: %s", opName, err)
 					return
@@ -368,7 +383,9 @@ func (li *legIngester) batchIndexerEntries(mhChan <-chan multihash.Multihash, va
 
 		if len(batch) != 0 {
 			// Process any remaining puts
-			if err := indexFunc(value, batch...); err != nil {
+			n, err := indexFunc(li.indexer, value, batch...)
+			indexed += n
+			if err != nil {
 				errChan <- err
 				log.Errorf("Cannot %s entries in indexer: %s", opName, err)
 				return
@@ -377,7 +394,7 @@ func (li *legIngester) batchIndexerEntries(mhChan <-chan multihash.Multihash, va
 			log.Debugf("%s %d entries in value store", opName, len(batch))
 		}
 
-		log.Debugw("Processed entries", "count", count, "operation", opName)
+		log.Debugw("Processed entries", "count", count, "indexed", indexed, "operation", opName)
 	}(li.batchSize)
 
 	return errChan
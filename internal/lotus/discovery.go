@@ -5,21 +5,63 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
 	"github.com/filecoin-project/storetheindex/internal/syserr"
 	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multiaddr"
-	jrpc "github.com/ybbus/jsonrpc/v2"
 )
 
+var log = logging.Logger("indexer/lotus")
+
+// Discoverer looks up Filecoin miners using the JSON-RPC API of a lotus
+// gateway, or lotus node.  When a gateway cannot be reached, the next gateway
+// is tried.
 type Discoverer struct {
-	gatewayURL string
+	gateways []*gateway
+	// current is the index of the gateway that was last reached, which is
+	// tried first.
+	current int32
+
+	headMutex   sync.Mutex
+	head        []cid.Cid
+	headExpires time.Time
+	headFetch   *headFetch
+	headTTL     time.Duration
+}
+
+// Gateway is the address of a lotus API endpoint.
+type Gateway struct {
+	// URL is the http, https, ws, or wss URL of the JSON-RPC API.  Without a
+	// scheme, https is used.  Without a path, /rpc/v1 is used.
+	URL string
+	// Token, if not empty, is sent as a bearer token to authenticate with
+	// the API.
+	Token string
+}
+
+type gateway struct {
+	url    string
+	client rpcClient
 }
 
+// headFetch is a ChainHead call that concurrent discoveries wait for.
+type headFetch struct {
+	done chan struct{}
+	head []cid.Cid
+	err  error
+}
+
+// chainHeadTTL is how long the chain head is reused for.  This is shorter
+// than the 30 second Filecoin epoch.
+const chainHeadTTL = 15 * time.Second
+
 type ExpTipSet struct {
 	Cids []cid.Cid
 	//Blocks []*BlockHeader
@@ -42,17 +84,27 @@ type MinerInfo struct {
 	ConsensusFaultElapsed      int64
 }
 
-// New creates a new lotus Discoverer
-func NewDiscoverer(gateway string) (*Discoverer, error) {
-	u, err := url.Parse(gateway)
-	if err != nil {
-		return nil, err
+// NewDiscoverer creates a new lotus Discoverer that uses the gateways in the
+// order given.
+func NewDiscoverer(gateways ...Gateway) (*Discoverer, error) {
+	if len(gateways) == 0 {
+		return nil, errors.New("no lotus gateway")
+	}
+	gws := make([]*gateway, len(gateways))
+	for i, gw := range gateways {
+		u, err := gatewayURL(gw.URL)
+		if err != nil {
+			return nil, err
+		}
+		gws[i] = &gateway{
+			url:    u.String(),
+			client: newRPCClient(u, gw.Token),
+		}
 	}
-	u.Scheme = "https"
-	u.Path = "/rpc/v1"
 
 	return &Discoverer{
-		gatewayURL: u.String(),
+		gateways: gws,
+		headTTL:  chainHeadTTL,
 	}, nil
 }
 
@@ -63,25 +115,22 @@ func (d *Discoverer) Discover(ctx context.Context, peerID peer.ID, minerAddr str
 		return nil, fmt.Errorf("invalid provider filecoin address: %s", err)
 	}
 
-	jrpcClient := jrpc.NewClient("https://api.chain.love/rpc/v1")
-
-	var ets ExpTipSet
-	err = jrpcClient.CallFor(&ets, "Filecoin.ChainHead")
+	head, err := d.chainHead(ctx)
 	if err != nil {
-		return nil, syserr.New(err, http.StatusBadGateway)
+		return nil, err
 	}
 
 	var minerInfo MinerInfo
-	err = jrpcClient.CallFor(&minerInfo, "Filecoin.StateMinerInfo", minerAddress, ets.Cids)
+	err = d.call(ctx, &minerInfo, "Filecoin.StateMinerInfo", minerAddress, head)
 	if err != nil {
-		return nil, syserr.New(err, http.StatusBadGateway)
+		return nil, err
 	}
 
 	if minerInfo.PeerId == nil {
-		return nil, errors.New("no peer id for miner")
+		return nil, fmt.Errorf("no peer id for miner: %w", discovery.ErrProviderMismatch)
 	}
 	if *minerInfo.PeerId != peerID {
-		return nil, errors.New("provider id mismatch")
+		return nil, discovery.ErrProviderMismatch
 	}
 
 	// Get miner peer ID and addresses from miner info
@@ -96,6 +145,73 @@ func (d *Discoverer) Discover(ctx context.Context, peerID peer.ID, minerAddr str
 	}, nil
 }
 
+// call calls an API method, starting with the gateway that was last reached
+// and failing over to the others.  An error returned by the method is not
+// retried on other gateways.
+func (d *Discoverer) call(ctx context.Context, out interface{}, method string, params ...interface{}) error {
+	start := int(atomic.LoadInt32(&d.current))
+	var err error
+	for i := range d.gateways {
+		n := (start + i) % len(d.gateways)
+		gw := d.gateways[n]
+		err = gw.client.call(ctx, out, method, params...)
+		if err == nil {
+			atomic.StoreInt32(&d.current, int32(n))
+			return nil
+		}
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			return syserr.New(err, http.StatusBadGateway)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		log.Warnw("Cannot reach lotus gateway", "gateway", gw.url, "method", method, "err", err)
+	}
+	return syserr.New(fmt.Errorf("rpc call %s(): %s", method, err), http.StatusBadGateway)
+}
+
+// chainHead returns the tipset at the head of the chain.  The head is reused
+// for a short time, and concurrent discoveries share one ChainHead call.
+func (d *Discoverer) chainHead(ctx context.Context) ([]cid.Cid, error) {
+	d.headMutex.Lock()
+	if d.head != nil && time.Now().Before(d.headExpires) {
+		head := d.head
+		d.headMutex.Unlock()
+		return head, nil
+	}
+	fetch := d.headFetch
+	if fetch == nil {
+		fetch = &headFetch{
+			done: make(chan struct{}),
+		}
+		d.headFetch = fetch
+		d.headMutex.Unlock()
+
+		var ets ExpTipSet
+		fetch.err = d.call(ctx, &ets, "Filecoin.ChainHead")
+		fetch.head = ets.Cids
+
+		d.headMutex.Lock()
+		if fetch.err == nil {
+			d.head = fetch.head
+			d.headExpires = time.Now().Add(d.headTTL)
+		}
+		d.headFetch = nil
+		d.headMutex.Unlock()
+		close(fetch.done)
+		return fetch.head, fetch.err
+	}
+	d.headMutex.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.head, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (d *Discoverer) getMinerPeerAddr(minerInfo MinerInfo) (peer.AddrInfo, error) {
 	multiaddrs := make([]multiaddr.Multiaddr, 0, len(minerInfo.Multiaddrs))
 	for _, a := range minerInfo.Multiaddrs {
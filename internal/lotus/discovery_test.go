@@ -2,19 +2,65 @@ package lotus
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
+	lotustest "github.com/filecoin-project/storetheindex/internal/lotus/test"
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
 )
 
 const testMinerAddr = "t01000"
 
+func newTestServer(t *testing.T, token string) (*lotustest.Server, peer.AddrInfo) {
+	s := lotustest.NewServer(token)
+	t.Cleanup(s.Close)
+
+	peerID, err := peer.Decode("12D3KooWGuQafP1HDkE2ixXZnX6q6LLygsUG1uoxaQEtfPAt5ygp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	maddr, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/24001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := peer.AddrInfo{
+		ID:    peerID,
+		Addrs: []multiaddr.Multiaddr{maddr},
+	}
+	if err = s.AddMiner(testMinerAddr, info); err != nil {
+		t.Fatal(err)
+	}
+	return s, info
+}
+
+func checkDiscovered(t *testing.T, disco *Discoverer, info peer.AddrInfo) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	discovered, err := disco.Discover(ctx, info.ID, testMinerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discovered.AddrInfo.ID != info.ID {
+		t.Fatal("returned peer ID did not match requested")
+	}
+	if len(discovered.AddrInfo.Addrs) != 1 || !discovered.AddrInfo.Addrs[0].Equal(info.Addrs[0]) {
+		t.Fatalf("wrong miner addresses %v", discovered.AddrInfo.Addrs)
+	}
+	if discovered.Type != discovery.MinerType {
+		t.Fatal("wrong provider type")
+	}
+}
+
 func TestDiscoverer(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	gateway := "api.chain.love"
-	disco, err := NewDiscoverer(gateway)
+	s, info := newTestServer(t, "")
+	disco, err := NewDiscoverer(Gateway{URL: s.URL})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -25,19 +71,156 @@ func TestDiscoverer(t *testing.T) {
 		t.Fatal("expected provider id mismatch error")
 	}
 
-	peerID, err = peer.Decode("12D3KooWGuQafP1HDkE2ixXZnX6q6LLygsUG1uoxaQEtfPAt5ygp")
+	checkDiscovered(t, disco, info)
+
+	if _, err = disco.Discover(ctx, info.ID, "t09999"); err == nil {
+		t.Fatal("expected error for unknown miner")
+	}
+	if _, err = disco.Discover(ctx, info.ID, "not-an-address"); err == nil {
+		t.Fatal("expected error for invalid miner address")
+	}
+}
+
+func TestDiscovererWebsocket(t *testing.T) {
+	s, info := newTestServer(t, "")
+	disco, err := NewDiscoverer(Gateway{URL: s.WSURL()})
 	if err != nil {
 		t.Fatal(err)
 	}
+	checkDiscovered(t, disco, info)
+}
+
+func TestDiscovererAuth(t *testing.T) {
+	const token = "secret-token"
+	s, info := newTestServer(t, token)
 
-	discovered, err := disco.Discover(ctx, peerID, testMinerAddr)
+	disco, err := NewDiscoverer(Gateway{URL: s.URL})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if _, err = disco.Discover(context.Background(), info.ID, testMinerAddr); err == nil {
+		t.Fatal("expected error without token")
+	}
 
-	if discovered.AddrInfo.ID != peerID {
-		t.Fatal("returned peer ID did not match requested")
+	for _, url := range []string{s.URL, s.WSURL()} {
+		disco, err = NewDiscoverer(Gateway{URL: url, Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDiscovered(t, disco, info)
 	}
+}
+
+func TestDiscovererFailover(t *testing.T) {
+	s1, info := newTestServer(t, "")
+	s2, _ := newTestServer(t, "")
 
-	t.Logf("Lotus discovered info for miner %q: %s", testMinerAddr, discovered.AddrInfo.String())
+	disco, err := NewDiscoverer(Gateway{URL: s1.URL}, Gateway{URL: s2.WSURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disco.headTTL = 0
+
+	s1.SetDown(true)
+	checkDiscovered(t, disco, info)
+	if s2.Calls("Filecoin.StateMinerInfo") != 1 {
+		t.Fatal("expected call to second gateway")
+	}
+
+	// The gateway that was last reached is tried first.
+	s1.SetDown(false)
+	checkDiscovered(t, disco, info)
+	if s2.Calls("Filecoin.StateMinerInfo") != 2 {
+		t.Fatal("expected second gateway to be tried first")
+	}
+
+	// An error from the API is an answer, so does not fail over.
+	if _, err = disco.Discover(context.Background(), info.ID, "t09999"); err == nil {
+		t.Fatal("expected error for unknown miner")
+	}
+	if s1.Calls("Filecoin.StateMinerInfo") != 0 {
+		t.Fatal("did not expect failover after rpc error")
+	}
+
+	s2.SetDown(true)
+	checkDiscovered(t, disco, info)
+	if s1.Calls("Filecoin.StateMinerInfo") != 1 {
+		t.Fatal("expected failover to first gateway")
+	}
+
+	s1.SetDown(true)
+	if _, err = disco.Discover(context.Background(), info.ID, testMinerAddr); err == nil {
+		t.Fatal("expected error when no gateway can be reached")
+	}
+}
+
+func TestChainHeadCache(t *testing.T) {
+	s, info := newTestServer(t, "")
+	disco, err := NewDiscoverer(Gateway{URL: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := disco.Discover(context.Background(), info.ID, testMinerAddr)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.Calls("Filecoin.ChainHead"); n != 1 {
+		t.Fatalf("expected 1 ChainHead call, got %d", n)
+	}
+	if n := s.Calls("Filecoin.StateMinerInfo"); n != 10 {
+		t.Fatalf("expected 10 StateMinerInfo calls, got %d", n)
+	}
+
+	// After the cached head expires, the head is read again.
+	disco.headMutex.Lock()
+	disco.headExpires = time.Now()
+	disco.headMutex.Unlock()
+	checkDiscovered(t, disco, info)
+	if n := s.Calls("Filecoin.ChainHead"); n != 2 {
+		t.Fatalf("expected 2 ChainHead calls, got %d", n)
+	}
+}
+
+func TestGatewayURL(t *testing.T) {
+	tests := []struct {
+		gateway string
+		expect  string
+	}{
+		{"api.chain.love", "https://api.chain.love/rpc/v1"},
+		{"https://api.chain.love", "https://api.chain.love/rpc/v1"},
+		{"http://127.0.0.1:1234/", "http://127.0.0.1:1234/rpc/v1"},
+		{"ws://127.0.0.1:1234/rpc/v0", "ws://127.0.0.1:1234/rpc/v0"},
+	}
+	for _, test := range tests {
+		u, err := gatewayURL(test.gateway)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.String() != test.expect {
+			t.Errorf("gateway %q: expected URL %q, got %q", test.gateway, test.expect, u.String())
+		}
+	}
+
+	for _, gateway := range []string{"ftp://api.chain.love", "http://"} {
+		if _, err := gatewayURL(gateway); err == nil {
+			t.Errorf("expected error for gateway %q", gateway)
+		}
+	}
+	if _, err := NewDiscoverer(); err == nil {
+		t.Error("expected error with no gateways")
+	}
 }
@@ -0,0 +1,206 @@
+package lotus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultRPCPath is the path of the lotus JSON-RPC API, used when a gateway
+// URL has no path.
+const defaultRPCPath = "/rpc/v1"
+
+// maxResponseSize limits the size of a JSON-RPC response that is read.
+const maxResponseSize = 1 << 22
+
+// rpcClient calls the methods of a lotus JSON-RPC API.
+type rpcClient interface {
+	call(ctx context.Context, out interface{}, method string, params ...interface{}) error
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// rpcError is an error returned by the lotus API for a method call.  Unlike
+// other errors, this is an answer from the API, so other gateways are not
+// tried.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("lotus rpc error %d: %s", e.Code, e.Message)
+}
+
+var rpcID int64
+
+// gatewayURL returns the URL of the JSON-RPC API of a gateway.  A gateway
+// without a scheme uses https, and one without a path uses defaultRPCPath.
+func gatewayURL(gateway string) (*url.URL, error) {
+	if !strings.Contains(gateway, "://") {
+		gateway = "https://" + gateway
+	}
+	u, err := url.Parse(gateway)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return nil, fmt.Errorf("unsupported lotus gateway scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("lotus gateway %q has no host", gateway)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultRPCPath
+	}
+	return u, nil
+}
+
+// newRPCClient creates a client for the JSON-RPC API at the URL, which sends
+// token, if not empty, as a bearer token.
+func newRPCClient(u *url.URL, token string) rpcClient {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	if u.Scheme == "ws" || u.Scheme == "wss" {
+		return &wsClient{
+			url:    u.String(),
+			header: header,
+		}
+	}
+	header.Set("Content-Type", "application/json")
+	return &httpClient{
+		url:    u.String(),
+		header: header,
+	}
+}
+
+func newRequest(method string, params []interface{}) *rpcRequest {
+	if params == nil {
+		params = []interface{}{}
+	}
+	return &rpcRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddInt64(&rpcID, 1),
+		Method:  method,
+		Params:  params,
+	}
+}
+
+func (rsp *rpcResponse) decode(out interface{}) error {
+	if rsp.Error != nil {
+		return rsp.Error
+	}
+	if err := json.Unmarshal(rsp.Result, out); err != nil {
+		return fmt.Errorf("cannot decode lotus rpc result: %s", err)
+	}
+	return nil
+}
+
+// httpClient calls API methods with an HTTP POST for each call.
+type httpClient struct {
+	url    string
+	header http.Header
+}
+
+func (c *httpClient) call(ctx context.Context, out interface{}, method string, params ...interface{}) error {
+	body, err := json.Marshal(newRequest(method, params))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = c.header.Clone()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	// An error from the method may come with an HTTP error status.
+	var rsp rpcResponse
+	err = json.Unmarshal(data, &rsp)
+	if err == nil && rsp.Error != nil {
+		return rsp.Error
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lotus rpc call %s to %s: %d %s", method, c.url, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot decode lotus rpc response: %s", err)
+	}
+	return rsp.decode(out)
+}
+
+// wsClient calls API methods over a websocket connection made for each call.
+type wsClient struct {
+	url    string
+	header http.Header
+}
+
+func (c *wsClient) call(ctx context.Context, out interface{}, method string, params ...interface{}) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.url, c.header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxResponseSize)
+
+	// Close the connection to stop waiting for a response if ctx is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	req := newRequest(method, params)
+	if err = conn.WriteJSON(req); err != nil {
+		return err
+	}
+	// Skip any messages, such as notifications, that are not the response.
+	for {
+		var rsp rpcResponse
+		if err = conn.ReadJSON(&rsp); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if rsp.ID == req.ID {
+			return rsp.decode(out)
+		}
+	}
+}
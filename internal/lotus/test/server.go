@@ -0,0 +1,202 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+// Server is a stub lotus JSON-RPC API, with the methods used to discover
+// miners.  It serves requests over both HTTP and websocket.
+type Server struct {
+	// URL is the http URL of the server.
+	URL string
+
+	httpServer *httptest.Server
+	token      string
+	upgrader   websocket.Upgrader
+
+	mutex  sync.Mutex
+	miners map[address.Address]peer.AddrInfo
+	calls  map[string]int
+	down   bool
+	head   []cid.Cid
+}
+
+type request struct {
+	ID     int64             `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *rpcError   `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type tipSet struct {
+	Cids   []cid.Cid
+	Blocks []interface{}
+	Height int64
+}
+
+type minerInfo struct {
+	PeerId     *peer.ID
+	Multiaddrs [][]byte
+}
+
+// NewServer starts a new stub lotus API server.  If token is not empty, then
+// requests must have it as a bearer token.
+func NewServer(token string) *Server {
+	mh, _ := multihash.Sum([]byte("stub tipset"), multihash.SHA2_256, -1)
+	s := &Server{
+		token:  token,
+		miners: map[address.Address]peer.AddrInfo{},
+		calls:  map[string]int{},
+		head:   []cid.Cid{cid.NewCidV1(cid.DagCBOR, mh)},
+	}
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.httpServer.URL
+	return s
+}
+
+// WSURL returns the websocket URL of the server.
+func (s *Server) WSURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// AddMiner adds a miner, that has the peer ID and addresses in info.
+func (s *Server) AddMiner(minerAddr string, info peer.AddrInfo) error {
+	addr, err := address.NewFromString(minerAddr)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.miners[addr] = info
+	s.mutex.Unlock()
+	return nil
+}
+
+// SetDown makes the server respond to all requests with a 503 error, as if
+// it cannot be reached, when down is true.
+func (s *Server) SetDown(down bool) {
+	s.mutex.Lock()
+	s.down = down
+	s.mutex.Unlock()
+}
+
+// Calls returns the number of times that the method was called.
+func (s *Server) Calls(method string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls[method]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	down := s.down
+	s.mutex.Unlock()
+	if down {
+		http.Error(w, "", http.StatusServiceUnavailable)
+		return
+	}
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := s.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req request
+			if err = conn.ReadJSON(&req); err != nil {
+				return
+			}
+			if err = conn.WriteJSON(s.handle(&req)); err != nil {
+				return
+			}
+		}
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.handle(&req))
+}
+
+func (s *Server) handle(req *request) *response {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls[req.Method]++
+
+	rsp := &response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+	}
+	switch req.Method {
+	case "Filecoin.ChainHead":
+		rsp.Result = &tipSet{
+			Cids:   s.head,
+			Blocks: []interface{}{},
+			Height: 1000,
+		}
+	case "Filecoin.StateMinerInfo":
+		var addr address.Address
+		if len(req.Params) != 2 {
+			rsp.Error = &rpcError{Code: 1, Message: "wrong param count"}
+			break
+		}
+		if err := json.Unmarshal(req.Params[0], &addr); err != nil {
+			rsp.Error = &rpcError{Code: 1, Message: err.Error()}
+			break
+		}
+		info, ok := s.miners[addr]
+		if !ok {
+			rsp.Error = &rpcError{Code: 1, Message: fmt.Sprintf("actor not found: %s", addr)}
+			break
+		}
+		mi := &minerInfo{
+			PeerId:     &info.ID,
+			Multiaddrs: make([][]byte, len(info.Addrs)),
+		}
+		for i, a := range info.Addrs {
+			mi.Multiaddrs[i] = a.Bytes()
+		}
+		rsp.Result = mi
+	default:
+		rsp.Error = &rpcError{Code: -32601, Message: "method not found: " + req.Method}
+	}
+	return rsp
+}
@@ -17,14 +17,19 @@ var (
 	Version, _ = tag.NewKey("version")
 
 	Method, _ = tag.NewKey("method")
+
+	Result, _ = tag.NewKey("result")
 )
 
 // Measures
 var (
 	FindLatency   = stats.Float64("find/latency", "Time to respond to a find request", stats.UnitMilliseconds)
+	FindPrefilter = stats.Int64("find/prefilter", "Number of multihash lookups by prefilter result", stats.UnitDimensionless)
 	IngestChange  = stats.Int64("ingest/change", "Number of ingest triggers received", stats.UnitDimensionless)
 	ProviderCount = stats.Int64("provider/count", "Number of know (registered) providers", stats.UnitDimensionless)
 	SyncLatency   = stats.Float64("ingest/synclatency", "Time for sync to complete", stats.UnitMilliseconds)
+
+	SequenceRejected = stats.Int64("ingest/seqrejected", "Number of signed requests rejected by sequence check", stats.UnitDimensionless)
 )
 
 // Views
@@ -33,6 +38,11 @@ var (
 		Measure:     FindLatency,
 		Aggregation: view.Distribution(0, 1, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 200, 300, 400, 500, 1000, 2000, 5000),
 	}
+	findPrefilterView = &view.View{
+		Measure:     FindPrefilter,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Result},
+	}
 	ingestChangeView = &view.View{
 		Measure:     IngestChange,
 		Aggregation: view.Count(),
@@ -42,6 +52,11 @@ var (
 		Measure:     ProviderCount,
 		Aggregation: view.LastValue(),
 	}
+	sequenceRejectedView = &view.View{
+		Measure:     SequenceRejected,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Result},
+	}
 	syncLatencyView = &view.View{
 		Measure:     SyncLatency,
 		Aggregation: view.Distribution(0, 1, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 200, 300, 400, 500, 1000, 2000, 5000),
@@ -53,7 +68,7 @@ var log = logging.Logger("indexer/metrics")
 // Start creates an HTTP router for serving metric info
 func Start(views []*view.View) http.Handler {
 	// Register default views
-	err := view.Register(findLatencyView, ingestChangeView, providerView, syncLatencyView)
+	err := view.Register(findLatencyView, findPrefilterView, ingestChangeView, providerView, sequenceRejectedView, syncLatencyView)
 	if err != nil {
 		log.Errorf("cannot register metrics default views: %s", err)
 	}
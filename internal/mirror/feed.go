@@ -0,0 +1,417 @@
+// Package mirror replicates the content of one indexer to other indexers.
+//
+// The primary indexer records every change to its index and registry in a
+// feed.  A mirror indexer follows the feed of the primary over libp2p, and
+// applies the same changes to its own index and registry, so that it stays
+// consistent with the primary without contacting providers itself.
+//
+// The feed keeps a limited number of the most recent changes in the
+// datastore, each identified by a sequence number.  A mirror remembers the
+// sequence number of the last change it applied, and continues from there
+// when it reconnects.  A mirror that has fallen further behind than the feed
+// goes back, or that is new, is first sent a snapshot of the primary's index
+// and registry.
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("indexer/mirror")
+
+// feedPrefix is the datastore key prefix of the events in the feed.
+const feedPrefix = "/mirror/feed/"
+
+// Event operations.
+const (
+	opPut            = "put"
+	opRemove         = "remove"
+	opRemoveProvider = "removeProvider"
+	opRemoveContext  = "removeContext"
+	opProvider       = "provider"
+	opUnregister     = "unregister"
+	opSnapshotEnd    = "snapshotEnd"
+	opHeartbeat      = "heartbeat"
+)
+
+var (
+	errTruncated = errors.New("feed does not go back far enough")
+	errAhead     = errors.New("sequence is ahead of feed")
+)
+
+// Event is a change to the index or registry of the primary indexer.
+type Event struct {
+	// Seq is the position of the event in the feed.  Events that are part of
+	// a snapshot, and heartbeats, have no sequence number.
+	Seq uint64 `json:",omitempty"`
+	// Op is the operation to apply.
+	Op string
+	// Value is the value to put or remove.
+	Value *indexer.Value `json:",omitempty"`
+	// Multihashes are the multihashes to put or remove.
+	Multihashes []multihash.Multihash `json:",omitempty"`
+	// ProviderID is the provider whose content is removed, or that is
+	// removed from the registry.
+	ProviderID peer.ID `json:",omitempty"`
+	// ContextID is the context whose content is removed.
+	ContextID []byte `json:",omitempty"`
+	// Provider is the registered information for a provider.
+	Provider *registry.ProviderInfo `json:",omitempty"`
+	// Error is set when the primary cannot continue sending events.
+	Error string `json:",omitempty"`
+}
+
+// Feed records the changes made to an indexer's index and registry, and
+// serves them to mirror indexers.
+type Feed struct {
+	ds        datastore.Batching
+	indexer   indexer.Interface
+	registry  *registry.Registry
+	maxEvents uint64
+
+	lock   sync.Mutex
+	first  uint64
+	last   uint64
+	notify chan struct{}
+
+	// writeLock is held for reading by each change made to the index, and for
+	// writing while a snapshot of the index is read, since changes invalidate
+	// the index iterator.
+	writeLock sync.RWMutex
+
+	// mirrors are the peers allowed to read the feed.
+	mirrors map[peer.ID]struct{}
+
+	// Registry changes are queued, and recorded on the feed's own goroutine
+	// so that the registry does not wait for the datastore.
+	provLock  sync.Mutex
+	provQueue []*Event
+	provReady chan struct{}
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewFeed creates a feed that records changes to the registry, and to the
+// index through the indexer returned by the feed's Indexer method.  The feed
+// keeps up to maxEvents of the most recent changes in the datastore.
+func NewFeed(ds datastore.Batching, idxr indexer.Interface, reg *registry.Registry, maxEvents int) (*Feed, error) {
+	if maxEvents < 1 {
+		return nil, errors.New("feed must keep at least one event")
+	}
+	f := &Feed{
+		ds:        ds,
+		indexer:   idxr,
+		registry:  reg,
+		maxEvents: uint64(maxEvents),
+		notify:    make(chan struct{}),
+		provReady: make(chan struct{}, 1),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := f.loadRange(); err != nil {
+		return nil, fmt.Errorf("cannot read feed from datastore: %s", err)
+	}
+	go f.run()
+	reg.OnRegister(f.queueProvider)
+	reg.OnRemove(f.queueUnregister)
+	log.Infow("Mirror feed started", "first", f.first, "last", f.last)
+	return f, nil
+}
+
+// Indexer returns an indexer that records all changes made through it in the
+// feed.
+func (f *Feed) Indexer() indexer.Interface {
+	return &recordingIndexer{
+		Interface: f.indexer,
+		feed:      f,
+	}
+}
+
+// Close stops recording registry changes and ends all feed streams.
+func (f *Feed) Close() {
+	f.closeOnce.Do(func() {
+		close(f.closing)
+	})
+	<-f.done
+}
+
+// run records the queued registry changes until the feed is closed.
+func (f *Feed) run() {
+	defer close(f.done)
+	for {
+		select {
+		case <-f.provReady:
+			f.provLock.Lock()
+			events := f.provQueue
+			f.provQueue = nil
+			f.provLock.Unlock()
+
+			for _, ev := range events {
+				f.recordProvider(ev)
+			}
+		case <-f.closing:
+			return
+		}
+	}
+}
+
+// append assigns the next sequence number to the event and stores it.  The
+// oldest events are removed when the feed holds more than the maximum number
+// of events.
+func (f *Feed) append(ev *Event) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ev.Seq = f.last + 1
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if err = f.ds.Put(feedKey(ev.Seq), data); err != nil {
+		return fmt.Errorf("cannot store feed event: %s", err)
+	}
+	f.last = ev.Seq
+	if f.first == 0 {
+		f.first = ev.Seq
+	}
+	for f.last-f.first >= f.maxEvents {
+		if err = f.ds.Delete(feedKey(f.first)); err != nil {
+			log.Errorw("Cannot delete old feed event", "seq", f.first, "err", err)
+			break
+		}
+		f.first++
+	}
+
+	// Wake up all streams waiting for new events.
+	close(f.notify)
+	f.notify = make(chan struct{})
+	return nil
+}
+
+// events reads up to limit events that come after the since sequence number.
+// It also returns a channel that is closed when there are more events.
+func (f *Feed) events(since uint64, limit int) ([]Event, <-chan struct{}, error) {
+	f.lock.Lock()
+	first, last, notify := f.first, f.last, f.notify
+	f.lock.Unlock()
+
+	if since > last {
+		return nil, nil, errAhead
+	}
+	if since == last {
+		return nil, notify, nil
+	}
+	if since+1 < first {
+		return nil, nil, errTruncated
+	}
+
+	end := last
+	if end-since > uint64(limit) {
+		end = since + uint64(limit)
+	}
+	events := make([]Event, 0, end-since)
+	for seq := since + 1; seq <= end; seq++ {
+		data, err := f.ds.Get(feedKey(seq))
+		if err != nil {
+			if err == datastore.ErrNotFound {
+				// Removed since the range was read.
+				return nil, nil, errTruncated
+			}
+			return nil, nil, err
+		}
+		var ev Event
+		if err = json.Unmarshal(data, &ev); err != nil {
+			return nil, nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, notify, nil
+}
+
+// lastSeq returns the sequence number of the most recent event.
+func (f *Feed) lastSeq() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.last
+}
+
+// loadRange finds the first and last sequence numbers of the events stored in
+// the datastore.
+func (f *Feed) loadRange() error {
+	results, err := f.ds.Query(query.Query{
+		Prefix:   feedPrefix,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		seq, err := strconv.ParseUint(path.Base(r.Key), 16, 64)
+		if err != nil {
+			log.Errorw("Bad feed event key", "key", r.Key)
+			continue
+		}
+		if f.first == 0 || seq < f.first {
+			f.first = seq
+		}
+		if seq > f.last {
+			f.last = seq
+		}
+	}
+	return nil
+}
+
+// queueProvider queues a change to the registry to be recorded.  This is
+// called on the registry's goroutine, so it must not block.
+func (f *Feed) queueProvider(info *registry.ProviderInfo) {
+	f.queueRegistryEvent(&Event{
+		Op:       opProvider,
+		Provider: info,
+	})
+}
+
+// queueUnregister queues the removal of a provider from the registry to be
+// recorded.
+func (f *Feed) queueUnregister(providerID peer.ID) {
+	f.queueRegistryEvent(&Event{
+		Op:         opUnregister,
+		ProviderID: providerID,
+	})
+}
+
+func (f *Feed) queueRegistryEvent(ev *Event) {
+	select {
+	case <-f.closing:
+		return
+	default:
+	}
+	f.provLock.Lock()
+	f.provQueue = append(f.provQueue, ev)
+	f.provLock.Unlock()
+
+	select {
+	case f.provReady <- struct{}{}:
+	default:
+	}
+}
+
+// recordProvider records a change to the registry.
+func (f *Feed) recordProvider(ev *Event) {
+	if err := f.append(ev); err != nil {
+		provID := ev.ProviderID
+		if ev.Provider != nil {
+			provID = ev.Provider.AddrInfo.ID
+		}
+		log.Errorw("Cannot record provider in feed", "provider", provID, "err", err)
+	}
+}
+
+// feedKey returns the datastore key of an event.  The sequence number is
+// fixed-width hex so that keys sort in sequence order.
+func feedKey(seq uint64) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%s%016x", feedPrefix, seq))
+}
+
+// recordingIndexer is an indexer that records each change in the feed after
+// the change is made.  Changes wait while a snapshot of the index is read.
+type recordingIndexer struct {
+	indexer.Interface
+	feed *Feed
+}
+
+func (r *recordingIndexer) Put(value indexer.Value, mhs ...multihash.Multihash) error {
+	_, err := r.PutCount(value, mhs...)
+	return err
+}
+
+func (r *recordingIndexer) PutCount(value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	r.feed.writeLock.RLock()
+	defer r.feed.writeLock.RUnlock()
+
+	count, err := providerindex.CountPut(r.Interface, value, mhs...)
+	if err != nil {
+		return 0, err
+	}
+	err = r.feed.append(&Event{
+		Op:          opPut,
+		Value:       &value,
+		Multihashes: mhs,
+	})
+	return count, err
+}
+
+func (r *recordingIndexer) Remove(value indexer.Value, mhs ...multihash.Multihash) error {
+	_, err := r.RemoveCount(value, mhs...)
+	return err
+}
+
+func (r *recordingIndexer) RemoveCount(value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	r.feed.writeLock.RLock()
+	defer r.feed.writeLock.RUnlock()
+
+	count, err := providerindex.CountRemove(r.Interface, value, mhs...)
+	if err != nil {
+		return 0, err
+	}
+	err = r.feed.append(&Event{
+		Op:          opRemove,
+		Value:       &value,
+		Multihashes: mhs,
+	})
+	return count, err
+}
+
+func (r *recordingIndexer) RemoveProvider(providerID peer.ID) error {
+	r.feed.writeLock.RLock()
+	defer r.feed.writeLock.RUnlock()
+
+	if err := r.Interface.RemoveProvider(providerID); err != nil {
+		return err
+	}
+	return r.feed.append(&Event{
+		Op:         opRemoveProvider,
+		ProviderID: providerID,
+	})
+}
+
+func (r *recordingIndexer) RemoveProviderContext(providerID peer.ID, contextID []byte) error {
+	_, err := r.RemoveProviderContextCount(providerID, contextID)
+	return err
+}
+
+func (r *recordingIndexer) RemoveProviderContextCount(providerID peer.ID, contextID []byte) (int, error) {
+	r.feed.writeLock.RLock()
+	defer r.feed.writeLock.RUnlock()
+
+	count, err := providerindex.CountRemoveProviderContext(r.Interface, providerID, contextID)
+	if err != nil {
+		return 0, err
+	}
+	err = r.feed.append(&Event{
+		Op:         opRemoveContext,
+		ProviderID: providerID,
+		ContextID:  contextID,
+	})
+	return count, err
+}
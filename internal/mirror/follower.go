@@ -0,0 +1,394 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	// seqPrefix is the datastore key prefix of the last sequence number
+	// applied from each primary.
+	seqPrefix = "/mirror/seq/"
+	// stagingPrefix is the datastore key prefix of the content of a snapshot
+	// from each primary, while the snapshot is received.
+	stagingPrefix = "/mirror/staging/"
+	// stagingBatchSize is the number of staged entries removed at once.
+	stagingBatchSize = 1024
+)
+
+// Follower follows the feed of a primary indexer, and applies each change to
+// the local index and registry.
+type Follower struct {
+	host          host.Host
+	primary       peer.ID
+	indexer       indexer.Interface
+	registry      *registry.Registry
+	ds            datastore.Datastore
+	retryInterval time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewFollower starts following the feed of the primary indexer.  Changes are
+// applied to the indexer and registry, and the position in the feed is kept
+// in the datastore so that following continues from there after a restart.
+// If the connection to the primary is lost, then the follower reconnects
+// after retryInterval.
+func NewFollower(h host.Host, primary peer.AddrInfo, idxr indexer.Interface, reg *registry.Registry, ds datastore.Datastore, retryInterval time.Duration) *Follower {
+	h.Peerstore().AddAddrs(primary.ID, primary.Addrs, peerstore.PermanentAddrTTL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Follower{
+		host:          h,
+		primary:       primary.ID,
+		indexer:       idxr,
+		registry:      reg,
+		ds:            ds,
+		retryInterval: retryInterval,
+
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go f.run(ctx)
+	return f
+}
+
+// Close stops following the primary.
+func (f *Follower) Close() {
+	f.cancel()
+	<-f.done
+}
+
+func (f *Follower) run(ctx context.Context) {
+	defer close(f.done)
+
+	log.Infow("Following primary indexer", "primary", f.primary)
+	for {
+		err := f.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnw("Lost connection to primary indexer", "primary", f.primary, "err", err, "retry_in", f.retryInterval)
+
+		select {
+		case <-time.After(f.retryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// follow opens a stream to the primary and applies the events it sends, until
+// the stream ends or an event cannot be applied.
+func (f *Follower) follow(ctx context.Context) error {
+	since, synced, err := f.loadSeq()
+	if err != nil {
+		return err
+	}
+
+	s, err := f.host.NewStream(ctx, f.primary, v0.MirrorProtocolID)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Reset the stream if the follower is closed, to stop reading events.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Reset()
+		case <-stop:
+		}
+	}()
+
+	if err = json.NewEncoder(s).Encode(&feedRequest{Since: since, Synced: synced}); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(s))
+	// snapProviders holds the providers in a snapshot while it is received.
+	var snapProviders map[peer.ID]struct{}
+	for {
+		var ev Event
+		if err = dec.Decode(&ev); err != nil {
+			return err
+		}
+		if ev.Error != "" {
+			return fmt.Errorf("primary indexer error: %s", ev.Error)
+		}
+
+		// Snapshot events, other than the end, have no sequence number.  The
+		// content of a snapshot is staged in the datastore, and swapped into
+		// the local index when the whole snapshot is received, so that the
+		// index is not left incomplete if the snapshot does not finish.
+		if (ev.Seq == 0 && ev.Op != opHeartbeat) || ev.Op == opSnapshotEnd {
+			if snapProviders == nil {
+				if synced {
+					log.Warnw("Mirror too far behind primary, receiving snapshot", "since", since)
+				}
+				if err = f.startSnapshot(); err != nil {
+					return fmt.Errorf("cannot start snapshot: %s", err)
+				}
+				snapProviders = make(map[peer.ID]struct{})
+			}
+			switch ev.Op {
+			case opPut:
+				err = f.stage(&ev)
+			case opProvider:
+				if ev.Provider != nil {
+					snapProviders[ev.Provider.AddrInfo.ID] = struct{}{}
+				}
+				err = f.apply(&ev)
+			case opSnapshotEnd:
+				err = f.swapSnapshot(snapProviders)
+				snapProviders = nil
+				log.Info("Finished receiving snapshot from primary")
+			default:
+				err = fmt.Errorf("unexpected operation in snapshot")
+			}
+		} else {
+			err = f.apply(&ev)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot apply %s event %d: %s", ev.Op, ev.Seq, err)
+		}
+
+		// The end of a snapshot is stored even if its sequence number is 0,
+		// since the mirror then has all content of an idle primary.
+		if ev.Seq != 0 || ev.Op == opSnapshotEnd {
+			if err = f.storeSeq(ev.Seq); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// apply makes the change described by the event.
+func (f *Follower) apply(ev *Event) error {
+	switch ev.Op {
+	case opPut, opRemove:
+		if ev.Value == nil {
+			return errors.New("missing value")
+		}
+		if ev.Op == opPut {
+			return f.indexer.Put(*ev.Value, ev.Multihashes...)
+		}
+		return f.indexer.Remove(*ev.Value, ev.Multihashes...)
+	case opRemoveProvider:
+		return f.indexer.RemoveProvider(ev.ProviderID)
+	case opRemoveContext:
+		return f.indexer.RemoveProviderContext(ev.ProviderID, ev.ContextID)
+	case opProvider:
+		if ev.Provider == nil {
+			return errors.New("missing provider")
+		}
+		return f.registry.Replicate(ev.Provider)
+	case opUnregister:
+		return f.registry.RemoveProvider(ev.ProviderID)
+	case opSnapshotEnd, opHeartbeat:
+		return nil
+	}
+	return fmt.Errorf("unknown operation %q", ev.Op)
+}
+
+// startSnapshot prepares to receive a snapshot.  The stored sequence number
+// is removed first, so that a snapshot is requested again if this one does not
+// finish, and any content staged from an earlier snapshot is removed.
+func (f *Follower) startSnapshot() error {
+	if err := f.ds.Delete(f.seqKey()); err != nil {
+		return err
+	}
+	return f.clearStaging()
+}
+
+// stage stores the content of a snapshot event in the datastore.
+func (f *Follower) stage(ev *Event) error {
+	if ev.Value == nil {
+		return errors.New("missing value")
+	}
+	data, err := json.Marshal(ev.Value)
+	if err != nil {
+		return err
+	}
+	for _, mh := range ev.Multihashes {
+		if err = f.ds.Put(f.stagingKey(mh, ev.Value), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swapSnapshot makes the local index and registry match a snapshot that has
+// been received.  The staged content is put into the index, and then the
+// content and providers that are not in the snapshot are removed.
+func (f *Follower) swapSnapshot(snapProviders map[peer.ID]struct{}) error {
+	results, err := f.ds.Query(query.Query{Prefix: f.stagingPrefix()})
+	if err != nil {
+		return err
+	}
+	var staged int
+	for r := range results.Next() {
+		if r.Error != nil {
+			results.Close()
+			return r.Error
+		}
+		mh, err := stagedMultihash(r.Key)
+		if err != nil {
+			results.Close()
+			return err
+		}
+		var value indexer.Value
+		if err = json.Unmarshal(r.Value, &value); err != nil {
+			results.Close()
+			return err
+		}
+		if err = f.indexer.Put(value, mh); err != nil {
+			results.Close()
+			return err
+		}
+		staged++
+	}
+	results.Close()
+
+	// Find the content that is not in the snapshot first, since removing
+	// content invalidates the iterator.
+	type staleEntry struct {
+		value indexer.Value
+		mh    multihash.Multihash
+	}
+	var stale []staleEntry
+	iter, err := f.indexer.Iter()
+	if err != nil {
+		return err
+	}
+	for {
+		mh, values, err := iter.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		for i := range values {
+			has, err := f.ds.Has(f.stagingKey(mh, &values[i]))
+			if err != nil {
+				return err
+			}
+			if !has {
+				stale = append(stale, staleEntry{value: values[i], mh: mh})
+			}
+		}
+	}
+	for _, entry := range stale {
+		if err = f.indexer.Remove(entry.value, entry.mh); err != nil {
+			return err
+		}
+	}
+
+	var unregistered int
+	for _, info := range f.registry.AllProviderInfo() {
+		if _, ok := snapProviders[info.AddrInfo.ID]; ok {
+			continue
+		}
+		if err = f.registry.RemoveProvider(info.AddrInfo.ID); err != nil {
+			return err
+		}
+		unregistered++
+	}
+	log.Infow("Applied snapshot", "entries", staged, "removed", len(stale), "unregistered", unregistered)
+
+	return f.clearStaging()
+}
+
+// clearStaging removes all staged snapshot content from the datastore.
+func (f *Follower) clearStaging() error {
+	for {
+		results, err := f.ds.Query(query.Query{
+			Prefix:   f.stagingPrefix(),
+			KeysOnly: true,
+			Limit:    stagingBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		entries, err := results.Rest()
+		if err != nil {
+			return err
+		}
+		for i := range entries {
+			if err = f.ds.Delete(datastore.NewKey(entries[i].Key)); err != nil {
+				return err
+			}
+		}
+		if len(entries) < stagingBatchSize {
+			return nil
+		}
+	}
+}
+
+func (f *Follower) stagingPrefix() string {
+	return stagingPrefix + f.primary.String() + "/"
+}
+
+// stagingKey returns the datastore key of a staged multihash and value.  A
+// value is identified by its provider and context.
+func (f *Follower) stagingKey(mh multihash.Multihash, value *indexer.Value) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%s%x/%x-%x", f.stagingPrefix(), []byte(mh), []byte(value.ProviderID), value.ContextID))
+}
+
+// stagedMultihash returns the multihash in the key of a staged entry.
+func stagedMultihash(key string) (multihash.Multihash, error) {
+	b, err := hex.DecodeString(path.Base(path.Dir(key)))
+	if err != nil {
+		return nil, fmt.Errorf("bad staging key %q: %s", key, err)
+	}
+	return multihash.Cast(b)
+}
+
+// loadSeq returns the sequence number of the last event applied, and whether
+// the mirror has applied any events or a snapshot.
+func (f *Follower) loadSeq() (uint64, bool, error) {
+	b, err := f.ds.Get(f.seqKey())
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	seq, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, false, errors.New("bad mirror sequence in datastore")
+	}
+	return seq, true, nil
+}
+
+func (f *Follower) storeSeq(seq uint64) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, seq)
+	return f.ds.Put(f.seqKey(), buf[:n])
+}
+
+func (f *Follower) seqKey() datastore.Key {
+	return datastore.NewKey(seqPrefix + f.primary.String())
+}
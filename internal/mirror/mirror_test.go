@@ -0,0 +1,238 @@
+package mirror
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	providerID   = "12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA"
+	providerAddr = "/ip4/127.0.0.1/tcp/9999"
+
+	staleProviderID = "12D3KooWSG3JuvEjRkSxt93ADTjQxqe4ExbBwSkQ9Zyk1WfBaZJF"
+)
+
+func TestMirror(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maddr, err := multiaddr.NewMultiaddr(providerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Start the primary, with a feed that only keeps 3 events.
+	primaryHost := newHost(t)
+	defer primaryHost.Close()
+	mirrorHost := newHost(t)
+	defer mirrorHost.Close()
+	primaryReg := newRegistry(t)
+	defer primaryReg.Close()
+	primaryStore := memory.New()
+	feed, err := NewFeed(newDatastore(), primaryStore, primaryReg, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	feed.Serve(primaryHost, []peer.ID{mirrorHost.ID()})
+	primaryIndexer := feed.Indexer()
+
+	err = primaryReg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Index more content than the feed keeps, so that the mirror needs a
+	// snapshot.
+	value := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: []byte("metadata"),
+	}
+	mhs := util.RandomMultihashes(6)
+	for _, mh := range mhs[:5] {
+		if err = primaryIndexer.Put(value, mh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Start the mirror, with content and a provider that the primary does
+	// not have.
+	mirrorReg := newRegistry(t)
+	defer mirrorReg.Close()
+	mirrorStore := memory.New()
+	stale := util.RandomMultihashes(1)[0]
+	if err = mirrorStore.Put(value, stale); err != nil {
+		t.Fatal(err)
+	}
+	staleProvID, err := peer.Decode(staleProviderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mirrorReg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    staleProvID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrorDS := newDatastore()
+	primaryInfo := peer.AddrInfo{
+		ID:    primaryHost.ID(),
+		Addrs: primaryHost.Addrs(),
+	}
+	follower := NewFollower(mirrorHost, primaryInfo, mirrorStore, mirrorReg, mirrorDS, 100*time.Millisecond)
+
+	for _, mh := range mhs[:5] {
+		waitFor(t, "snapshot content", func() bool { return hasValue(t, mirrorStore, mh) })
+	}
+	if hasValue(t, mirrorStore, stale) {
+		t.Fatal("content not on primary kept after snapshot")
+	}
+	if mirrorReg.IsRegistered(staleProvID) {
+		t.Fatal("provider not on primary kept after snapshot")
+	}
+	waitFor(t, "provider", func() bool { return mirrorReg.IsRegistered(provID) })
+	info := mirrorReg.ProviderInfo(provID)
+	if len(info.AddrInfo.Addrs) != 1 || !info.AddrInfo.Addrs[0].Equal(maddr) {
+		t.Fatalf("wrong mirrored provider addresses: %v", info.AddrInfo.Addrs)
+	}
+
+	// Changes are applied as they happen.
+	if err = primaryIndexer.Remove(value, mhs[0]); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "removal", func() bool { return !hasValue(t, mirrorStore, mhs[0]) })
+
+	// After restarting, the mirror continues from where it left off.
+	follower.Close()
+	if err = primaryIndexer.Put(value, mhs[5]); err != nil {
+		t.Fatal(err)
+	}
+	follower = NewFollower(mirrorHost, primaryInfo, mirrorStore, mirrorReg, mirrorDS, 100*time.Millisecond)
+	defer follower.Close()
+	waitFor(t, "new content", func() bool { return hasValue(t, mirrorStore, mhs[5]) })
+	if hasValue(t, mirrorStore, mhs[0]) {
+		t.Fatal("removed content restored by resumed mirror")
+	}
+
+	// Providers removed from the primary registry are removed from the
+	// mirror registry.
+	if err = primaryReg.RemoveProvider(provID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "provider removal", func() bool { return !mirrorReg.IsRegistered(provID) })
+}
+
+func TestMirrorIdlePrimary(t *testing.T) {
+	primaryHost := newHost(t)
+	defer primaryHost.Close()
+	mirrorHost := newHost(t)
+	defer mirrorHost.Close()
+	otherHost := newHost(t)
+	defer otherHost.Close()
+
+	primaryReg := newRegistry(t)
+	defer primaryReg.Close()
+	feed, err := NewFeed(newDatastore(), memory.New(), primaryReg, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	feed.Serve(primaryHost, []peer.ID{mirrorHost.ID()})
+	primaryInfo := peer.AddrInfo{
+		ID:    primaryHost.ID(),
+		Addrs: primaryHost.Addrs(),
+	}
+
+	// A peer that is not an allowed mirror cannot read the feed.
+	otherReg := newRegistry(t)
+	defer otherReg.Close()
+	otherFollower := NewFollower(otherHost, primaryInfo, memory.New(), otherReg, newDatastore(), time.Minute)
+	time.Sleep(200 * time.Millisecond)
+	otherFollower.Close()
+	if _, synced, _ := otherFollower.loadSeq(); synced {
+		t.Fatal("peer that is not allowed received snapshot")
+	}
+
+	// The snapshot of a primary with no events is remembered, so that the
+	// mirror does not need another snapshot when it reconnects.
+	mirrorReg := newRegistry(t)
+	defer mirrorReg.Close()
+	follower := NewFollower(mirrorHost, primaryInfo, memory.New(), mirrorReg, newDatastore(), time.Minute)
+	defer follower.Close()
+	waitFor(t, "snapshot", func() bool {
+		_, synced, err := follower.loadSeq()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return synced
+	})
+}
+
+func hasValue(t *testing.T, store indexer.Interface, mh multihash.Multihash) bool {
+	_, found, err := store.Get(mh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for mirror to get %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newRegistry(t *testing.T) *registry.Registry {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func newDatastore() datastore.Batching {
+	return dssync.MutexWrap(datastore.NewMapDatastore())
+}
+
+func newHost(t *testing.T) host.Host {
+	h, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
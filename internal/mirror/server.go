@@ -0,0 +1,207 @@
+package mirror
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	// eventBatchSize is the maximum number of events read from the datastore
+	// at once.
+	eventBatchSize = 256
+	// heartbeatInterval is how often a heartbeat is sent when there are no
+	// new events, so that broken streams are detected.
+	heartbeatInterval = 30 * time.Second
+	// writeTimeout is how long a write to a mirror may take.  This keeps a
+	// stalled mirror from holding up changes to the index while it is sent
+	// a snapshot.
+	writeTimeout = time.Minute
+)
+
+// feedRequest is sent by a mirror to start reading the feed.
+type feedRequest struct {
+	// Since is the sequence number of the last event the mirror applied.
+	Since uint64
+	// Synced is true if the mirror has received a snapshot or events, and so
+	// does not need a snapshot even if Since is 0.
+	Synced bool
+}
+
+// Serve makes the feed available to the mirrors that connect to the host.
+// Only the peers listed in mirrors are allowed to read the feed.
+func (f *Feed) Serve(h host.Host, mirrors []peer.ID) {
+	allowed := make(map[peer.ID]struct{}, len(mirrors))
+	for _, id := range mirrors {
+		allowed[id] = struct{}{}
+	}
+	f.mirrors = allowed
+	h.SetStreamHandler(v0.MirrorProtocolID, f.handleStream)
+}
+
+// handleStream sends all events after the sequence number requested by the
+// mirror, and then continues sending new events as they are recorded.  A
+// snapshot is sent first if the mirror is new, or if the feed does not go
+// back far enough.
+func (f *Feed) handleStream(s network.Stream) {
+	defer s.Close()
+	mirrorID := s.Conn().RemotePeer()
+	if _, ok := f.mirrors[mirrorID]; !ok {
+		log.Warnw("Rejected feed request from peer that is not an allowed mirror", "peer", mirrorID)
+		s.Reset()
+		return
+	}
+
+	var req feedRequest
+	if err := json.NewDecoder(s).Decode(&req); err != nil {
+		log.Errorw("Cannot read feed request", "mirror", mirrorID, "err", err)
+		s.Reset()
+		return
+	}
+	log.Infow("Mirror connected", "mirror", mirrorID, "since", req.Since)
+
+	w := bufio.NewWriter(&deadlineWriter{s: s})
+	enc := json.NewEncoder(w)
+	heartbeat := time.NewTimer(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// A new mirror starts with a snapshot, since the indexer may have content
+	// from before the feed was started.
+	since := req.Since
+	snapshot := since == 0 && !req.Synced
+	for {
+		var events []Event
+		var notify <-chan struct{}
+		var err error
+		if !snapshot {
+			events, notify, err = f.events(since, eventBatchSize)
+			snapshot = err == errTruncated || err == errAhead
+		}
+		if snapshot {
+			log.Infow("Sending snapshot to mirror", "mirror", mirrorID, "since", since)
+			since, err = f.sendSnapshot(enc)
+			if err != nil {
+				log.Errorw("Cannot send snapshot to mirror", "mirror", mirrorID, "err", err)
+				enc.Encode(&Event{Error: err.Error()})
+				w.Flush()
+				return
+			}
+			if err = w.Flush(); err != nil {
+				log.Infow("Mirror disconnected", "mirror", mirrorID, "err", err)
+				return
+			}
+			snapshot = false
+			continue
+		}
+		if err != nil {
+			log.Errorw("Cannot read feed events", "err", err)
+			enc.Encode(&Event{Error: err.Error()})
+			w.Flush()
+			return
+		}
+
+		for i := range events {
+			if err = enc.Encode(&events[i]); err != nil {
+				log.Infow("Mirror disconnected", "mirror", mirrorID, "err", err)
+				return
+			}
+			since = events[i].Seq
+		}
+		if len(events) != 0 {
+			if err = w.Flush(); err != nil {
+				log.Infow("Mirror disconnected", "mirror", mirrorID, "err", err)
+				return
+			}
+			continue
+		}
+
+		// Wait for new events.
+		if !heartbeat.Stop() {
+			select {
+			case <-heartbeat.C:
+			default:
+			}
+		}
+		heartbeat.Reset(heartbeatInterval)
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			enc.Encode(&Event{Op: opHeartbeat})
+			if err = w.Flush(); err != nil {
+				log.Infow("Mirror disconnected", "mirror", mirrorID, "err", err)
+				return
+			}
+		case <-f.closing:
+			return
+		}
+	}
+}
+
+// sendSnapshot sends the registered providers and the entire index as
+// events, and returns the sequence number that the feed continues from.
+//
+// Changes to the index wait while the snapshot is read, so that the snapshot
+// is the index as of the returned sequence number.  Registry changes are not
+// held up, but the sequence number is read before the providers, so that any
+// registry change not in the snapshot is recorded after it.  Applying such a
+// change again has no effect.
+func (f *Feed) sendSnapshot(enc *json.Encoder) (uint64, error) {
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	seq := f.lastSeq()
+
+	for _, info := range f.registry.AllProviderInfo() {
+		if err := enc.Encode(&Event{Op: opProvider, Provider: info}); err != nil {
+			return 0, err
+		}
+	}
+
+	iter, err := f.indexer.Iter()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		mh, values, err := iter.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+		for i := range values {
+			err = enc.Encode(&Event{
+				Op:          opPut,
+				Value:       &values[i],
+				Multihashes: []multihash.Multihash{mh},
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err = enc.Encode(&Event{Op: opSnapshotEnd, Seq: seq}); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// deadlineWriter sets a deadline for each write to a stream.
+type deadlineWriter struct {
+	s network.Stream
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	if err := w.s.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return 0, err
+	}
+	return w.s.Write(p)
+}
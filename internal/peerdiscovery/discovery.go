@@ -0,0 +1,68 @@
+package peerdiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
+	"github.com/filecoin-project/storetheindex/internal/syserr"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Discoverer verifies a provider by connecting to it over libp2p.  The secure
+// channel handshake proves that the provider has the private key for its peer
+// ID, and libp2p identify supplies the addresses the provider listens on.
+type Discoverer struct {
+	host host.Host
+}
+
+// NewDiscoverer creates a new peer Discoverer that connects to providers
+// using the given libp2p host.
+func NewDiscoverer(h host.Host) *Discoverer {
+	return &Discoverer{
+		host: h,
+	}
+}
+
+// Discover connects to the provider at the multiaddr addr, which may end with
+// the provider's /p2p peer ID.
+func (d *Discoverer) Discover(ctx context.Context, peerID peer.ID, addr string) (*discovery.Discovered, error) {
+	maddr, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provider multiaddr: %s", err)
+	}
+	transport, id := peer.SplitAddr(maddr)
+	if transport == nil {
+		return nil, errors.New("provider multiaddr has no transport address")
+	}
+	if id != "" && id != peerID {
+		return nil, discovery.ErrProviderMismatch
+	}
+
+	// Connect waits for identify to complete, so the peerstore then has the
+	// addresses that the provider reported.
+	err = d.host.Connect(ctx, peer.AddrInfo{
+		ID:    peerID,
+		Addrs: []multiaddr.Multiaddr{transport},
+	})
+	if err != nil {
+		return nil, syserr.New(fmt.Errorf("cannot connect to provider: %s", err), http.StatusBadGateway)
+	}
+
+	addrs := d.host.Peerstore().Addrs(peerID)
+	if len(addrs) == 0 {
+		addrs = []multiaddr.Multiaddr{transport}
+	}
+
+	return &discovery.Discovered{
+		AddrInfo: peer.AddrInfo{
+			ID:    peerID,
+			Addrs: addrs,
+		},
+		Type: discovery.OtherType,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package peerdiscovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func newHost(t *testing.T) host.Host {
+	h, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestDiscoverer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexerHost := newHost(t)
+	provHost := newHost(t)
+	disco := NewDiscoverer(indexerHost)
+
+	provAddr := provHost.Addrs()[0]
+	discovered, err := disco.Discover(ctx, provHost.ID(), provAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discovered.AddrInfo.ID != provHost.ID() {
+		t.Fatal("wrong provider id")
+	}
+	if discovered.Type != discovery.OtherType {
+		t.Fatal("wrong provider type")
+	}
+	var found bool
+	for _, a := range discovered.AddrInfo.Addrs {
+		if a.Equal(provAddr) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("provider address %s not in discovered addresses %v", provAddr, discovered.AddrInfo.Addrs)
+	}
+
+	// Address with the /p2p peer ID of the provider.
+	p2pAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: provHost.ID(), Addrs: []multiaddr.Multiaddr{provAddr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = disco.Discover(ctx, provHost.ID(), p2pAddrs[0].String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A peer ID that is not the provider's fails verification.
+	otherID, err := p2ptest.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = disco.Discover(ctx, otherID, provAddr.String()); err == nil {
+		t.Fatal("expected error discovering provider with wrong peer id")
+	}
+	if _, err = disco.Discover(ctx, otherID, p2pAddrs[0].String()); err == nil {
+		t.Fatal("expected provider id mismatch error")
+	}
+	if _, err = disco.Discover(ctx, provHost.ID(), "not-a-multiaddr"); err == nil {
+		t.Fatal("expected error for invalid multiaddr")
+	}
+}
@@ -0,0 +1,331 @@
+// Package prefilter answers lookups for multihashes that are not indexed
+// without reading the value store.
+//
+// A bloom filter holds every indexed multihash.  A multihash that is not in
+// the bloom filter is certainly not indexed.  The bloom filter is built by
+// iterating the value store, and any write to the value store invalidates the
+// iterator, so the bloom filter is only used once it has been built with no
+// writes happening at the same time.  Until then, every lookup reads the value
+// store.  A multihash that is in the bloom
+// filter, but is not found in the value store, is a false positive, and is
+// remembered in a bounded negative cache so that repeated lookups for it do
+// not read the value store again.
+package prefilter
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/metrics"
+	"github.com/ipfs/bbloom"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var log = logging.Logger("indexer/prefilter")
+
+// Lookup results recorded in metrics.
+const (
+	resultFiltered      = "filtered"
+	resultCached        = "cached"
+	resultFalsePositive = "false_positive"
+	resultFound         = "found"
+)
+
+// rebuildWait is how long to wait before building the bloom filter again,
+// after writes were made while it was being built.
+var rebuildWait = time.Minute
+
+// Index wraps an indexer.Interface and filters out lookups for multihashes
+// that are not indexed.
+type Index struct {
+	indexer.Interface
+
+	bloom     *bbloom.Bloom
+	expected  uint64
+	ready     chan struct{}
+	cancel    context.CancelFunc
+	buildDone chan struct{}
+
+	// negMutex protects the negative cache and the write counts.  The
+	// negative cache is kept as two generations; when the current generation
+	// is full, it becomes the previous generation and the oldest entries are
+	// dropped.
+	negMutex  sync.Mutex
+	negCur    map[string]struct{}
+	negPrev   map[string]struct{}
+	negSize   int
+	writing   int
+	writes    uint64
+	warnedFPR bool
+}
+
+var _ indexer.Interface = &Index{}
+
+// New creates an Index that wraps the given indexer.  The bloom filter is
+// built, in the background, from the multihashes already in the indexer.
+// Lookups are not filtered until the bloom filter is built.  If the indexer is
+// written to while the bloom filter is built, then it is built again later.
+func New(idxr indexer.Interface, cfg config.Prefilter) (*Index, error) {
+	bf, err := bbloom.New(float64(cfg.ExpectedMultihashes), cfg.FalsePositiveRate)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	x := &Index{
+		Interface: idxr,
+		bloom:     bf,
+		expected:  uint64(cfg.ExpectedMultihashes),
+		ready:     make(chan struct{}),
+		cancel:    cancel,
+		buildDone: make(chan struct{}),
+		negCur:    map[string]struct{}{},
+		negSize:   cfg.NegativeCacheSize,
+	}
+	go x.build(ctx)
+	return x, nil
+}
+
+// Ready returns a channel that is closed when the bloom filter is built.
+func (x *Index) Ready() <-chan struct{} {
+	return x.ready
+}
+
+// Get gets the values for a multihash.  If the multihash is certainly not
+// indexed, or was recently not found, then the wrapped indexer is not read.
+func (x *Index) Get(mh multihash.Multihash) ([]indexer.Value, bool, error) {
+	if !x.isReady() {
+		return x.Interface.Get(mh)
+	}
+
+	if !x.bloom.HasTS(mh) {
+		record(resultFiltered)
+		return nil, false, nil
+	}
+
+	x.negMutex.Lock()
+	cached := x.inNegative(mh)
+	writes := x.writes
+	x.negMutex.Unlock()
+	if cached {
+		record(resultCached)
+		return nil, false, nil
+	}
+
+	values, found, err := x.Interface.Get(mh)
+	if err != nil {
+		return nil, false, err
+	}
+	if found {
+		record(resultFound)
+		return values, true, nil
+	}
+	record(resultFalsePositive)
+
+	x.negMutex.Lock()
+	// Only remember the miss if nothing was written since the lookup, since
+	// the write may have indexed the multihash.
+	if x.writes == writes {
+		x.addNegative(mh)
+	}
+	x.negMutex.Unlock()
+	return nil, false, nil
+}
+
+// Put stores the value in the wrapped indexer, and adds the multihashes to the
+// bloom filter.
+func (x *Index) Put(value indexer.Value, mhs ...multihash.Multihash) error {
+	// Add to the bloom filter first, so that a concurrent lookup does not
+	// filter out a multihash after it is stored.
+	for _, mh := range mhs {
+		x.bloom.AddIfNotHasTS(mh)
+	}
+	x.checkFill()
+
+	x.beginWrite()
+	err := x.Interface.Put(value, mhs...)
+	x.negMutex.Lock()
+	x.endWrite()
+	for _, mh := range mhs {
+		delete(x.negCur, string(mh))
+		delete(x.negPrev, string(mh))
+	}
+	x.negMutex.Unlock()
+	return err
+}
+
+func (x *Index) Remove(value indexer.Value, mhs ...multihash.Multihash) error {
+	x.beginWrite()
+	defer x.lockedEndWrite()
+	return x.Interface.Remove(value, mhs...)
+}
+
+func (x *Index) RemoveProvider(providerID peer.ID) error {
+	x.beginWrite()
+	defer x.lockedEndWrite()
+	return x.Interface.RemoveProvider(providerID)
+}
+
+func (x *Index) RemoveProviderContext(providerID peer.ID, contextID []byte) error {
+	x.beginWrite()
+	defer x.lockedEndWrite()
+	return x.Interface.RemoveProviderContext(providerID, contextID)
+}
+
+// beginWrite records that a write to the wrapped indexer has started.
+func (x *Index) beginWrite() {
+	x.negMutex.Lock()
+	x.writing++
+	x.negMutex.Unlock()
+}
+
+// endWrite records that a write to the wrapped indexer has finished.  The
+// caller must hold negMutex.
+func (x *Index) endWrite() {
+	x.writing--
+	x.writes++
+}
+
+func (x *Index) lockedEndWrite() {
+	x.negMutex.Lock()
+	x.endWrite()
+	x.negMutex.Unlock()
+}
+
+// writeState returns the number of writes in progress and the number of
+// writes finished.
+func (x *Index) writeState() (int, uint64) {
+	x.negMutex.Lock()
+	defer x.negMutex.Unlock()
+	return x.writing, x.writes
+}
+
+// Close stops building the bloom filter and closes the wrapped indexer.
+func (x *Index) Close() error {
+	x.cancel()
+	<-x.buildDone
+	return x.Interface.Close()
+}
+
+// build adds all multihashes in the wrapped indexer to the bloom filter.  The
+// bloom filter is made ready once it is built with no writes to the wrapped
+// indexer while it is built, since a write may have made the iterator skip
+// multihashes.
+func (x *Index) build(ctx context.Context) {
+	defer close(x.buildDone)
+
+	for {
+		log.Info("Building bloom filter of indexed multihashes")
+		writing, writes := x.writeState()
+		count, err := x.addAll(ctx)
+		if err != nil {
+			log.Errorw("Cannot read indexed multihashes, prefilter disabled", "err", err)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		endWriting, endWrites := x.writeState()
+		if writing == 0 && endWriting == 0 && endWrites == writes {
+			x.checkFill()
+			close(x.ready)
+			log.Infow("Built bloom filter of indexed multihashes", "count", count)
+			return
+		}
+
+		log.Infow("Indexer written to while building bloom filter, building again later", "wait", rebuildWait)
+		t := time.NewTimer(rebuildWait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// addAll adds all multihashes in the wrapped indexer to the bloom filter, and
+// returns the number of multihashes read.
+func (x *Index) addAll(ctx context.Context) (int, error) {
+	iter, err := x.Interface.Iter()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for {
+		if count%10000 == 0 && ctx.Err() != nil {
+			return count, nil
+		}
+		mh, _, err := iter.Next()
+		if err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return count, err
+		}
+		x.bloom.AddIfNotHasTS(mh)
+		count++
+	}
+}
+
+func (x *Index) isReady() bool {
+	select {
+	case <-x.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkFill warns, once, when more multihashes are indexed than the bloom
+// filter was sized for.
+func (x *Index) checkFill() {
+	x.bloom.Mtx.RLock()
+	added := x.bloom.ElementsAdded()
+	x.bloom.Mtx.RUnlock()
+	if added <= x.expected {
+		return
+	}
+	x.negMutex.Lock()
+	defer x.negMutex.Unlock()
+	if !x.warnedFPR {
+		x.warnedFPR = true
+		log.Warnw("More multihashes indexed than bloom filter is sized for, false positive rate will increase", "expected", x.expected)
+	}
+}
+
+// inNegative returns true if the multihash is in the negative cache.  The
+// caller must hold negMutex.
+func (x *Index) inNegative(mh multihash.Multihash) bool {
+	if _, ok := x.negCur[string(mh)]; ok {
+		return true
+	}
+	_, ok := x.negPrev[string(mh)]
+	return ok
+}
+
+// addNegative adds the multihash to the negative cache.  The caller must hold
+// negMutex.
+func (x *Index) addNegative(mh multihash.Multihash) {
+	if x.negSize <= 0 {
+		return
+	}
+	if len(x.negCur) >= (x.negSize+1)/2 {
+		x.negPrev = x.negCur
+		x.negCur = map[string]struct{}{}
+	}
+	x.negCur[string(mh)] = struct{}{}
+}
+
+func record(result string) {
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Result, result)),
+		stats.WithMeasurements(metrics.FindPrefilter.M(1)))
+}
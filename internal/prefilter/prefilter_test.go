@@ -0,0 +1,220 @@
+package prefilter
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+const providerID = "12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA"
+
+// countingStore counts the lookups that reach the value store.
+type countingStore struct {
+	indexer.Interface
+	gets int
+}
+
+func (s *countingStore) Get(mh multihash.Multihash) ([]indexer.Value, bool, error) {
+	s.gets++
+	return s.Interface.Get(mh)
+}
+
+func TestPrefilter(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: []byte("metadata"),
+	}
+	mhs := util.RandomMultihashes(20)
+
+	// Content indexed before starting is added to the bloom filter.
+	store := &countingStore{Interface: memory.New()}
+	if err = store.Put(value, mhs[:10]...); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := New(store, config.Prefilter{
+		ExpectedMultihashes: 1000,
+		FalsePositiveRate:   0.001,
+		NegativeCacheSize:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	select {
+	case <-x.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for bloom filter to be built")
+	}
+
+	for _, mh := range mhs[:10] {
+		if !found(t, x, mh) {
+			t.Fatal("indexed multihash not found")
+		}
+	}
+
+	// Misses do not read the value store.
+	store.gets = 0
+	for _, mh := range mhs[10:] {
+		if found(t, x, mh) {
+			t.Fatal("found multihash that is not indexed")
+		}
+	}
+	if store.gets != 0 {
+		t.Fatalf("expected no value store reads for misses, got %d", store.gets)
+	}
+
+	// Newly indexed content is found.
+	if err = x.Put(value, mhs[10]); err != nil {
+		t.Fatal(err)
+	}
+	if !found(t, x, mhs[10]) {
+		t.Fatal("newly indexed multihash not found")
+	}
+
+	// A removed multihash is still in the bloom filter.  After the first miss
+	// it is answered from the negative cache.
+	if err = x.Remove(value, mhs[10]); err != nil {
+		t.Fatal(err)
+	}
+	store.gets = 0
+	for i := 0; i < 3; i++ {
+		if found(t, x, mhs[10]) {
+			t.Fatal("found removed multihash")
+		}
+	}
+	if store.gets != 1 {
+		t.Fatalf("expected 1 value store read, got %d", store.gets)
+	}
+
+	// Indexing the multihash again removes it from the negative cache.
+	if err = x.Put(value, mhs[10]); err != nil {
+		t.Fatal(err)
+	}
+	if !found(t, x, mhs[10]) {
+		t.Fatal("re-indexed multihash not found")
+	}
+}
+
+// invalidatedStore has an iterator that waits until it is released, and then
+// ends without returning anything the first time, as if invalidated by a
+// write.
+type invalidatedStore struct {
+	indexer.Interface
+	started chan struct{}
+	release chan struct{}
+	iters   int
+}
+
+func (s *invalidatedStore) Iter() (indexer.Iterator, error) {
+	s.iters++
+	if s.iters > 1 {
+		return s.Interface.Iter()
+	}
+	close(s.started)
+	return &invalidatedIter{release: s.release}, nil
+}
+
+type invalidatedIter struct {
+	release chan struct{}
+}
+
+func (it *invalidatedIter) Next() (multihash.Multihash, []indexer.Value, error) {
+	<-it.release
+	return nil, nil, io.EOF
+}
+
+func TestWriteDuringBuild(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx"),
+		MetadataBytes: []byte("metadata"),
+	}
+	mhs := util.RandomMultihashes(2)
+	store := &invalidatedStore{
+		Interface: memory.New(),
+		started:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	if err = store.Put(value, mhs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	saveWait := rebuildWait
+	rebuildWait = 100 * time.Millisecond
+	defer func() { rebuildWait = saveWait }()
+
+	x, err := New(store, config.Prefilter{
+		ExpectedMultihashes: 1000,
+		FalsePositiveRate:   0.001,
+		NegativeCacheSize:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+
+	// A write while the bloom filter is built means that the build may have
+	// missed multihashes, so the bloom filter is not used.
+	<-store.started
+	if err = x.Put(value, mhs[1]); err != nil {
+		t.Fatal(err)
+	}
+	close(store.release)
+	if !found(t, x, mhs[0]) {
+		t.Fatal("indexed multihash missed by bloom filter build not found")
+	}
+
+	// The bloom filter is built again, without writes, and then used.
+	select {
+	case <-x.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for bloom filter to be built again")
+	}
+	for _, mh := range mhs {
+		if !found(t, x, mh) {
+			t.Fatal("indexed multihash not found")
+		}
+	}
+}
+
+func TestNegativeCacheBounded(t *testing.T) {
+	x := &Index{negCur: map[string]struct{}{}, negSize: 4}
+	mhs := util.RandomMultihashes(10)
+	for _, mh := range mhs {
+		x.addNegative(mh)
+	}
+	if n := len(x.negCur) + len(x.negPrev); n > 4 {
+		t.Fatalf("negative cache has %d entries, max is 4", n)
+	}
+	if !x.inNegative(mhs[9]) {
+		t.Fatal("most recent miss not in negative cache")
+	}
+	if x.inNegative(mhs[0]) {
+		t.Fatal("oldest miss still in negative cache")
+	}
+}
+
+func found(t *testing.T, x *Index, mh multihash.Multihash) bool {
+	_, ok, err := x.Get(mh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
@@ -0,0 +1,442 @@
+// Package providerindex maintains a secondary index of the content indexed for
+// each provider.  This allows listing the context IDs indexed for a provider
+// and the multihashes indexed for each context ID.
+package providerindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/gammazero/keymutex"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	// contextKeyPath is where a record for each provider context is stored.
+	contextKeyPath = "/provindex/ctx"
+	// multihashKeyPath is where each multihash for a provider context is
+	// stored.
+	multihashKeyPath = "/provindex/mh"
+)
+
+var log = logging.Logger("indexer/provindex")
+
+// Index wraps an indexer.Interface and records each Put and Remove in a
+// secondary per-provider index, kept in a datastore.  Changes to the index of
+// one provider are serialized, and changes for different providers are made
+// concurrently.
+type Index struct {
+	indexer.Interface
+	ds      datastore.Batching
+	provLks *keymutex.KeyMutex
+}
+
+// ContextInfo describes a context indexed for a provider.
+type ContextInfo struct {
+	// ContextID identifies the context.
+	ContextID []byte
+	// MetadataBytes is the most recent serialized metadata for the context.
+	MetadataBytes []byte
+	// Count is the number of multihashes indexed for the context.
+	Count uint64
+}
+
+// Counter is implemented by indexers that report how many multihashes each
+// put or remove changes in the provider index.  An indexer that wraps an
+// Index implements Counter to pass the counts along.
+type Counter interface {
+	// PutCount is Put, and also returns the number of multihashes that were
+	// not already indexed for the value's provider and context.
+	PutCount(indexer.Value, ...multihash.Multihash) (int, error)
+	// RemoveCount is Remove, and also returns the number of multihashes that
+	// were removed from the value's provider and context.
+	RemoveCount(indexer.Value, ...multihash.Multihash) (int, error)
+	// RemoveProviderContextCount is RemoveProviderContext, and also returns
+	// the number of multihashes that were indexed for the context.
+	RemoveProviderContextCount(peer.ID, []byte) (int, error)
+}
+
+var (
+	_ indexer.Interface = &Index{}
+	_ Counter           = &Index{}
+)
+
+// CountPut puts the multihashes in the indexer, and returns the number of
+// multihashes newly indexed.  If the indexer is not a Counter, then all
+// multihashes put are counted.
+func CountPut(idxr indexer.Interface, value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	if c, ok := idxr.(Counter); ok {
+		return c.PutCount(value, mhs...)
+	}
+	if err := idxr.Put(value, mhs...); err != nil {
+		return 0, err
+	}
+	return len(mhs), nil
+}
+
+// CountRemove removes the multihashes from the indexer, and returns the
+// number of multihashes removed.  If the indexer is not a Counter, then all
+// multihashes removed are counted.
+func CountRemove(idxr indexer.Interface, value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	if c, ok := idxr.(Counter); ok {
+		return c.RemoveCount(value, mhs...)
+	}
+	if err := idxr.Remove(value, mhs...); err != nil {
+		return 0, err
+	}
+	return len(mhs), nil
+}
+
+// CountRemoveProviderContext removes the provider context from the indexer,
+// and returns the number of multihashes that were indexed for the context.
+// If the indexer is not a Counter, then the number is not known and 0 is
+// returned.
+func CountRemoveProviderContext(idxr indexer.Interface, providerID peer.ID, contextID []byte) (int, error) {
+	if c, ok := idxr.(Counter); ok {
+		return c.RemoveProviderContextCount(providerID, contextID)
+	}
+	return 0, idxr.RemoveProviderContext(providerID, contextID)
+}
+
+// New creates a new Index that wraps the given indexer.  The datastore holds
+// the secondary index.
+func New(idxr indexer.Interface, ds datastore.Batching) *Index {
+	return &Index{
+		Interface: idxr,
+		ds:        ds,
+		provLks:   keymutex.New(0),
+	}
+}
+
+// EncodeContextID encodes a context ID as a multibase string suitable for use
+// in a URL path.
+func EncodeContextID(contextID []byte) string {
+	s, _ := multibase.Encode(multibase.Base64url, contextID)
+	return s
+}
+
+// DecodeContextID decodes a context ID encoded as a multibase string.
+func DecodeContextID(s string) ([]byte, error) {
+	_, data, err := multibase.Decode(s)
+	return data, err
+}
+
+// Put stores the value in the wrapped indexer and records the multihashes
+// for the value's provider and context.  A multihash is counted once for the
+// context, however many times it is put.
+func (x *Index) Put(value indexer.Value, mhs ...multihash.Multihash) error {
+	_, err := x.PutCount(value, mhs...)
+	return err
+}
+
+// PutCount is Put, and also returns the number of multihashes that were not
+// already indexed for the value's provider and context.
+func (x *Index) PutCount(value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	err := x.Interface.Put(value, mhs...)
+	if err != nil {
+		return 0, err
+	}
+	if len(mhs) == 0 {
+		return 0, nil
+	}
+
+	x.provLks.Lock(string(value.ProviderID))
+	defer x.provLks.Unlock(string(value.ProviderID))
+
+	info, err := x.getContext(value.ProviderID, value.ContextID)
+	if err != nil {
+		return 0, err
+	}
+	if info == nil {
+		info = &ContextInfo{
+			ContextID: value.ContextID,
+		}
+	}
+	info.MetadataBytes = value.MetadataBytes
+
+	batch, err := x.ds.Batch()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, key := range uniqueKeys(value, mhs) {
+		has, err := x.ds.Has(key)
+		if err != nil {
+			return 0, err
+		}
+		if has {
+			continue
+		}
+		if err = batch.Put(key, []byte{}); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	info.Count += uint64(count)
+	if err = putContext(batch, value.ProviderID, info); err != nil {
+		return 0, err
+	}
+	if err = batch.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Remove removes the value from the wrapped indexer and removes the
+// multihashes from the value's provider and context.
+func (x *Index) Remove(value indexer.Value, mhs ...multihash.Multihash) error {
+	_, err := x.RemoveCount(value, mhs...)
+	return err
+}
+
+// RemoveCount is Remove, and also returns the number of multihashes that were
+// removed from the value's provider and context.
+func (x *Index) RemoveCount(value indexer.Value, mhs ...multihash.Multihash) (int, error) {
+	err := x.Interface.Remove(value, mhs...)
+	if err != nil {
+		return 0, err
+	}
+	if len(mhs) == 0 {
+		return 0, nil
+	}
+
+	x.provLks.Lock(string(value.ProviderID))
+	defer x.provLks.Unlock(string(value.ProviderID))
+
+	info, err := x.getContext(value.ProviderID, value.ContextID)
+	if err != nil {
+		return 0, err
+	}
+	if info == nil {
+		return 0, nil
+	}
+
+	batch, err := x.ds.Batch()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, key := range uniqueKeys(value, mhs) {
+		has, err := x.ds.Has(key)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			continue
+		}
+		if err = batch.Delete(key); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	info.Count -= uint64(count)
+	if info.Count == 0 {
+		err = batch.Delete(contextKey(value.ProviderID, value.ContextID))
+	} else {
+		err = putContext(batch, value.ProviderID, info)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err = batch.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RemoveProvider removes all values for the provider from the wrapped indexer
+// and removes all of the provider's contexts.
+func (x *Index) RemoveProvider(providerID peer.ID) error {
+	err := x.Interface.RemoveProvider(providerID)
+	if err != nil {
+		return err
+	}
+
+	x.provLks.Lock(string(providerID))
+	defer x.provLks.Unlock(string(providerID))
+
+	err = x.deletePrefix(path.Join(multihashKeyPath, providerID.String()))
+	if err != nil {
+		return err
+	}
+	return x.deletePrefix(path.Join(contextKeyPath, providerID.String()))
+}
+
+// RemoveProviderContext removes all values for the provider context from the
+// wrapped indexer, and removes the context from the provider's contexts.
+func (x *Index) RemoveProviderContext(providerID peer.ID, contextID []byte) error {
+	_, err := x.RemoveProviderContextCount(providerID, contextID)
+	return err
+}
+
+// RemoveProviderContextCount is RemoveProviderContext, and also returns the
+// number of multihashes that were indexed for the context.
+func (x *Index) RemoveProviderContextCount(providerID peer.ID, contextID []byte) (int, error) {
+	err := x.Interface.RemoveProviderContext(providerID, contextID)
+	if err != nil {
+		return 0, err
+	}
+
+	x.provLks.Lock(string(providerID))
+	defer x.provLks.Unlock(string(providerID))
+
+	info, err := x.getContext(providerID, contextID)
+	if err != nil {
+		return 0, err
+	}
+	if info == nil {
+		return 0, nil
+	}
+	err = x.deletePrefix(path.Join(multihashKeyPath, providerID.String(), EncodeContextID(contextID)))
+	if err != nil {
+		return 0, err
+	}
+	err = x.ds.Delete(contextKey(providerID, contextID))
+	if err != nil && err != datastore.ErrNotFound {
+		return 0, err
+	}
+	return int(info.Count), nil
+}
+
+// Contexts returns information about all contexts indexed for a provider.
+func (x *Index) Contexts(providerID peer.ID) ([]ContextInfo, error) {
+	q := query.Query{
+		Prefix: path.Join(contextKeyPath, providerID.String()),
+		Orders: []query.Order{query.OrderByKey{}},
+	}
+	results, err := x.ds.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var infos []ContextInfo
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, fmt.Errorf("cannot read context info: %s", result.Error)
+		}
+		var info ContextInfo
+		if err = json.Unmarshal(result.Entry.Value, &info); err != nil {
+			return nil, fmt.Errorf("cannot decode context info: %s", err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Context returns information about a single context indexed for a
+// provider, or nil if the context is not indexed.
+func (x *Index) Context(providerID peer.ID, contextID []byte) (*ContextInfo, error) {
+	return x.getContext(providerID, contextID)
+}
+
+// Multihashes returns up to limit multihashes indexed for the provider
+// context, skipping the first offset multihashes.  A limit of 0 means no
+// limit.
+func (x *Index) Multihashes(providerID peer.ID, contextID []byte, offset, limit int) ([]multihash.Multihash, error) {
+	q := query.Query{
+		Prefix:   path.Join(multihashKeyPath, providerID.String(), EncodeContextID(contextID)),
+		Orders:   []query.Order{query.OrderByKey{}},
+		Offset:   offset,
+		Limit:    limit,
+		KeysOnly: true,
+	}
+	results, err := x.ds.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var mhs []multihash.Multihash
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, fmt.Errorf("cannot read multihash: %s", result.Error)
+		}
+		mh, err := multihash.FromB58String(path.Base(result.Entry.Key))
+		if err != nil {
+			log.Errorw("Bad multihash in provider index", "key", result.Entry.Key, "err", err)
+			continue
+		}
+		mhs = append(mhs, mh)
+	}
+	return mhs, nil
+}
+
+func (x *Index) getContext(providerID peer.ID, contextID []byte) (*ContextInfo, error) {
+	data, err := x.ds.Get(contextKey(providerID, contextID))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	info := new(ContextInfo)
+	if err = json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("cannot decode context info: %s", err)
+	}
+	return info, nil
+}
+
+func (x *Index) deletePrefix(prefix string) error {
+	q := query.Query{
+		Prefix:   prefix,
+		KeysOnly: true,
+	}
+	results, err := x.ds.Query(q)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	batch, err := x.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		if err = batch.Delete(datastore.NewKey(result.Entry.Key)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// uniqueKeys returns the multihash keys for the value's provider and context,
+// leaving out any multihash that is repeated.
+func uniqueKeys(value indexer.Value, mhs []multihash.Multihash) []datastore.Key {
+	keys := make([]datastore.Key, 0, len(mhs))
+	seen := make(map[string]struct{}, len(mhs))
+	for _, mh := range mhs {
+		if _, ok := seen[string(mh)]; ok {
+			continue
+		}
+		seen[string(mh)] = struct{}{}
+		keys = append(keys, multihashKey(value.ProviderID, value.ContextID, mh))
+	}
+	return keys
+}
+
+func putContext(batch datastore.Batch, providerID peer.ID, info *ContextInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return batch.Put(contextKey(providerID, info.ContextID), data)
+}
+
+func contextKey(providerID peer.ID, contextID []byte) datastore.Key {
+	return datastore.NewKey(path.Join(contextKeyPath, providerID.String(), EncodeContextID(contextID)))
+}
+
+func multihashKey(providerID peer.ID, contextID []byte, mh multihash.Multihash) datastore.Key {
+	return datastore.NewKey(path.Join(multihashKeyPath, providerID.String(), EncodeContextID(contextID), mh.B58String()))
+}
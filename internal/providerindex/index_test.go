@@ -0,0 +1,186 @@
+package providerindex
+
+import (
+	"bytes"
+	"testing"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const providerID = "12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA"
+
+func TestPutRemove(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := New(memory.New(), dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	value1 := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx1"),
+		MetadataBytes: []byte("meta1"),
+	}
+	value2 := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx2"),
+		MetadataBytes: []byte("meta2"),
+	}
+
+	mhs := util.RandomMultihashes(20)
+	if err = idx.Put(value1, mhs[:10]...); err != nil {
+		t.Fatal(err)
+	}
+	// Putting the same multihashes again should not change the count.
+	if err = idx.Put(value1, mhs[:10]...); err != nil {
+		t.Fatal(err)
+	}
+	if err = idx.Put(value2, mhs[10:]...); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := idx.Contexts(provID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 contexts, got %d", len(infos))
+	}
+	for _, info := range infos {
+		if info.Count != 10 {
+			t.Fatalf("expected 10 multihashes for context %q, got %d", info.ContextID, info.Count)
+		}
+	}
+
+	// Get all multihashes in pages.
+	var all int
+	for offset := 0; ; offset += 3 {
+		page, err := idx.Multihashes(provID, value1.ContextID, offset, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		all += len(page)
+	}
+	if all != 10 {
+		t.Fatalf("expected 10 multihashes, got %d", all)
+	}
+
+	if err = idx.Remove(value1, mhs[:5]...); err != nil {
+		t.Fatal(err)
+	}
+	info, err := idx.Context(provID, value1.ContextID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Count != 5 {
+		t.Fatalf("expected 5 multihashes after remove, got %d", info.Count)
+	}
+	if !bytes.Equal(info.MetadataBytes, value1.MetadataBytes) {
+		t.Fatal("wrong metadata for context")
+	}
+
+	n, err := idx.RemoveProviderContextCount(provID, value1.ContextID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 multihashes removed with context, got %d", n)
+	}
+	info, err = idx.Context(provID, value1.ContextID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != nil {
+		t.Fatal("context should have been removed")
+	}
+	page, err := idx.Multihashes(provID, value1.ContextID, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 0 {
+		t.Fatal("multihashes should have been removed")
+	}
+
+	if err = idx.RemoveProvider(provID); err != nil {
+		t.Fatal(err)
+	}
+	infos, err = idx.Contexts(provID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Fatal("provider contexts should have been removed")
+	}
+}
+
+func TestPutDuplicateAndEmpty(t *testing.T) {
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := New(memory.New(), dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	value := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("ctx1"),
+		MetadataBytes: []byte("meta1"),
+	}
+
+	// Putting no multihashes does not record a context.
+	if err = idx.Put(value); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := idx.Contexts(provID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Fatalf("expected no contexts, got %d", len(infos))
+	}
+
+	// A multihash repeated in one put is counted once.
+	mhs := util.RandomMultihashes(3)
+	if err = idx.Put(value, mhs[0], mhs[1], mhs[0], mhs[2], mhs[1]); err != nil {
+		t.Fatal(err)
+	}
+	info, err := idx.Context(provID, value.ContextID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Count != 3 {
+		t.Fatalf("expected 3 multihashes, got %d", info.Count)
+	}
+
+	// A multihash repeated in one remove is removed once.
+	if err = idx.Remove(value, mhs[0], mhs[0]); err != nil {
+		t.Fatal(err)
+	}
+	info, err = idx.Context(provID, value.ContextID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Count != 2 {
+		t.Fatalf("expected 2 multihashes after remove, got %d", info.Count)
+	}
+}
+
+func TestEncodeContextID(t *testing.T) {
+	for _, ctxID := range [][]byte{nil, []byte("a/b"), {0, 0xff, 0x10}} {
+		s := EncodeContextID(ctxID)
+		decoded, err := DecodeContextID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, ctxID) {
+			t.Fatalf("decoded context id %x does not match %x", decoded, ctxID)
+		}
+	}
+}
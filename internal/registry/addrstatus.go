@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// AddrStatus is the result of the latest probe of a provider address.
+type AddrStatus struct {
+	// Addr is the provider address that was probed.
+	Addr multiaddr.Multiaddr
+	// Reachable is true if a connection to the provider was made at Addr.
+	Reachable bool
+	// RTT is the time it took to connect to the provider, including the
+	// secure channel handshake, if the address is reachable.
+	RTT time.Duration
+	// Probed is when the address was probed.
+	Probed time.Time
+	// Error is the reason that the address is not reachable.
+	Error string
+}
+
+// AddrStatus returns the result of the latest probe of one of the provider's
+// addresses, and false if the address has not been probed.
+func (p *ProviderInfo) AddrStatus(addr multiaddr.Multiaddr) (AddrStatus, bool) {
+	status, ok := p.addrStatus[string(addr.Bytes())]
+	return status, ok
+}
+
+// RecordAddrStatus records the results of probing some of a registered
+// provider's addresses.  Results for addresses that the provider no longer has
+// are ignored.  A reachable address counts as contact with the provider.  The
+// results are visible to readers once RecordAddrStatus returns.
+func (r *Registry) RecordAddrStatus(providerID peer.ID, statuses []AddrStatus) {
+	done := make(chan struct{})
+	r.actions <- func() {
+		defer close(done)
+		info, ok := r.loadProviders()[providerID]
+		if !ok {
+			return
+		}
+		// Replace the ProviderInfo, since existing instances are never modified.
+		newInfo := *info
+		newInfo.addrStatus = make(map[string]AddrStatus, len(info.AddrInfo.Addrs))
+		for _, addr := range info.AddrInfo.Addrs {
+			key := string(addr.Bytes())
+			if status, ok := info.addrStatus[key]; ok {
+				newInfo.addrStatus[key] = status
+			}
+		}
+		for _, status := range statuses {
+			if !containsAddr(info.AddrInfo.Addrs, status.Addr) {
+				continue
+			}
+			newInfo.addrStatus[string(status.Addr.Bytes())] = status
+			if status.Reachable && status.Probed.After(newInfo.lastContactTime) {
+				newInfo.lastContactTime = status.Probed
+			}
+		}
+		r.syncSetProvider(&newInfo)
+	}
+	<-done
+}
+
+func containsAddr(addrs []multiaddr.Multiaddr, addr multiaddr.Multiaddr) bool {
+	for _, a := range addrs {
+		if a.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package discovery
 
 import (
 	"context"
+	"errors"
 
 	"github.com/libp2p/go-libp2p-core/peer"
 )
@@ -10,8 +11,15 @@ const (
 	// Provider types
 	OtherType = iota
 	MinerType
+	// DomainType is a provider discovered by its signed record published
+	// at its domain.
+	DomainType
 )
 
+// ErrProviderMismatch is returned by a Discoverer when the discovery address
+// belongs to a provider other than the one being discovered.
+var ErrProviderMismatch = errors.New("provider id mismatch")
+
 // Discoverer is the interface that supplies functionality to discover providers
 type Discoverer interface {
 	Discover(ctx context.Context, peerID peer.ID, discoveryAddr string) (*Discovered, error)
@@ -22,3 +30,15 @@ type Discovered struct {
 	AddrInfo peer.AddrInfo
 	Type     int
 }
+
+// TypeName returns the name of a provider type.
+func TypeName(t int) string {
+	switch t {
+	case MinerType:
+		return "miner"
+	case DomainType:
+		return "domain"
+	default:
+		return "other"
+	}
+}
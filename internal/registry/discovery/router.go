@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/filecoin-project/storetheindex/internal/syserr"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Schemes of discovery addresses, which select the discovery method.
+const (
+	// SchemeFil is for the address of a Filecoin miner, such as "fil:f01234".
+	SchemeFil = "fil"
+	// SchemePeer is for a libp2p multiaddr of the provider, such as
+	// "peer:/ip4/1.2.3.4/tcp/3003".
+	SchemePeer = "peer"
+	// SchemeDNS is for the domain of a provider that publishes a signed
+	// provider record, such as "dns:provider.example.com".
+	SchemeDNS = "dns"
+)
+
+// Router is a Discoverer that sends each discovery address to the Discoverer
+// for the address scheme.  The scheme is the part of the address before the
+// first colon, and is removed from the address that is given to the
+// Discoverer.  Addresses without a scheme go to the default Discoverer.
+type Router struct {
+	discoverers   map[string]Discoverer
+	defaultScheme string
+}
+
+// NewRouter creates a new Router with no Discoverers.
+func NewRouter() *Router {
+	return &Router{
+		discoverers: map[string]Discoverer{},
+	}
+}
+
+// Add sets the Discoverer for discovery addresses with the given scheme.  The
+// first scheme added is the default for addresses that have no scheme.
+func (r *Router) Add(scheme string, d Discoverer) {
+	if r.defaultScheme == "" {
+		r.defaultScheme = scheme
+	}
+	r.discoverers[scheme] = d
+}
+
+// Len returns the number of schemes that have a Discoverer.
+func (r *Router) Len() int {
+	return len(r.discoverers)
+}
+
+// Discover discovers the provider using the Discoverer for the scheme of
+// discoveryAddr.
+func (r *Router) Discover(ctx context.Context, peerID peer.ID, discoveryAddr string) (*Discovered, error) {
+	scheme, addr := SplitAddr(discoveryAddr)
+	if scheme == "" {
+		scheme = r.defaultScheme
+	}
+	d, ok := r.discoverers[scheme]
+	if !ok {
+		err := fmt.Errorf("no discovery method for address scheme %q", scheme)
+		return nil, syserr.New(err, http.StatusBadRequest)
+	}
+	return d.Discover(ctx, peerID, addr)
+}
+
+// SplitAddr splits a discovery address into its scheme and the remaining
+// address.  The scheme is empty if the address does not have one.
+func SplitAddr(discoveryAddr string) (string, string) {
+	i := strings.IndexByte(discoveryAddr, ':')
+	if i <= 0 || !isScheme(discoveryAddr[:i]) {
+		return "", discoveryAddr
+	}
+	return strings.ToLower(discoveryAddr[:i]), discoveryAddr[i+1:]
+}
+
+// isScheme checks that s has the syntax of a URI scheme, so that addresses
+// such as multiaddrs, which may contain colons, are not taken to have one.
+func isScheme(s string) bool {
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i != 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
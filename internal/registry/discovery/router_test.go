@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+type recordDiscoverer struct {
+	addrs []string
+}
+
+func (d *recordDiscoverer) Discover(ctx context.Context, peerID peer.ID, addr string) (*Discovered, error) {
+	d.addrs = append(d.addrs, addr)
+	return &Discovered{AddrInfo: peer.AddrInfo{ID: peerID}}, nil
+}
+
+func TestRouter(t *testing.T) {
+	fil := &recordDiscoverer{}
+	p2p := &recordDiscoverer{}
+	router := NewRouter()
+	router.Add(SchemeFil, fil)
+	router.Add(SchemePeer, p2p)
+
+	ctx := context.Background()
+	for _, addr := range []string{"fil:f01234", "f05678", "FIL:t01000", "peer:/ip4/127.0.0.1/tcp/3003", "/ip6/::1/tcp/3003"} {
+		if _, err := router.Discover(ctx, "", addr); err != nil {
+			t.Fatalf("cannot discover %q: %s", addr, err)
+		}
+	}
+	expectAddrs(t, fil.addrs, "f01234", "f05678", "t01000", "/ip6/::1/tcp/3003")
+	expectAddrs(t, p2p.addrs, "/ip4/127.0.0.1/tcp/3003")
+
+	if _, err := router.Discover(ctx, "", "dns:provider.example.com"); err == nil {
+		t.Fatal("expected error for scheme without discoverer")
+	}
+}
+
+func TestSplitAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		scheme string
+		rest   string
+	}{
+		{"fil:f01234", "fil", "f01234"},
+		{"f01234", "", "f01234"},
+		{"Peer:/ip4/1.2.3.4/tcp/1", "peer", "/ip4/1.2.3.4/tcp/1"},
+		{"/ip6/::1/tcp/1", "", "/ip6/::1/tcp/1"},
+		{":f01234", "", ":f01234"},
+		{"1a:b", "", "1a:b"},
+	}
+	for _, test := range tests {
+		scheme, rest := SplitAddr(test.addr)
+		if scheme != test.scheme || rest != test.rest {
+			t.Errorf("SplitAddr(%q) = %q, %q; expected %q, %q", test.addr, scheme, rest, test.scheme, test.rest)
+		}
+	}
+}
+
+func expectAddrs(t *testing.T, addrs []string, expect ...string) {
+	t.Helper()
+	if len(addrs) != len(expect) {
+		t.Fatalf("expected addresses %v, got %v", expect, addrs)
+	}
+	for i := range addrs {
+		if addrs[i] != expect[i] {
+			t.Fatalf("expected addresses %v, got %v", expect, addrs)
+		}
+	}
+}
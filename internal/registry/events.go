@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Types of registry events.
+const (
+	// EventRegistered is published when a new provider is registered.
+	EventRegistered = "registered"
+	// EventAddrChanged is published when a provider's addresses change.
+	EventAddrChanged = "addrChanged"
+	// EventNewAdvertisement is published when a new advertisement from a
+	// provider is ingested.
+	EventNewAdvertisement = "newAdvertisement"
+	// EventRemoved is published when a provider is removed from the registry.
+	EventRemoved = "removed"
+	// EventDiscoveryFailed is published when a provider cannot be discovered,
+	// or when re-verification finds that it no longer matches its discovery
+	// address.
+	EventDiscoveryFailed = "discoveryFailed"
+)
+
+// defaultEventBuffer is the number of events buffered for a subscriber when
+// Subscribe is not given a buffer size.
+const defaultEventBuffer = 64
+
+// Event is a change to the registry.
+type Event struct {
+	// Type is the type of change.
+	Type string
+	// ProviderID is the provider that changed.
+	ProviderID peer.ID
+	// Time is when the change happened.
+	Time time.Time
+	// Provider is the provider's new information.  It is not set for removed
+	// providers or failed discoveries.
+	Provider *ProviderInfo `json:",omitempty"`
+	// DiscoveryAddr is the discovery address of a failed discovery.
+	DiscoveryAddr string `json:",omitempty"`
+	// Error is the reason that discovery failed.
+	Error string `json:",omitempty"`
+}
+
+// eventBus delivers registry events to subscribers.  Events are published on
+// the registry's goroutine, and subscribers may come and go from any
+// goroutine.
+type eventBus struct {
+	lock   sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+// Subscribe returns a channel on which the registry sends each event, and a
+// function to cancel the subscription.  The channel buffers bufSize events, or
+// a default number if bufSize is not positive.  A subscriber that does not
+// keep up is unsubscribed, and its channel closed, rather than holding up the
+// registry.  The channel is also closed when the subscription is canceled or
+// the registry is closed.
+func (r *Registry) Subscribe(bufSize int) (<-chan Event, func()) {
+	if bufSize <= 0 {
+		bufSize = defaultEventBuffer
+	}
+	ch := make(chan Event, bufSize)
+	bus := &r.events
+
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	if bus.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if bus.subs == nil {
+		bus.subs = map[chan Event]struct{}{}
+	}
+	bus.subs[ch] = struct{}{}
+
+	return ch, func() {
+		bus.lock.Lock()
+		defer bus.lock.Unlock()
+		if _, ok := bus.subs[ch]; ok {
+			delete(bus.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *eventBus) publish(ev Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			log.Warnw("Dropping registry event subscriber that is not keeping up", "buffer", cap(ch))
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *eventBus) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+	b.closed = true
+}
+
+// syncPublishChanges publishes the events for replacing the old information
+// about a provider, which is nil for a new provider, with info.
+func (r *Registry) syncPublishChanges(old, info *ProviderInfo) {
+	now := time.Now()
+	ev := Event{
+		ProviderID: info.AddrInfo.ID,
+		Time:       now,
+		Provider:   info,
+	}
+	if old == nil {
+		ev.Type = EventRegistered
+		r.events.publish(ev)
+		if info.LastAdvertisement != cid.Undef {
+			ev.Type = EventNewAdvertisement
+			r.events.publish(ev)
+		}
+		return
+	}
+	if !addrsEqual(old.AddrInfo.Addrs, info.AddrInfo.Addrs) {
+		ev.Type = EventAddrChanged
+		r.events.publish(ev)
+	}
+	if info.LastAdvertisement != cid.Undef && info.LastAdvertisement != old.LastAdvertisement {
+		ev.Type = EventNewAdvertisement
+		r.events.publish(ev)
+	}
+}
+
+func (r *Registry) syncPublishRemoved(providerID peer.ID) {
+	r.events.publish(Event{
+		Type:       EventRemoved,
+		ProviderID: providerID,
+		Time:       time.Now(),
+	})
+}
+
+func (r *Registry) syncPublishDiscoveryFailed(providerID peer.ID, discoAddr string, err error) {
+	r.events.publish(Event{
+		Type:          EventDiscoveryFailed,
+		ProviderID:    providerID,
+		Time:          time.Now(),
+		DiscoveryAddr: discoAddr,
+		Error:         err.Error(),
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/filecoin-project/storetheindex/config"
@@ -21,6 +22,7 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multicodec"
 	"go.opencensus.io/stats"
 )
 
@@ -37,9 +39,19 @@ type Registry struct {
 	closed    chan struct{}
 	closeOnce sync.Once
 	dstore    datastore.Datastore
-	providers map[peer.ID]*ProviderInfo
 	sequences *sequences
 
+	// providers holds a providerMap.  Reads load the current map without
+	// waiting for the registry's goroutine.  Only the registry's goroutine
+	// replaces the map.
+	providers atomic.Value
+
+	// pending holds the sync results and index counts recorded for each
+	// provider since they were last applied by the registry's goroutine.
+	pending      map[peer.ID]*pendingRecord
+	pendingLock  sync.Mutex
+	pendingReady chan struct{}
+
 	discoverer discovery.Discoverer
 	discoWait  sync.WaitGroup
 	discoTimes map[string]time.Time
@@ -48,10 +60,31 @@ type Registry struct {
 	discoveryTimeout time.Duration
 	pollInterval     time.Duration
 	rediscoverWait   time.Duration
+	reverifyInterval time.Duration
+	removeUnverified bool
+
+	periodicTimer  *time.Timer
+	reverifyCancel context.CancelFunc
+	reverifyDone   chan struct{}
+	registerHooks  []func(*ProviderInfo)
+	removeHooks    []func(peer.ID)
+	events         eventBus
+}
 
-	periodicTimer *time.Timer
+// pendingRecord is what has been recorded about a provider's syncs and indexed
+// content, and is not yet applied to its ProviderInfo.
+type pendingRecord struct {
+	synced    bool
+	syncTime  time.Time
+	syncErr   error
+	indexed   int64
+	protocols []multicodec.Code
 }
 
+// providerMap maps provider IDs to their information.  A providerMap is never
+// modified once it is stored in the registry.
+type providerMap map[peer.ID]*ProviderInfo
+
 // ProviderInfo is an immutable data sturcture that holds information about a
 // provider.  A ProviderInfo instance is never modified, but rather a new one
 // is created to update its contents.  This means existing references remain
@@ -65,8 +98,54 @@ type ProviderInfo struct {
 	LastAdvertisement cid.Cid
 	// LastAdvertisementTime is the time the latest advertisement was received.
 	LastAdvertisementTime time.Time
+	// Codecs lists the IPLD codecs of the content the provider serves, if the
+	// provider has advertised them.  Find requests that select codecs do not
+	// filter out providers that have no codecs.
+	Codecs []multicodec.Code `json:",omitempty"`
+	// Type is the discovery.Discovered type of a discovered provider.
+	Type int `json:",omitempty"`
+	// FirstSeen is the time the provider was first registered.
+	FirstSeen time.Time
+	// AdCount is the number of the provider's advertisements ingested.
+	AdCount uint64 `json:",omitempty"`
+	// IndexCount is the number of multihashes indexed for the provider by
+	// ingesting its advertisements on this indexer.  It is kept equal to the
+	// sum of the multihash counts of the provider's contexts in the provider
+	// index, from the counts of multihashes that each put adds and each
+	// removal, of multihashes or of a whole context, takes away.  Content
+	// replicated from a mirrored indexer is not counted.
+	IndexCount uint64 `json:",omitempty"`
+	// LastSyncError is the error from the last attempt to sync with the
+	// provider, or empty if that attempt succeeded.
+	LastSyncError string `json:",omitempty"`
+	// Protocols lists the retrieval protocols seen in the metadata of the
+	// provider's advertisements.
+	Protocols []multicodec.Code `json:",omitempty"`
+	// Labels are assigned to the provider by the indexer's operator.
+	Labels map[string]string `json:",omitempty"`
+	// Unverified is true if re-verification found that the provider's
+	// discovery address now belongs to a different peer.
+	Unverified bool `json:",omitempty"`
 
 	lastContactTime time.Time
+	lastSyncTime    time.Time
+	lastSyncErr     bool
+	// addrStatus maps the bytes of each probed address to its status.
+	addrStatus map[string]AddrStatus
+}
+
+// LastContactTime returns the last time the provider was in contact with the
+// indexer.  This is zero if there has been no contact since the indexer
+// started.
+func (p *ProviderInfo) LastContactTime() time.Time {
+	return p.lastContactTime
+}
+
+// LastSync returns the time of the last attempt to sync with the provider, and
+// whether or not that attempt succeeded.  The time is zero if there has been
+// no sync since the indexer started.
+func (p *ProviderInfo) LastSync() (time.Time, bool) {
+	return p.lastSyncTime, !p.lastSyncErr
 }
 
 func (p *ProviderInfo) dsKey() datastore.Key {
@@ -75,9 +154,8 @@ func (p *ProviderInfo) dsKey() datastore.Key {
 
 // NewRegistry creates a new provider registry, giving it provider policy
 // configuration, a datastore to persist provider data, and a Discoverer
-// interface.
-//
-// TODO: It is probably necessary to have multiple discoverer interfaces
+// interface.  Use a discovery.Router to discover providers using more than one
+// discovery method.
 func NewRegistry(cfg config.Discovery, dstore datastore.Datastore, disco discovery.Discoverer) (*Registry, error) {
 	// Create policy from config
 	discoPolicy, err := policy.New(cfg.Policy)
@@ -85,16 +163,25 @@ func NewRegistry(cfg config.Discovery, dstore datastore.Datastore, disco discove
 		return nil, err
 	}
 
+	seqs, err := newSequences(time.Duration(cfg.SequenceMaxAge), dstore)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load sequences: %w", err)
+	}
+
 	r := &Registry{
 		actions:   make(chan func()),
 		closed:    make(chan struct{}),
 		policy:    discoPolicy,
-		providers: map[peer.ID]*ProviderInfo{},
-		sequences: newSequences(0),
+		sequences: seqs,
+
+		pending:      map[peer.ID]*pendingRecord{},
+		pendingReady: make(chan struct{}, 1),
 
 		pollInterval:     time.Duration(cfg.PollInterval),
 		rediscoverWait:   time.Duration(cfg.RediscoverWait),
 		discoveryTimeout: time.Duration(cfg.Timeout),
+		reverifyInterval: time.Duration(cfg.ReverifyInterval),
+		removeUnverified: cfg.RemoveUnverified,
 
 		discoverer: disco,
 		discoTimes: map[string]time.Time{},
@@ -114,6 +201,13 @@ func NewRegistry(cfg config.Discovery, dstore datastore.Datastore, disco discove
 		r.periodicTimer.Reset(r.pollInterval / 2)
 	})
 
+	if r.reverifyInterval != 0 && disco != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		r.reverifyCancel = cancel
+		r.reverifyDone = make(chan struct{})
+		go r.runReverify(ctx)
+	}
+
 	go r.run()
 	return r, nil
 }
@@ -123,10 +217,18 @@ func (r *Registry) Close() error {
 	var err error
 	r.closeOnce.Do(func() {
 		r.periodicTimer.Stop()
+		// Stop re-verification, canceling any discovery in progress.
+		if r.reverifyCancel != nil {
+			r.reverifyCancel()
+			<-r.reverifyDone
+		}
 		// Wait for any pending discoveries to complete, then stop the main run
 		// goroutine
 		r.discoWait.Wait()
 		close(r.actions)
+		// Wait for pending records to be applied before closing the datastore.
+		<-r.closed
+		r.events.close()
 
 		if r.dstore != nil {
 			err = r.dstore.Close()
@@ -146,17 +248,25 @@ func (r *Registry) Close() error {
 func (r *Registry) run() {
 	defer close(r.closed)
 
-	for action := range r.actions {
-		action()
+	for {
+		select {
+		case action, ok := <-r.actions:
+			// Apply pending records first, so that actions see them.
+			r.syncApplyPending()
+			if !ok {
+				return
+			}
+			action()
+		case <-r.pendingReady:
+			r.syncApplyPending()
+		}
 	}
 }
 
 // Discover begins the process of discovering and verifying a provider.  The
-// discovery address us used to lookup the provider's information.
-//
-// TODO: To support multiple discoverer methods (lotus, IPFS, etc.) there need
-// to be information that is part of, or in addition to, the discoveryAddr to
-// indicate where/how discovery is done.
+// discovery address us used to lookup the provider's information.  When the
+// registry uses a discovery.Router, the scheme of the discovery address, such
+// as "fil:" or "peer:", selects the discovery method.
 func (r *Registry) Discover(peerID peer.ID, discoveryAddr string, sync bool) error {
 	// If provider is not allowed, then ignore request
 	if !r.policy.Allowed(peerID) {
@@ -176,25 +286,19 @@ func (r *Registry) Discover(peerID peer.ID, discoveryAddr string, sync bool) err
 }
 
 // Register is used to directly register a provider, bypassing discovery and
-// adding discovered data directly to the registry.
+// adding discovered data directly to the registry.  The record that the
+// registry has collected about an already registered provider is kept.
 func (r *Registry) Register(info *ProviderInfo) error {
 	if len(info.AddrInfo.Addrs) == 0 {
 		return syserr.New(errors.New("missing provider address"), http.StatusBadRequest)
 	}
-
-	// If provider is not allowed, then ignore request
-	if !r.policy.Allowed(info.AddrInfo.ID) {
-		return syserr.New(ErrNotAllowed, http.StatusForbidden)
-	}
-
-	// If provider is trusted, register immediately without verification
-	if !r.policy.Trusted(info.AddrInfo.ID) {
-		return syserr.New(ErrNotTrusted, http.StatusUnauthorized)
+	if err := r.checkRegisterPolicy(info.AddrInfo.ID); err != nil {
+		return err
 	}
 
 	errCh := make(chan error, 1)
 	r.actions <- func() {
-		r.syncRegister(info, errCh)
+		r.syncRegister(info, true, errCh)
 	}
 
 	err := <-errCh
@@ -206,138 +310,355 @@ func (r *Registry) Register(info *ProviderInfo) error {
 	return nil
 }
 
+// checkRegisterPolicy returns an error if the policy does not allow the
+// provider to be registered directly.
+func (r *Registry) checkRegisterPolicy(providerID peer.ID) error {
+	// If provider is not allowed, then ignore request
+	if !r.policy.Allowed(providerID) {
+		return syserr.New(ErrNotAllowed, http.StatusForbidden)
+	}
+
+	// If provider is trusted, register immediately without verification
+	if !r.policy.Trusted(providerID) {
+		return syserr.New(ErrNotTrusted, http.StatusUnauthorized)
+	}
+	return nil
+}
+
 // RegisterOrUpdate attempts to register an unregistered provider, or updates
 // the addresses and latest advertisement of an already registered provider.
+// The update is made on the registry's goroutine, to the provider's current
+// information, so that it does not lose any change made at the same time.
 func (r *Registry) RegisterOrUpdate(providerID peer.ID, addrs []string, adID cid.Cid) error {
-	// Check that the provider has been discovered and validated
-	info := r.ProviderInfo(providerID)
-	if info == nil {
-		if len(addrs) == 0 {
-			return errors.New("cannot regiser provider with no address")
-		}
-
-		maddrs, err := stringsToMultiaddrs(addrs)
-		if err != nil {
-			return err
-		}
-
-		now := time.Now()
-		info = &ProviderInfo{
-			AddrInfo: peer.AddrInfo{
-				ID:    providerID,
-				Addrs: maddrs,
-			},
-			lastContactTime: now,
-		}
-
-		if adID != cid.Undef {
-			info.LastAdvertisement = adID
-			info.LastAdvertisementTime = now
-		}
+	maddrs, err := stringsToMultiaddrs(addrs)
+	if err != nil {
+		return err
+	}
 
-		return r.Register(info)
+	var registered bool
+	errCh := make(chan error, 1)
+	r.actions <- func() {
+		_, registered = r.loadProviders()[providerID]
+		r.syncRegisterOrUpdate(providerID, maddrs, adID, errCh)
+	}
+	if err = <-errCh; err != nil {
+		return err
 	}
 
-	var update bool
+	if !registered {
+		log.Infow("registered provider", "id", providerID, "addrs", maddrs)
+	}
+	return nil
+}
 
-	if len(addrs) != 0 {
-		maddrs, err := stringsToMultiaddrs(addrs)
-		if err != nil {
-			return err
+func (r *Registry) syncRegisterOrUpdate(providerID peer.ID, maddrs []multiaddr.Multiaddr, adID cid.Cid, errCh chan<- error) {
+	var newInfo ProviderInfo
+	info, ok := r.loadProviders()[providerID]
+	if !ok {
+		if len(maddrs) == 0 {
+			errCh <- errors.New("cannot register provider with no address")
+			close(errCh)
+			return
 		}
-
-		// If the registered addresses are different than those provided, then
-		// re-register with new address.
-		if len(addrs) != len(info.AddrInfo.Addrs) {
-			info.AddrInfo.Addrs = maddrs
-			update = true
-		} else {
-			for i := range maddrs {
-				if !maddrs[i].Equal(info.AddrInfo.Addrs[i]) {
-					info.AddrInfo.Addrs = maddrs
-					update = true
-					break
-				}
-			}
+		newInfo.AddrInfo = peer.AddrInfo{
+			ID:    providerID,
+			Addrs: maddrs,
+		}
+	} else {
+		// Replace the ProviderInfo, since existing instances are never
+		// modified.
+		newInfo = *info
+		// If the registered addresses are different than those provided,
+		// then re-register with new address.
+		update := len(maddrs) != 0 && !addrsEqual(maddrs, info.AddrInfo.Addrs)
+		if update {
+			newInfo.AddrInfo.Addrs = maddrs
+		}
+		if !update && adID == cid.Undef {
+			close(errCh)
+			return
 		}
 	}
 
-	if !update && adID == cid.Undef {
-		return nil
+	if err := r.checkRegisterPolicy(providerID); err != nil {
+		errCh <- err
+		close(errCh)
+		return
 	}
 
 	now := time.Now()
-
 	if adID != cid.Undef {
-		info.LastAdvertisement = adID
-		info.LastAdvertisementTime = now
+		if adID != newInfo.LastAdvertisement {
+			newInfo.AdCount++
+		}
+		newInfo.LastAdvertisement = adID
+		newInfo.LastAdvertisementTime = now
 	}
-	info.lastContactTime = now
+	newInfo.lastContactTime = now
 
-	return r.Register(info)
+	r.syncRegister(&newInfo, false, errCh)
 }
 
-// IsRegistered checks if the provider is in the registry
-func (r *Registry) IsRegistered(providerID peer.ID) bool {
+// Replicate stores provider information received from another indexer that
+// this indexer mirrors.  The information is stored as given, without applying
+// policy, since the other indexer has already applied its policy.
+func (r *Registry) Replicate(info *ProviderInfo) error {
+	errCh := make(chan error, 1)
+	r.actions <- func() {
+		r.syncRegister(info, false, errCh)
+	}
+	return <-errCh
+}
+
+// RemoveProvider removes a provider from the registry.  This is used to
+// replicate the removal of a provider from another indexer that this indexer
+// mirrors.
+func (r *Registry) RemoveProvider(providerID peer.ID) error {
+	var hooks []func(peer.ID)
+	errCh := make(chan error, 1)
+	r.actions <- func() {
+		if _, ok := r.loadProviders()[providerID]; ok {
+			hooks = r.removeHooks
+		}
+		errCh <- r.syncRemoveProvider(providerID)
+	}
+	if err := <-errCh; err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		hook(providerID)
+	}
+	return nil
+}
+
+// OnRemove adds a function that is called with the ID of each provider that
+// is removed from the registry, so that the provider's content can be
+// removed.  The function is not called on the registry's goroutine.
+func (r *Registry) OnRemove(hook func(peer.ID)) {
 	done := make(chan struct{})
-	var found bool
 	r.actions <- func() {
-		_, found = r.providers[providerID]
+		r.removeHooks = append(r.removeHooks, hook)
 		close(done)
 	}
 	<-done
-	return found
 }
 
-// ProviderInfoByAddr finds a registered provider using its discovery address
-func (r *Registry) ProviderInfoByAddr(discoAddr string) *ProviderInfo {
-	infoChan := make(chan *ProviderInfo)
+// OnRegister adds a function that is called with the new information each
+// time a provider is registered or its information is updated.  The function
+// is called on the registry's goroutine, so it must not call the registry.
+func (r *Registry) OnRegister(hook func(*ProviderInfo)) {
+	done := make(chan struct{})
 	r.actions <- func() {
-		// TODO: consider adding a map of discoAddr->providerID
-		for _, info := range r.providers {
-			if info.DiscoveryAddr == discoAddr {
-				infoChan <- info
-				break
-			}
+		r.registerHooks = append(r.registerHooks, hook)
+		close(done)
+	}
+	<-done
+}
+
+// RecordSync records the result of an attempt to sync with a registered
+// provider.  A successful sync also counts as contact with the provider.  The
+// result is recorded without waiting for the registry's goroutine, which
+// applies it before running any later registry action.
+func (r *Registry) RecordSync(providerID peer.ID, syncErr error) {
+	r.recordPending(providerID, func(rec *pendingRecord) {
+		rec.synced = true
+		rec.syncTime = time.Now()
+		rec.syncErr = syncErr
+	})
+}
+
+// RecordIndexed records that count multihashes were newly indexed, or removed
+// if isRm is true, for a registered provider, using the retrieval protocol
+// from the indexed metadata.  The counts are those that the provider index
+// reports, so that IndexCount follows the provider's context counts.  The counts recorded for a provider are added up
+// until the registry's goroutine applies them, so that ingesting many entry
+// chunks does not update the registry for each one.
+func (r *Registry) RecordIndexed(providerID peer.ID, protocol multicodec.Code, count int, isRm bool) {
+	r.recordPending(providerID, func(rec *pendingRecord) {
+		if isRm {
+			rec.indexed -= int64(count)
+			return
+		}
+		rec.indexed += int64(count)
+		if !containsCode(rec.protocols, protocol) {
+			rec.protocols = append(rec.protocols, protocol)
 		}
-		close(infoChan)
+	})
+}
+
+// recordPending updates the pending record of a provider, and signals the
+// registry's goroutine to apply pending records.
+func (r *Registry) recordPending(providerID peer.ID, update func(*pendingRecord)) {
+	r.pendingLock.Lock()
+	rec, ok := r.pending[providerID]
+	if !ok {
+		rec = new(pendingRecord)
+		r.pending[providerID] = rec
 	}
+	update(rec)
+	r.pendingLock.Unlock()
 
-	return <-infoChan
+	select {
+	case r.pendingReady <- struct{}{}:
+	default:
+	}
 }
 
-// ProviderInfo returns information for a registered provider
-func (r *Registry) ProviderInfo(providerID peer.ID) *ProviderInfo {
-	infoChan := make(chan *ProviderInfo)
+// syncApplyPending applies the pending records to the providers' information,
+// replacing the providers map once for all of them.
+func (r *Registry) syncApplyPending() {
+	r.pendingLock.Lock()
+	if len(r.pending) == 0 {
+		r.pendingLock.Unlock()
+		return
+	}
+	pending := r.pending
+	r.pending = map[peer.ID]*pendingRecord{}
+	r.pendingLock.Unlock()
+
+	providers := r.loadProviders()
+	updated := make([]*ProviderInfo, 0, len(pending))
+	for providerID, rec := range pending {
+		info, ok := providers[providerID]
+		if !ok {
+			continue
+		}
+		// Replace the ProviderInfo, since existing instances are never modified.
+		newInfo := *info
+		persist := rec.indexed != 0
+		if rec.synced {
+			newInfo.lastSyncTime = rec.syncTime
+			newInfo.lastSyncErr = rec.syncErr != nil
+			if rec.syncErr == nil {
+				newInfo.lastContactTime = rec.syncTime
+				newInfo.LastSyncError = ""
+			} else {
+				newInfo.LastSyncError = rec.syncErr.Error()
+			}
+			persist = persist || newInfo.LastSyncError != info.LastSyncError
+		}
+		if rec.indexed < 0 && uint64(-rec.indexed) > newInfo.IndexCount {
+			newInfo.IndexCount = 0
+		} else {
+			newInfo.IndexCount = uint64(int64(newInfo.IndexCount) + rec.indexed)
+		}
+		for _, protocol := range rec.protocols {
+			if !containsCode(newInfo.Protocols, protocol) {
+				newInfo.Protocols = append(newInfo.Protocols[:len(newInfo.Protocols):len(newInfo.Protocols)], protocol)
+				persist = true
+			}
+		}
+		updated = append(updated, &newInfo)
+		if persist {
+			if err := r.syncPersistProvider(&newInfo); err != nil {
+				log.Errorw("Cannot persist provider", "provider", providerID, "err", err)
+			}
+		}
+	}
+	r.syncSetProviders(updated)
+}
+
+// SetLabels replaces the operator assigned labels of a registered provider.
+func (r *Registry) SetLabels(providerID peer.ID, labels map[string]string) error {
+	errCh := make(chan error, 1)
 	r.actions <- func() {
-		stats.Record(context.Background(), metrics.ProviderCount.M(int64(len(r.providers))))
-		info, ok := r.providers[providerID]
-		if ok {
-			infoChan <- info
+		info, ok := r.loadProviders()[providerID]
+		if !ok {
+			errCh <- syserr.New(ErrNotRegistered, http.StatusNotFound)
+			close(errCh)
+			return
 		}
-		close(infoChan)
+		newInfo := *info
+		newInfo.Labels = nil
+		if len(labels) != 0 {
+			newInfo.Labels = make(map[string]string, len(labels))
+			for k, v := range labels {
+				newInfo.Labels[k] = v
+			}
+		}
+		r.syncRegister(&newInfo, false, errCh)
 	}
+	return <-errCh
+}
 
-	return <-infoChan
+// IsRegistered checks if the provider is in the registry
+func (r *Registry) IsRegistered(providerID peer.ID) bool {
+	_, found := r.loadProviders()[providerID]
+	return found
+}
+
+// ProviderInfoByAddr finds a registered provider using its discovery address
+func (r *Registry) ProviderInfoByAddr(discoAddr string) *ProviderInfo {
+	// TODO: consider adding a map of discoAddr->providerID
+	for _, info := range r.loadProviders() {
+		if info.DiscoveryAddr == discoAddr {
+			return info
+		}
+	}
+	return nil
+}
+
+// ProviderInfo returns information for a registered provider.  This reads the
+// registry without waiting for changes in progress.
+func (r *Registry) ProviderInfo(providerID peer.ID) *ProviderInfo {
+	return r.loadProviders()[providerID]
 }
 
 // AllProviderInfo returns information for all registered providers
 func (r *Registry) AllProviderInfo() []*ProviderInfo {
-	var infos []*ProviderInfo
-	done := make(chan struct{})
-	r.actions <- func() {
-		infos = make([]*ProviderInfo, len(r.providers))
-		var i int
-		for _, info := range r.providers {
-			infos[i] = info
-			i++
-		}
-		close(done)
+	providers := r.loadProviders()
+	infos := make([]*ProviderInfo, 0, len(providers))
+	for _, info := range providers {
+		infos = append(infos, info)
 	}
-	<-done
 	return infos
 }
 
+// loadProviders returns the current providers.  The map must not be modified.
+func (r *Registry) loadProviders() providerMap {
+	return r.providers.Load().(providerMap)
+}
+
+// syncSetProvider adds or replaces a provider.  The providers are copied to a
+// new map, so that readers of the current map are not affected.
+func (r *Registry) syncSetProvider(info *ProviderInfo) {
+	r.syncSetProviders([]*ProviderInfo{info})
+}
+
+// syncSetProviders adds or replaces providers, copying the providers to a new
+// map once for all of them.
+func (r *Registry) syncSetProviders(infos []*ProviderInfo) {
+	if len(infos) == 0 {
+		return
+	}
+	old := r.loadProviders()
+	providers := make(providerMap, len(old)+len(infos))
+	for id, oldInfo := range old {
+		providers[id] = oldInfo
+	}
+	for _, info := range infos {
+		providers[info.AddrInfo.ID] = info
+	}
+	r.storeProviders(providers)
+}
+
+// syncDeleteProvider removes a provider, copying the providers to a new map.
+func (r *Registry) syncDeleteProvider(providerID peer.ID) {
+	old := r.loadProviders()
+	providers := make(providerMap, len(old))
+	for id, oldInfo := range old {
+		if id != providerID {
+			providers[id] = oldInfo
+		}
+	}
+	r.storeProviders(providers)
+}
+
+func (r *Registry) storeProviders(providers providerMap) {
+	r.providers.Store(providers)
+	stats.Record(context.Background(), metrics.ProviderCount.M(int64(len(providers))))
+}
+
 func (r *Registry) CheckSequence(peerID peer.ID, seq uint64) error {
 	return r.sequences.check(peerID, seq)
 }
@@ -355,8 +676,11 @@ func (r *Registry) syncStartDiscover(peerID peer.ID, discoAddr string, errCh cha
 
 	// Do discovery asynchronously; do not block other discovery requests
 	go func() {
-		discoData, discoErr := r.discover(peerID, discoAddr)
+		discoData, discoErr := r.discover(context.Background(), peerID, discoAddr)
 		r.actions <- func() {
+			if discoErr != nil {
+				r.syncPublishDiscoveryFailed(peerID, discoAddr, discoErr)
+			}
 			r.syncEndDiscover(discoAddr, discoData, discoErr, errCh)
 			r.discoWait.Done()
 		}
@@ -375,21 +699,59 @@ func (r *Registry) syncEndDiscover(discoAddr string, discoData *discovery.Discov
 	info := &ProviderInfo{
 		AddrInfo:      discoData.AddrInfo,
 		DiscoveryAddr: discoAddr,
+		Type:          discoData.Type,
 	}
 
-	r.syncRegister(info, errCh)
+	r.syncRegister(info, true, errCh)
 }
 
-func (r *Registry) syncRegister(info *ProviderInfo, errCh chan<- error) {
-	r.providers[info.AddrInfo.ID] = info
+// syncRegister stores info as the provider's information.  If keepRecord is
+// true, then info is new information from outside of the registry, and the
+// record that the registry has collected about the provider is kept, as
+// described by syncKeepRecord.  Otherwise info already carries the provider's
+// record, because it is a copy of the registered information or is replicated
+// from another indexer, and the record is stored as given.
+func (r *Registry) syncRegister(info *ProviderInfo, keepRecord bool, errCh chan<- error) {
+	r.syncKeepRecord(info, keepRecord)
+	old := r.loadProviders()[info.AddrInfo.ID]
+	r.syncSetProvider(info)
 	err := r.syncPersistProvider(info)
 	if err != nil {
 		err = fmt.Errorf("could not persist provider: %s", err)
 		errCh <- syserr.New(err, http.StatusInternalServerError)
+	} else {
+		for _, hook := range r.registerHooks {
+			hook(info)
+		}
+		r.syncPublishChanges(old, info)
 	}
 	close(errCh)
 }
 
+// syncKeepRecord copies the record that the registry has collected about a
+// provider, from its existing ProviderInfo to info.  The address status is
+// only observed by this registry, so it is always copied.  The counts,
+// protocols, labels and first seen time are copied, replacing whatever info
+// has, only if keepRecord is true.  A zero first seen time is never kept.
+func (r *Registry) syncKeepRecord(info *ProviderInfo, keepRecord bool) {
+	old, ok := r.loadProviders()[info.AddrInfo.ID]
+	if ok && old != info {
+		if keepRecord || info.FirstSeen.IsZero() {
+			info.FirstSeen = old.FirstSeen
+		}
+		if keepRecord {
+			info.AdCount = old.AdCount
+			info.IndexCount = old.IndexCount
+			info.Protocols = old.Protocols
+			info.Labels = old.Labels
+		}
+		info.addrStatus = old.addrStatus
+	}
+	if info.FirstSeen.IsZero() {
+		info.FirstSeen = time.Now()
+	}
+}
+
 func (r *Registry) syncNeedDiscover(discoAddr string) error {
 	completed, ok := r.discoTimes[discoAddr]
 	if ok {
@@ -426,6 +788,8 @@ func (r *Registry) syncPersistProvider(info *ProviderInfo) error {
 }
 
 func (r *Registry) loadPersistedProviders() (int, error) {
+	providers := providerMap{}
+	defer r.storeProviders(providers)
 	if r.dstore == nil {
 		return 0, nil
 	}
@@ -458,18 +822,17 @@ func (r *Registry) loadPersistedProviders() (int, error) {
 			return 0, err
 		}
 
-		r.providers[peerID] = pinfo
+		providers[peerID] = pinfo
 		count++
 	}
 	return count, nil
 }
 
-func (r *Registry) discover(peerID peer.ID, discoAddr string) (*discovery.Discovered, error) {
+func (r *Registry) discover(ctx context.Context, peerID peer.ID, discoAddr string) (*discovery.Discovered, error) {
 	if r.discoverer == nil {
 		return nil, ErrNoDiscovery
 	}
 
-	ctx := context.Background()
 	discoTimeout := r.discoveryTimeout
 	if discoTimeout != 0 {
 		var cancel context.CancelFunc
@@ -479,7 +842,7 @@ func (r *Registry) discover(peerID peer.ID, discoAddr string) (*discovery.Discov
 
 	discoData, err := r.discoverer.Discover(ctx, peerID, discoAddr)
 	if err != nil {
-		return nil, fmt.Errorf("cannot discover provider: %s", err)
+		return nil, fmt.Errorf("cannot discover provider: %w", err)
 	}
 
 	return discoData, nil
@@ -506,10 +869,162 @@ func (r *Registry) cleanup() {
 	r.discoWait.Done()
 }
 
+// runReverify re-verifies providers at the configured interval, until ctx is
+// canceled when the registry is closed.
+func (r *Registry) runReverify(ctx context.Context) {
+	defer close(r.reverifyDone)
+
+	timer := time.NewTimer(r.reverifyInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			r.reverify(ctx)
+			timer.Reset(r.reverifyInterval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reverify discovers again each provider that has a discovery address.  A
+// provider's addresses are updated if they have changed.  A provider whose
+// discovery address now belongs to a different peer is flagged as unverified,
+// or removed, along with its content, if so configured.  Providers are kept
+// if discovery fails for any other reason, since that may be temporary.
+func (r *Registry) reverify(ctx context.Context) {
+	var verified, failed int
+	for _, info := range r.AllProviderInfo() {
+		if ctx.Err() != nil {
+			return
+		}
+		if info.DiscoveryAddr == "" {
+			continue
+		}
+		provID := info.AddrInfo.ID
+		discoAddr := info.DiscoveryAddr
+		discoData, err := r.discover(ctx, provID, discoAddr)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && discoData.AddrInfo.ID != provID {
+			err = discovery.ErrProviderMismatch
+		}
+		if err != nil && !errors.Is(err, discovery.ErrProviderMismatch) {
+			log.Warnw("Cannot re-verify provider", "provider", provID, "discovery_addr", discoAddr, "err", err)
+			failed++
+			continue
+		}
+		verified++
+		var hooks []func(peer.ID)
+		done := make(chan struct{})
+		r.actions <- func() {
+			if r.syncEndReverify(provID, discoAddr, discoData, err) {
+				hooks = r.removeHooks
+			}
+			close(done)
+		}
+		<-done
+		for _, hook := range hooks {
+			hook(provID)
+		}
+	}
+	log.Infow("Re-verified providers", "verified", verified, "failed", failed)
+}
+
+// syncEndReverify updates the registry with the result of re-verifying a
+// provider.  The error is nil or discovery.ErrProviderMismatch.  Returns true
+// if the provider was removed.
+func (r *Registry) syncEndReverify(provID peer.ID, discoAddr string, discoData *discovery.Discovered, err error) bool {
+	info, ok := r.loadProviders()[provID]
+	if !ok || info.DiscoveryAddr != discoAddr {
+		// Provider removed or rediscovered while being verified.
+		return false
+	}
+
+	if err != nil {
+		if r.removeUnverified {
+			log.Warnw("Removing provider that no longer matches its discovery address", "provider", provID, "discovery_addr", discoAddr)
+			if err = r.syncRemoveProvider(provID); err != nil {
+				log.Errorw("Cannot remove provider", "provider", provID, "err", err)
+			}
+			return true
+		}
+		if info.Unverified {
+			return false
+		}
+		log.Warnw("Provider no longer matches its discovery address", "provider", provID, "discovery_addr", discoAddr)
+		r.syncPublishDiscoveryFailed(provID, discoAddr, err)
+		newInfo := *info
+		newInfo.Unverified = true
+		r.syncSetProvider(&newInfo)
+		if err = r.syncPersistProvider(&newInfo); err != nil {
+			log.Errorw("Cannot persist unverified provider", "provider", provID, "err", err)
+		}
+		return false
+	}
+
+	newInfo := *info
+	newInfo.Unverified = false
+	newInfo.Type = discoData.Type
+	if addrsEqual(info.AddrInfo.Addrs, discoData.AddrInfo.Addrs) {
+		r.syncSetProvider(&newInfo)
+		if info.Unverified || info.Type != newInfo.Type {
+			if err = r.syncPersistProvider(&newInfo); err != nil {
+				log.Errorw("Cannot persist re-verified provider", "provider", provID, "err", err)
+			}
+		}
+		return false
+	}
+	log.Infow("Updating re-verified provider addresses", "provider", provID, "addrs", discoData.AddrInfo.Addrs)
+	newInfo.AddrInfo.Addrs = discoData.AddrInfo.Addrs
+	errCh := make(chan error, 1)
+	r.syncRegister(&newInfo, false, errCh)
+	if err = <-errCh; err != nil {
+		log.Errorw("Cannot update provider", "provider", provID, "err", err)
+	}
+	return false
+}
+
+// syncRemoveProvider removes a provider from the registry and datastore.
+func (r *Registry) syncRemoveProvider(provID peer.ID) error {
+	info, ok := r.loadProviders()[provID]
+	if !ok {
+		return nil
+	}
+	r.syncDeleteProvider(provID)
+	r.syncPublishRemoved(provID)
+	if r.dstore == nil {
+		return nil
+	}
+	return r.dstore.Delete(info.dsKey())
+}
+
 func (r *Registry) pollProviders() {
 	// TODO: Poll providers that have not been contacted for more than pollInterval.
 }
 
+func containsCode(codes []multicodec.Code, code multicodec.Code) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func addrsEqual(a, b []multiaddr.Multiaddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // stringsToMultiaddrs converts a slice of string into a slice of Multiaddr
 func stringsToMultiaddrs(addrs []string) ([]multiaddr.Multiaddr, error) {
 	if len(addrs) == 0 {
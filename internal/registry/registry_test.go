@@ -2,15 +2,21 @@ package registry
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/filecoin-project/storetheindex/config"
 	"github.com/filecoin-project/storetheindex/internal/registry/discovery"
+	"github.com/ipfs/go-cid"
 	leveldb "github.com/ipfs/go-ds-leveldb"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
 )
 
 type mockDiscoverer struct {
@@ -25,6 +31,8 @@ const (
 	minerDiscoAddr = "stitest999999"
 	minerAddr      = "/ip4/127.0.0.1/tcp/9999"
 	minerAddr2     = "/ip4/127.0.0.2/tcp/9999"
+
+	testProtocol = multicodec.Code(0x300000)
 )
 
 var discoveryCfg = config.Discovery{
@@ -287,3 +295,734 @@ func TestDatastore(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRecordIndexedOnClose(t *testing.T) {
+	dsDir := t.TempDir()
+	dstore, err := leveldb.NewDatastore(dsDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRegistry(discoveryCfg, dstore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	maddr, err := multiaddr.NewMultiaddr(minerAddr)
+	if err != nil {
+		t.Fatal("bad miner address:", err)
+	}
+	err = r.Register(&ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    peerID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Counts recorded before closing are applied and persisted.
+	for i := 0; i < 100; i++ {
+		r.RecordIndexed(peerID, testProtocol, 10, false)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dstore, err = leveldb.NewDatastore(dsDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewRegistry(discoveryCfg, dstore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	info := r.ProviderInfo(peerID)
+	if info == nil {
+		t.Fatal("provider not loaded")
+	}
+	if info.IndexCount != 1000 {
+		t.Fatal("wrong index count:", info.IndexCount)
+	}
+}
+
+func TestReverify(t *testing.T) {
+	mockDisco := newMockDiscoverer(t, exceptID)
+
+	dstore, err := leveldb.NewDatastore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRegistry(discoveryCfg, dstore, mockDisco)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	peerID, err := peer.Decode(exceptID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	err = r.Discover(peerID, minerDiscoAddr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Provider moved to a new address.
+	maddr, err := multiaddr.NewMultiaddr(minerAddr2)
+	if err != nil {
+		t.Fatal("bad miner address:", err)
+	}
+	mockDisco.discoverRsp.AddrInfo.Addrs = []multiaddr.Multiaddr{maddr}
+	r.reverify(context.Background())
+
+	info := r.ProviderInfo(peerID)
+	if info == nil {
+		t.Fatal("provider removed after re-verification")
+	}
+	if info.Unverified {
+		t.Fatal("provider should be verified")
+	}
+	if len(info.AddrInfo.Addrs) != 1 || !info.AddrInfo.Addrs[0].Equal(maddr) {
+		t.Fatal("provider addresses not updated:", info.AddrInfo.Addrs)
+	}
+
+	// Discovery address now belongs to a different peer.
+	otherID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	mockDisco.discoverRsp.AddrInfo.ID = otherID
+	r.reverify(context.Background())
+
+	info = r.ProviderInfo(peerID)
+	if info == nil {
+		t.Fatal("provider removed after re-verification")
+	}
+	if !info.Unverified {
+		t.Fatal("provider should be unverified")
+	}
+	value, err := dstore.Get(info.dsKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored ProviderInfo
+	if err = json.Unmarshal(value, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Unverified {
+		t.Fatal("unverified flag was not persisted")
+	}
+
+	// Discovery address matches the provider again.
+	mockDisco.discoverRsp.AddrInfo.ID = peerID
+	r.reverify(context.Background())
+
+	info = r.ProviderInfo(peerID)
+	if info == nil || info.Unverified {
+		t.Fatal("provider should be verified")
+	}
+}
+
+func TestReverifyRemove(t *testing.T) {
+	mockDisco := newMockDiscoverer(t, exceptID)
+
+	cfg := discoveryCfg
+	cfg.RemoveUnverified = true
+	dstore, err := leveldb.NewDatastore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRegistry(cfg, dstore, mockDisco)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var removed []peer.ID
+	r.OnRemove(func(provID peer.ID) {
+		removed = append(removed, provID)
+	})
+
+	peerID, err := peer.Decode(exceptID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	err = r.Discover(peerID, minerDiscoAddr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	mockDisco.discoverRsp.AddrInfo.ID = otherID
+	r.reverify(context.Background())
+
+	if r.ProviderInfo(peerID) != nil {
+		t.Fatal("unverified provider was not removed")
+	}
+	if len(removed) != 1 || removed[0] != peerID {
+		t.Fatal("remove hook not called for provider:", removed)
+	}
+	has, err := dstore.Has((&ProviderInfo{AddrInfo: peer.AddrInfo{ID: peerID}}).dsKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("unverified provider was not removed from datastore")
+	}
+}
+
+type blockingDiscoverer struct {
+	started chan struct{}
+}
+
+func (b *blockingDiscoverer) Discover(ctx context.Context, peerID peer.ID, filecoinAddr string) (*discovery.Discovered, error) {
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCloseDuringReverify(t *testing.T) {
+	disco := &blockingDiscoverer{started: make(chan struct{}, 1)}
+
+	cfg := discoveryCfg
+	cfg.ReverifyInterval = config.Duration(time.Millisecond)
+	cfg.Timeout = config.Duration(time.Hour)
+	r, err := NewRegistry(cfg, nil, disco)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	maddr, err := multiaddr.NewMultiaddr(minerAddr)
+	if err != nil {
+		t.Fatal("bad miner address:", err)
+	}
+	err = r.Register(&ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    peerID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+		DiscoveryAddr: minerDiscoAddr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-disco.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("re-verification did not start")
+	}
+
+	closed := make(chan error)
+	go func() {
+		closed <- r.Close()
+	}()
+	select {
+	case err = <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close blocked by re-verification")
+	}
+}
+
+func TestProviderRecord(t *testing.T) {
+	dataStorePath := t.TempDir()
+	dstore, err := leveldb.NewDatastore(dataStorePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockDisco := newMockDiscoverer(t, trustedID)
+	r, err := NewRegistry(discoveryCfg, dstore, mockDisco)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Provider is trusted, so that it can update its advertisement.
+	peerID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	err = r.Discover(peerID, minerDiscoAddr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := r.ProviderInfo(peerID)
+	if info.Type != discovery.MinerType {
+		t.Fatal("wrong provider type")
+	}
+	firstSeen := info.FirstSeen
+	if firstSeen.IsZero() {
+		t.Fatal("first seen time not set")
+	}
+
+	adCid, err := cid.Decode("bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.RegisterOrUpdate(peerID, nil, adCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same advertisement is not counted again.
+	err = r.RegisterOrUpdate(peerID, nil, adCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RecordIndexed(peerID, testProtocol, 10, false)
+	r.RecordIndexed(peerID, testProtocol, 3, true)
+	r.RecordSync(peerID, errors.New("sync failed"))
+	err = r.SetLabels(peerID, map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.ProviderInfo(peerID).LastSyncError != "sync failed" {
+		t.Fatal("sync error not recorded")
+	}
+
+	// Rediscovery keeps the collected information.
+	r.discoTimes = map[string]time.Time{}
+	err = r.Discover(peerID, minerDiscoAddr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkInfo := func(info *ProviderInfo) {
+		if info == nil {
+			t.Fatal("provider not found")
+		}
+		if !info.FirstSeen.Equal(firstSeen) {
+			t.Fatal("first seen time changed")
+		}
+		if info.AdCount != 1 {
+			t.Fatal("wrong advertisement count:", info.AdCount)
+		}
+		if info.IndexCount != 7 {
+			t.Fatal("wrong index count:", info.IndexCount)
+		}
+		if len(info.Protocols) != 1 || info.Protocols[0] != testProtocol {
+			t.Fatal("wrong protocols:", info.Protocols)
+		}
+		if info.Labels["region"] != "eu" {
+			t.Fatal("wrong labels:", info.Labels)
+		}
+	}
+	checkInfo(r.ProviderInfo(peerID))
+
+	otherID, err := peer.Decode(exceptID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	err = r.SetLabels(otherID, nil)
+	if !errors.Is(err, ErrNotRegistered) {
+		t.Fatal("expected not registered error, got:", err)
+	}
+
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the information is persisted.
+	dstore, err = leveldb.NewDatastore(dataStorePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewRegistry(discoveryCfg, dstore, mockDisco)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	checkInfo(r.ProviderInfo(peerID))
+
+	// Registering new information keeps the record, even where the new
+	// information has values for it.
+	info = r.ProviderInfo(peerID)
+	err = r.Register(&ProviderInfo{
+		AddrInfo:   info.AddrInfo,
+		AdCount:    100,
+		IndexCount: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInfo(r.ProviderInfo(peerID))
+
+	// Replicated information is stored as given, even where it has zero
+	// counts.
+	err = r.Replicate(&ProviderInfo{
+		AddrInfo: info.AddrInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = r.ProviderInfo(peerID)
+	if info.AdCount != 0 || info.IndexCount != 0 || len(info.Protocols) != 0 || info.Labels != nil {
+		t.Fatal("replicated record not stored as given")
+	}
+	if !info.FirstSeen.Equal(firstSeen) {
+		t.Fatal("first seen time changed")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	mockDisco := newMockDiscoverer(t, exceptID)
+	r, err := NewRegistry(discoveryCfg, nil, mockDisco)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel := r.Subscribe(0)
+	defer cancel()
+
+	nextEvent := func(eventType string) Event {
+		select {
+		case ev := <-events:
+			if ev.Type != eventType {
+				t.Fatalf("expected %s event, got %s", eventType, ev.Type)
+			}
+			return ev
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s event", eventType)
+		}
+		return Event{}
+	}
+
+	peerID, err := peer.Decode(exceptID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	err = r.Discover(peerID, minerDiscoAddr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := nextEvent(EventRegistered)
+	if ev.ProviderID != peerID || ev.Provider == nil {
+		t.Fatal("wrong registered event")
+	}
+
+	err = r.Discover(peerID, "bad1234", true)
+	if err == nil {
+		t.Fatal("expected discovery error")
+	}
+	ev = nextEvent(EventDiscoveryFailed)
+	if ev.DiscoveryAddr != "bad1234" || ev.Error == "" {
+		t.Fatal("wrong discovery failed event")
+	}
+
+	maddr, err := multiaddr.NewMultiaddr(minerAddr2)
+	if err != nil {
+		t.Fatal("bad miner address:", err)
+	}
+	mockDisco.discoverRsp.AddrInfo.Addrs = []multiaddr.Multiaddr{maddr}
+	r.reverify(context.Background())
+	ev = nextEvent(EventAddrChanged)
+	if !ev.Provider.AddrInfo.Addrs[0].Equal(maddr) {
+		t.Fatal("wrong addresses in addr changed event")
+	}
+
+	r.removeUnverified = true
+	otherID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	mockDisco.discoverRsp.AddrInfo.ID = otherID
+	r.reverify(context.Background())
+	nextEvent(EventRemoved)
+
+	// Closing the registry closes the subscription.
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("expected events channel to be closed")
+	}
+}
+
+func TestEventsSlowSubscriber(t *testing.T) {
+	r, err := NewRegistry(discoveryCfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	events, cancel := r.Subscribe(1)
+	defer cancel()
+
+	for _, id := range []string{trustedID, trustedID2} {
+		peerID, err := peer.Decode(id)
+		if err != nil {
+			t.Fatal("bad provider ID:", err)
+		}
+		err = r.Register(&ProviderInfo{
+			AddrInfo: peer.AddrInfo{
+				ID:    peerID,
+				Addrs: []multiaddr.Multiaddr{multiaddr.StringCast(minerAddr)},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// First event is buffered, then the channel is closed.
+	if _, ok := <-events; !ok {
+		t.Fatal("expected buffered event")
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("expected slow subscriber to be dropped")
+	}
+}
+
+func TestReadWhileRegistering(t *testing.T) {
+	r, err := NewRegistry(discoveryCfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	maddr := multiaddr.StringCast(minerAddr)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			for _, id := range []string{trustedID, trustedID2} {
+				peerID, err := peer.Decode(id)
+				if err != nil {
+					panic(err)
+				}
+				err = r.Register(&ProviderInfo{
+					AddrInfo: peer.AddrInfo{
+						ID:    peerID,
+						Addrs: []multiaddr.Multiaddr{maddr},
+					},
+				})
+				if err != nil {
+					panic(err)
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			if len(r.AllProviderInfo()) != 2 {
+				t.Fatal("expected 2 providers")
+			}
+			return
+		default:
+		}
+		for _, info := range r.AllProviderInfo() {
+			if r.ProviderInfo(info.AddrInfo.ID) == nil || !r.IsRegistered(info.AddrInfo.ID) {
+				t.Fatal("listed provider not found")
+			}
+		}
+	}
+}
+
+func TestUpdateWhileRecording(t *testing.T) {
+	r, err := NewRegistry(discoveryCfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	peerID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal("bad provider ID:", err)
+	}
+	err = r.RegisterOrUpdate(peerID, []string{minerAddr}, cid.Undef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.SetLabels(peerID, map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates to the provider's addresses and advertisement do not lose the
+	// index counts recorded at the same time.
+	const updates = 1000
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			mh, err := multihash.Sum([]byte(strconv.Itoa(i)), multihash.SHA2_256, -1)
+			if err != nil {
+				panic(err)
+			}
+			addr := minerAddr
+			if i%2 == 1 {
+				addr = minerAddr2
+			}
+			err = r.RegisterOrUpdate(peerID, []string{addr}, cid.NewCidV1(cid.Raw, mh))
+			if err != nil {
+				panic(err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			r.RecordIndexed(peerID, testProtocol, 1, false)
+			time.Sleep(time.Microsecond)
+		}
+	}()
+	wg.Wait()
+
+	// Run an action so that all pending records are applied.
+	err = r.SetLabels(peerID, map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := r.ProviderInfo(peerID)
+	if info.IndexCount != updates {
+		t.Fatal("wrong index count:", info.IndexCount)
+	}
+	if info.AdCount != updates {
+		t.Fatal("wrong advertisement count:", info.AdCount)
+	}
+	if len(info.Protocols) != 1 || info.Protocols[0] != testProtocol {
+		t.Fatal("wrong protocols:", info.Protocols)
+	}
+	if info.Labels["region"] != "eu" {
+		t.Fatal("wrong labels:", info.Labels)
+	}
+	if len(info.AddrInfo.Addrs) != 1 || info.AddrInfo.Addrs[0].String() != minerAddr2 {
+		t.Fatal("wrong addresses:", info.AddrInfo.Addrs)
+	}
+}
+
+// BenchmarkProviderInfo measures reading provider information while other
+// providers are registered.
+func BenchmarkProviderInfo(b *testing.B) {
+	r, err := NewRegistry(discoveryCfg, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	peerID, err := peer.Decode(trustedID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	maddr := multiaddr.StringCast(minerAddr)
+	info := &ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    peerID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	}
+	if err = r.Register(info); err != nil {
+		b.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			newInfo := *info
+			if err := r.Register(&newInfo); err != nil {
+				panic(err)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if r.ProviderInfo(peerID) == nil {
+				b.Fatal("provider not found")
+			}
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
+
+func TestSequencePersisted(t *testing.T) {
+	dataStorePath := t.TempDir()
+	dstore, err := leveldb.NewDatastore(dataStorePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := discoveryCfg
+	cfg.SequenceMaxAge = config.Duration(time.Hour)
+	r, err := NewRegistry(cfg, dstore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerID, err := peer.Decode(trustedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq := uint64(time.Now().UnixNano())
+	if err = r.CheckSequence(peerID, seq); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.CheckSequence(peerID, seq); !errors.Is(err, ErrSequenceReplayed) {
+		t.Fatalf("expected error %q, got %v", ErrSequenceReplayed, err)
+	}
+	old := uint64(time.Now().Add(-2 * time.Hour).UnixNano())
+	if err = r.CheckSequence(peerID, old); !errors.Is(err, ErrSequenceTooOld) {
+		t.Fatalf("expected error %q, got %v", ErrSequenceTooOld, err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay is still rejected after restart.
+	dstore, err = leveldb.NewDatastore(dataStorePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewRegistry(cfg, dstore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.CheckSequence(peerID, seq); !errors.Is(err, ErrSequenceReplayed) {
+		t.Fatalf("expected error %q after restart, got %v", ErrSequenceReplayed, err)
+	}
+	if err = r.CheckSequence(peerID, seq+1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Retired sequences are removed from the datastore.
+	r.sequences.maxAge = time.Nanosecond
+	r.sequences.retire()
+	has, err := dstore.Has(sequenceKey(peerID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("retired sequence was not removed from datastore")
+	}
+}
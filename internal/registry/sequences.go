@@ -1,35 +1,72 @@
 package registry
 
 import (
-	"errors"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"path"
 	"sync"
 	"time"
 
+	"github.com/filecoin-project/storetheindex/internal/metrics"
+	"github.com/filecoin-project/storetheindex/internal/syserr"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 )
 
-const defaultMaxAge = 48 * time.Hour
+const (
+	defaultMaxAge = 48 * time.Hour
 
+	// sequenceKeyPath is where the last sequence seen from each peer is
+	// stored in the indexer repo.
+	sequenceKeyPath = "/registry/seq"
+)
+
+// Reasons for rejecting a sequence, recorded in metrics.
+const (
+	seqResultTooOld   = "too_old"
+	seqResultReplayed = "replayed"
+	seqResultError    = "error"
+)
+
+// sequences tracks the last sequence number seen from each peer, to reject
+// replayed signed requests.  Sequences are nanosecond timestamps, and those
+// older than maxAge are rejected without looking at the peer's last sequence,
+// so a peer's sequence is forgotten once it is older than maxAge.
+//
+// If there is a datastore, a sequence is persisted before the request that
+// carries it is accepted, so that requests cannot be replayed after a restart.
 type sequences struct {
+	dstore datastore.Datastore
 	maxAge time.Duration
 	mutex  sync.Mutex
 	seqs   map[peer.ID]uint64
 }
 
-func newSequences(maxAge time.Duration) *sequences {
+func newSequences(maxAge time.Duration, dstore datastore.Datastore) (*sequences, error) {
 	if maxAge == 0 {
 		maxAge = defaultMaxAge
 	}
-	return &sequences{
+	s := &sequences{
+		dstore: dstore,
 		maxAge: maxAge,
 		seqs:   make(map[peer.ID]uint64),
 	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 func (s *sequences) check(id peer.ID, sequence uint64) error {
 	oldestAllowed := uint64(time.Now().Add(-s.maxAge).UnixNano())
 	if sequence < oldestAllowed {
-		return errors.New("sequence too small")
+		recordSequenceRejected(seqResultTooOld)
+		return ErrSequenceTooOld
 	}
 
 	s.mutex.Lock()
@@ -37,7 +74,13 @@ func (s *sequences) check(id peer.ID, sequence uint64) error {
 
 	prevSeq, ok := s.seqs[id]
 	if ok && sequence <= prevSeq {
-		return errors.New("sequence less than or equal to last seen")
+		recordSequenceRejected(seqResultReplayed)
+		return ErrSequenceReplayed
+	}
+	if err := s.persist(id, sequence); err != nil {
+		log.Errorw("Cannot persist sequence", "peer", id, "err", err)
+		recordSequenceRejected(seqResultError)
+		return syserr.New(err, http.StatusInternalServerError)
 	}
 	s.seqs[id] = sequence
 	return nil
@@ -53,7 +96,84 @@ func (s *sequences) retire() {
 	for id, seq := range s.seqs {
 		if seq > oldestAllowed {
 			active[id] = seq
+			continue
+		}
+		if s.dstore != nil {
+			if err := s.dstore.Delete(sequenceKey(id)); err != nil {
+				log.Errorw("Cannot delete retired sequence", "peer", id, "err", err)
+			}
 		}
 	}
 	s.seqs = active
 }
+
+func (s *sequences) persist(id peer.ID, sequence uint64) error {
+	if s.dstore == nil {
+		return nil
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, sequence)
+
+	dsKey := sequenceKey(id)
+	if err := s.dstore.Put(dsKey, value); err != nil {
+		return fmt.Errorf("cannot store sequence: %w", err)
+	}
+	if err := s.dstore.Sync(dsKey); err != nil {
+		return fmt.Errorf("cannot sync sequence: %w", err)
+	}
+	return nil
+}
+
+// load reads the persisted sequences, deleting any that are already retired.
+func (s *sequences) load() error {
+	if s.dstore == nil {
+		return nil
+	}
+	results, err := s.dstore.Query(query.Query{
+		Prefix: sequenceKeyPath,
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	oldestAllowed := uint64(time.Now().Add(-s.maxAge).UnixNano())
+	var retired []datastore.Key
+	for result := range results.Next() {
+		if result.Error != nil {
+			return fmt.Errorf("cannot read sequence data: %v", result.Error)
+		}
+		ent := result.Entry
+
+		id, err := peer.Decode(path.Base(ent.Key))
+		if err != nil {
+			return fmt.Errorf("cannot decode sequence peer ID: %s", err)
+		}
+		if len(ent.Value) != 8 {
+			return fmt.Errorf("bad sequence data for peer %s", id)
+		}
+		seq := binary.BigEndian.Uint64(ent.Value)
+		if seq <= oldestAllowed {
+			retired = append(retired, datastore.NewKey(ent.Key))
+			continue
+		}
+		s.seqs[id] = seq
+	}
+
+	for _, dsKey := range retired {
+		if err = s.dstore.Delete(dsKey); err != nil {
+			return fmt.Errorf("cannot delete retired sequence: %w", err)
+		}
+	}
+	return nil
+}
+
+func sequenceKey(id peer.ID) datastore.Key {
+	return datastore.NewKey(path.Join(sequenceKeyPath, id.String()))
+}
+
+func recordSequenceRejected(reason string) {
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Result, reason)),
+		stats.WithMeasurements(metrics.SequenceRejected.M(1)))
+}
@@ -0,0 +1,211 @@
+// Package valuestore provides maintenance operations for the indexer value
+// store, such as integrity checking and compaction.
+package valuestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/api/v0/admin/model"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("indexer/valuestore")
+
+// cancelCheckInterval is how many multihashes are scanned between checks for
+// cancellation.
+const cancelCheckInterval = 1024
+
+// removeBatchSize is the number of bad values, counting a value once for each
+// multihash that maps to it, that are held in memory before they are removed.
+var removeBatchSize = 1 << 16
+
+// Check scans all multihashes and values in the value store, and reports
+// corrupt records, values with metadata that cannot be decoded, and values
+// from providers that are not in the registry.  If remove is true, then bad
+// values and values from unknown providers are removed from the value store.
+//
+// Any write to the value store invalidates the iterator used to scan it.  So,
+// when removing, the scan stops each time a batch of bad values is collected,
+// the batch is removed, and the scan starts again.  Values from unknown
+// providers are removed after the last scan, by removing all of the provider's
+// values.
+//
+// Corrupt records cannot be removed individually, since the iterator does not
+// return the key of a record it cannot read.  When a corrupt record is found
+// the scan stops, since the store cannot be iterated past it.
+func Check(ctx context.Context, idxr indexer.Interface, reg *registry.Registry, remove bool) (*model.CheckReport, error) {
+	startSize, err := idxr.Size()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get value store size: %s", err)
+	}
+
+	report := &model.CheckReport{
+		StartSize: startSize,
+	}
+
+	known := map[peer.ID]bool{}
+	isKnown := func(provID peer.ID) bool {
+		ok, found := known[provID]
+		if !found {
+			ok = reg == nil || reg.IsRegistered(provID)
+			known[provID] = ok
+		}
+		return ok
+	}
+
+	// Values removed by earlier scans are not seen by the final scan, but are
+	// counted in the report.
+	var pass *scanResult
+	var removedBefore int
+	for {
+		pass, err = scan(ctx, idxr, isKnown, remove)
+		if err != nil {
+			return nil, err
+		}
+		report.BadMetadata += pass.badMetadata
+		removedBefore = report.Removed
+		if remove {
+			for _, bv := range pass.bad {
+				if err = idxr.Remove(bv.value, bv.mhs...); err != nil {
+					return nil, fmt.Errorf("cannot remove value with bad metadata: %s", err)
+				}
+				report.Removed += len(bv.mhs)
+			}
+		}
+		if pass.complete {
+			break
+		}
+		log.Infow("Removed batch of values with bad metadata, scanning again", "removed", report.Removed)
+	}
+	report.Multihashes = pass.multihashes
+	report.Values = pass.values + removedBefore
+	report.Corrupt = pass.corrupt
+	report.UnknownProvider = pass.unknown
+
+	log.Infow("Value store check complete", "multihashes", report.Multihashes,
+		"values", report.Values, "corrupt", report.Corrupt,
+		"bad_metadata", report.BadMetadata, "unknown_provider", report.UnknownProvider)
+
+	if !remove {
+		report.EndSize = startSize
+		return report, nil
+	}
+
+	for provID := range pass.unknownProvs {
+		if err = idxr.RemoveProvider(provID); err != nil {
+			return nil, fmt.Errorf("cannot remove values for provider %s: %s", provID, err)
+		}
+		report.RemovedProviders++
+	}
+
+	if err = idxr.Flush(); err != nil {
+		return nil, fmt.Errorf("cannot flush value store: %s", err)
+	}
+	report.EndSize, err = idxr.Size()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get value store size: %s", err)
+	}
+	if report.EndSize < report.StartSize {
+		report.Reclaimed = report.StartSize - report.EndSize
+	}
+
+	log.Infow("Value store compaction complete", "removed", report.Removed,
+		"removed_providers", report.RemovedProviders, "reclaimed", report.Reclaimed)
+
+	return report, nil
+}
+
+// scanResult is what one scan of the value store found.
+type scanResult struct {
+	multihashes  int
+	values       int
+	corrupt      int
+	badMetadata  int
+	unknown      int
+	unknownProvs map[peer.ID]struct{}
+	// bad holds the values with bad metadata, if they are being collected
+	// for removal.
+	bad map[string]*badValue
+	// complete is false if the scan stopped because a batch of bad values
+	// was collected.
+	complete bool
+}
+
+// scan iterates the value store.  If collect is true, values with bad metadata
+// are collected, and the scan stops once removeBatchSize of them are
+// collected.
+func scan(ctx context.Context, idxr indexer.Interface, isKnown func(peer.ID) bool, collect bool) (*scanResult, error) {
+	iter, err := idxr.Iter()
+	if err != nil {
+		return nil, fmt.Errorf("cannot iterate value store: %s", err)
+	}
+
+	result := &scanResult{
+		unknownProvs: map[peer.ID]struct{}{},
+		bad:          map[string]*badValue{},
+	}
+	for {
+		if result.multihashes%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if collect && result.badMetadata >= removeBatchSize {
+			return result, nil
+		}
+
+		mh, values, err := iter.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			log.Errorw("Corrupt record in value store", "err", err)
+			result.corrupt++
+			break
+		}
+		result.multihashes++
+
+		for i := range values {
+			result.values++
+			provID := values[i].ProviderID
+			if !isKnown(provID) {
+				result.unknown++
+				result.unknownProvs[provID] = struct{}{}
+				continue
+			}
+
+			err = new(v0.Metadata).UnmarshalBinary(values[i].MetadataBytes)
+			if err != nil {
+				result.badMetadata++
+				if !collect {
+					continue
+				}
+				k := valueKey(values[i])
+				bv, ok := result.bad[k]
+				if !ok {
+					bv = &badValue{value: values[i]}
+					result.bad[k] = bv
+				}
+				bv.mhs = append(bv.mhs, mh)
+			}
+		}
+	}
+	result.complete = true
+	return result, nil
+}
+
+// badValue is a value that has bad metadata, and the multihashes that map to
+// it.
+type badValue struct {
+	value indexer.Value
+	mhs   []multihash.Multihash
+}
+
+func valueKey(v indexer.Value) string {
+	return fmt.Sprintf("%x/%x/%x", []byte(v.ProviderID), v.ContextID, v.MetadataBytes)
+}
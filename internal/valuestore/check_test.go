@@ -0,0 +1,203 @@
+package valuestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/go-indexer-core/store/memory"
+	v0 "github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	providerID   = "12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA"
+	unknownID    = "12D3KooWSG3JuvEjRkSxt93ADTjQxqe4ExbBwSkQ9Zyk1WfBaZJF"
+	providerAddr = "/ip4/127.0.0.1/tcp/9999"
+)
+
+func TestCheckCompact(t *testing.T) {
+	reg := initRegistry(t)
+	defer reg.Close()
+
+	provID, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unkID, err := peer.Decode(unknownID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maddr, err := multiaddr.NewMultiaddr(providerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    provID,
+			Addrs: []multiaddr.Multiaddr{maddr},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := v0.Metadata{ProtocolID: 0x300000, Data: []byte("data")}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goodValue := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("good"),
+		MetadataBytes: metadata,
+	}
+	badValue := indexer.Value{
+		ProviderID:    provID,
+		ContextID:     []byte("bad"),
+		MetadataBytes: []byte{0},
+	}
+	unknownValue := indexer.Value{
+		ProviderID:    unkID,
+		ContextID:     []byte("unknown"),
+		MetadataBytes: metadata,
+	}
+
+	mhs := util.RandomMultihashes(15)
+	store := memory.New()
+	if err = store.Put(goodValue, mhs[:5]...); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put(badValue, mhs[5:10]...); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put(unknownValue, mhs[10:]...); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(context.Background(), store, reg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Multihashes != 15 {
+		t.Fatalf("expected 15 multihashes, got %d", report.Multihashes)
+	}
+	if report.BadMetadata != 5 {
+		t.Fatalf("expected 5 values with bad metadata, got %d", report.BadMetadata)
+	}
+	if report.UnknownProvider != 5 {
+		t.Fatalf("expected 5 values from unknown provider, got %d", report.UnknownProvider)
+	}
+	if report.Removed != 0 || report.RemovedProviders != 0 {
+		t.Fatal("check should not remove values")
+	}
+
+	// Remove bad values in batches of 2, which takes several scans.
+	defer func(size int) { removeBatchSize = size }(removeBatchSize)
+	removeBatchSize = 2
+	report, err = Check(context.Background(), store, reg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BadMetadata != 5 || report.Values != 15 {
+		t.Fatalf("expected 5 bad values of 15, got report:\n%s", report)
+	}
+	if report.Removed != 5 {
+		t.Fatalf("expected 5 values removed, got %d", report.Removed)
+	}
+	if report.RemovedProviders != 1 {
+		t.Fatalf("expected 1 provider removed, got %d", report.RemovedProviders)
+	}
+
+	// Check that only good values remain.
+	report, err = Check(context.Background(), store, reg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Multihashes != 5 || report.BadMetadata != 0 || report.UnknownProvider != 0 {
+		t.Fatalf("expected only good values to remain, got report:\n%s", report)
+	}
+	_, found, err := store.Get(mhs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("good value was removed")
+	}
+}
+
+func TestChecker(t *testing.T) {
+	reg := initRegistry(t)
+	defer reg.Close()
+
+	unkID, err := peer.Decode(unknownID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := v0.Metadata{ProtocolID: 0x300000, Data: []byte("data")}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memory.New()
+	value := indexer.Value{
+		ProviderID:    unkID,
+		ContextID:     []byte("unknown"),
+		MetadataBytes: metadata,
+	}
+	if err = store.Put(value, util.RandomMultihashes(10)...); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewChecker(store, reg)
+	defer checker.Close()
+
+	status, err := checker.Start(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Compact || status.Started == "" {
+		t.Fatalf("unexpected status for started check: %+v", status)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status.Running {
+		if time.Now().After(deadline) {
+			t.Fatal("check did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+		status = checker.Status()
+	}
+	if status.Error != "" {
+		t.Fatal(status.Error)
+	}
+	if status.Report == nil || status.Report.UnknownProvider != 10 || status.Report.RemovedProviders != 1 {
+		t.Fatalf("unexpected report: %+v", status.Report)
+	}
+
+	checker.Close()
+	if _, err = checker.Start(false); err == nil {
+		t.Fatal("expected error starting check after close")
+	}
+}
+
+func initRegistry(t *testing.T) *registry.Registry {
+	discoveryCfg := config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval:   config.Duration(time.Minute),
+		RediscoverWait: config.Duration(time.Minute),
+	}
+	reg, err := registry.NewRegistry(discoveryCfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
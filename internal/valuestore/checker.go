@@ -0,0 +1,98 @@
+package valuestore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/storetheindex/api/v0/admin/model"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+)
+
+// ErrCheckRunning is returned when starting a check while another check is
+// running.
+var ErrCheckRunning = errors.New("value store check already running")
+
+// Checker runs value store checks in the background, one at a time, and keeps
+// the status of the latest check.
+type Checker struct {
+	indexer  indexer.Interface
+	registry *registry.Registry
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mutex  sync.Mutex
+	status model.CheckStatus
+}
+
+// NewChecker creates a Checker that checks the value store of the indexer,
+// using the registry to find values from unknown providers.
+func NewChecker(idxr indexer.Interface, reg *registry.Registry) *Checker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Checker{
+		indexer:  idxr,
+		registry: reg,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start starts a check, which removes bad values if remove is true, and
+// returns its status.  Returns ErrCheckRunning if a check is already running.
+func (c *Checker) Start(remove bool) (model.CheckStatus, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.status.Running {
+		return c.status, ErrCheckRunning
+	}
+	if c.ctx.Err() != nil {
+		return c.status, c.ctx.Err()
+	}
+	c.status = model.CheckStatus{
+		Running: true,
+		Compact: remove,
+		Started: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		report, err := Check(c.ctx, c.indexer, c.registry, remove)
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.status.Running = false
+		c.status.Finished = time.Now().UTC().Format(time.RFC3339)
+		if err != nil {
+			log.Errorw("Value store check failed", "err", err)
+			c.status.Error = err.Error()
+			return
+		}
+		c.status.Report = report
+	}()
+
+	return c.status, nil
+}
+
+// Status returns the status of the running check, or of the latest check if
+// none is running.
+func (c *Checker) Status() model.CheckStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.status
+}
+
+// Close cancels any running check and waits for it to stop.
+func (c *Checker) Close() {
+	// Cancel while holding the mutex, so that Start does not begin a check
+	// that Close does not wait for.
+	c.mutex.Lock()
+	c.cancel()
+	c.mutex.Unlock()
+	c.wg.Wait()
+}
@@ -45,6 +45,7 @@ func main() {
 			command.SyntheticCmd,
 			command.IngestCmd,
 			command.ConfigCmd,
+			command.ValueStoreCmd,
 		},
 	}
 
@@ -0,0 +1,111 @@
+package adminserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// eventsKeepAlive is how often a comment is sent on an idle server-sent
+// events stream, so that proxies do not close it.
+const eventsKeepAlive = 15 * time.Second
+
+var eventsUpgrader = websocket.Upgrader{}
+
+// GET /registry/events
+//
+// Streams registry events as server-sent events, or as JSON messages over a
+// websocket if the request is a websocket upgrade.  A server-sent events
+// stream ends at the server's write timeout, and EventSource clients then
+// reconnect by themselves.  Websocket connections do not time out.
+func (h *adminHandler) registryEvents(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.registryEventsWebsocket(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := h.registry.Subscribe(0)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Errorw("Cannot marshal registry event", "err", err)
+				return
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *adminHandler) registryEventsWebsocket(w http.ResponseWriter, r *http.Request) {
+	// Subscribe before the upgrade, so that the client gets all events that
+	// happen once it is connected.
+	events, cancel := h.registry.Subscribe(0)
+	defer cancel()
+
+	conn, err := eventsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Errorw("Cannot upgrade to websocket", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	// Read until the client closes the connection, which ends the
+	// subscription.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err = conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package adminserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	qt "github.com/frankban/quicktest"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const eventsProviderID = "12D3KooWSG3JuvEjRkSxt93ADTjQxqe4ExbBwSkQ9Zyk1WfBaZJF"
+
+func newEventsServer(t *testing.T) (*httptest.Server, *registry.Registry) {
+	reg, err := registry.NewRegistry(config.Discovery{
+		Policy: config.Policy{
+			Allow: true,
+			Trust: true,
+		},
+		PollInterval: config.Duration(time.Minute),
+	}, nil, nil)
+	qt.Assert(t, err, qt.IsNil)
+	t.Cleanup(func() { reg.Close() })
+
+	h := newHandler(context.Background(), nil, nil, reg)
+	router := mux.NewRouter()
+	router.HandleFunc("/registry/events", h.registryEvents).Methods(http.MethodGet)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv, reg
+}
+
+func registerEventsProvider(t *testing.T, reg *registry.Registry) peer.ID {
+	peerID, err := peer.Decode(eventsProviderID)
+	qt.Assert(t, err, qt.IsNil)
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    peerID,
+			Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/9999")},
+		},
+	})
+	qt.Assert(t, err, qt.IsNil)
+	return peerID
+}
+
+func Test_RegistryEventsSSE(t *testing.T) {
+	srv, reg := newEventsServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/registry/events", nil)
+	qt.Assert(t, err, qt.IsNil)
+	resp, err := http.DefaultClient.Do(req)
+	qt.Assert(t, err, qt.IsNil)
+	defer resp.Body.Close()
+	qt.Assert(t, resp.StatusCode, qt.Equals, http.StatusOK)
+	qt.Assert(t, resp.Header.Get("Content-Type"), qt.Equals, "text/event-stream")
+
+	peerID := registerEventsProvider(t, reg)
+
+	scanner := bufio.NewScanner(resp.Body)
+	qt.Assert(t, scanner.Scan(), qt.IsTrue)
+	qt.Assert(t, scanner.Text(), qt.Equals, "event: "+registry.EventRegistered)
+	qt.Assert(t, scanner.Scan(), qt.IsTrue)
+	line := scanner.Text()
+	qt.Assert(t, strings.HasPrefix(line, "data: "), qt.IsTrue)
+
+	var ev registry.Event
+	err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, ev.Type, qt.Equals, registry.EventRegistered)
+	qt.Check(t, ev.ProviderID, qt.Equals, peerID)
+}
+
+func Test_RegistryEventsWebsocket(t *testing.T) {
+	srv, reg := newEventsServer(t)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/registry/events"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	qt.Assert(t, err, qt.IsNil)
+	defer conn.Close()
+
+	peerID := registerEventsProvider(t, reg)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ev registry.Event
+	err = conn.ReadJSON(&ev)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, ev.Type, qt.Equals, registry.EventRegistered)
+	qt.Check(t, ev.ProviderID, qt.Equals, peerID)
+}
@@ -10,8 +10,12 @@ import (
 	"os"
 
 	"github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/storetheindex/api/v0/admin/model"
+	"github.com/filecoin-project/storetheindex/internal/httpserver"
 	"github.com/filecoin-project/storetheindex/internal/importer"
 	"github.com/filecoin-project/storetheindex/internal/ingest"
+	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/internal/valuestore"
 	"github.com/gorilla/mux"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multihash"
@@ -21,18 +25,25 @@ type adminHandler struct {
 	ctx      context.Context
 	indexer  indexer.Interface
 	ingester ingest.Ingester
+	registry *registry.Registry
+	checker  *valuestore.Checker
 }
 
-func newHandler(ctx context.Context, indexer indexer.Interface, ingester ingest.Ingester) *adminHandler {
+func newHandler(ctx context.Context, indexer indexer.Interface, ingester ingest.Ingester, reg *registry.Registry) *adminHandler {
 	return &adminHandler{
 		ctx:      ctx,
 		indexer:  indexer,
 		ingester: ingester,
+		registry: reg,
+		checker:  valuestore.NewChecker(indexer, reg),
 	}
 }
 
 const importBatchSize = 64
 
+// maxLabelsSize limits the size of a request to set provider labels.
+const maxLabelsSize = 1 << 16
+
 // ----- ingest handlers -----
 
 func (h *adminHandler) subscribe(w http.ResponseWriter, r *http.Request) {
@@ -285,6 +296,82 @@ func batchIndexerEntries(batchSize int, putChan <-chan multihash.Multihash, valu
 	return errChan
 }
 
+// ----- valuestore handlers -----
+
+// POST /valuestore/check
+//
+// Starts checking the value store in the background.  The progress and result
+// are read from GET /valuestore/status.
+func (h *adminHandler) checkValueStore(w http.ResponseWriter, r *http.Request) {
+	h.startCheck(w, false)
+}
+
+// POST /valuestore/compact
+//
+// Starts checking the value store, and removing bad values, in the
+// background.
+func (h *adminHandler) compactValueStore(w http.ResponseWriter, r *http.Request) {
+	h.startCheck(w, true)
+}
+
+// GET /valuestore/status
+func (h *adminHandler) valueStoreStatus(w http.ResponseWriter, r *http.Request) {
+	status := h.checker.Status()
+	writeCheckStatus(w, http.StatusOK, &status)
+}
+
+func (h *adminHandler) startCheck(w http.ResponseWriter, remove bool) {
+	log.Infow("Checking value store", "remove", remove)
+	status, err := h.checker.Start(remove)
+	if err != nil {
+		if errors.Is(err, valuestore.ErrCheckRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Errorw("Cannot start value store check", "err", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeCheckStatus(w, http.StatusAccepted, &status)
+}
+
+func writeCheckStatus(w http.ResponseWriter, statusCode int, status *model.CheckStatus) {
+	data, err := model.MarshalCheckStatus(status)
+	if err != nil {
+		log.Errorw("Cannot marshal check status", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJsonResponse(w, statusCode, data)
+}
+
+// ----- provider handlers -----
+
+// PUT /providers/{provider}/labels
+func (h *adminHandler) setProviderLabels(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	provID, ok := decodeProviderID(vars["provider"], w)
+	if !ok {
+		return
+	}
+
+	var labels map[string]string
+	err := json.NewDecoder(io.LimitReader(r.Body, maxLabelsSize)).Decode(&labels)
+	if err != nil {
+		msg := "Cannot decode provider labels"
+		log.Errorw(msg, "err", err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	log.Infow("Setting provider labels", "provider", provID, "labels", labels)
+	if err = h.registry.SetLabels(provID, labels); err != nil {
+		httpserver.HandleError(w, err, "set provider labels")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 // ----- admin handlers -----
 
 func (h *adminHandler) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
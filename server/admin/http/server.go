@@ -10,6 +10,7 @@ import (
 	"github.com/filecoin-project/storetheindex/internal/ingest"
 	"github.com/filecoin-project/storetheindex/internal/metrics"
 	"github.com/filecoin-project/storetheindex/internal/metrics/pprof"
+	"github.com/filecoin-project/storetheindex/internal/registry"
 	"github.com/gorilla/mux"
 	logging "github.com/ipfs/go-log/v2"
 )
@@ -17,11 +18,12 @@ import (
 var log = logging.Logger("indexer/admin")
 
 type Server struct {
-	server *http.Server
-	l      net.Listener
+	server  *http.Server
+	l       net.Listener
+	handler *adminHandler
 }
 
-func New(ctx context.Context, listen string, indexer indexer.Interface, ingester ingest.Ingester, options ...ServerOption) (*Server, error) {
+func New(ctx context.Context, listen string, indexer indexer.Interface, ingester ingest.Ingester, reg *registry.Registry, options ...ServerOption) (*Server, error) {
 	var cfg serverConfig
 	if err := cfg.apply(append([]ServerOption{serverDefaults}, options...)...); err != nil {
 		return nil, err
@@ -39,9 +41,8 @@ func New(ctx context.Context, listen string, indexer indexer.Interface, ingester
 		WriteTimeout: cfg.apiWriteTimeout,
 		ReadTimeout:  cfg.apiReadTimeout,
 	}
-	s := &Server{server, l}
-
-	h := newHandler(ctx, indexer, ingester)
+	h := newHandler(ctx, indexer, ingester, reg)
+	s := &Server{server, l, h}
 
 	// Set protocol handlers
 	// Import routes
@@ -56,6 +57,15 @@ func New(ctx context.Context, listen string, indexer indexer.Interface, ingester
 	r.HandleFunc("/ingest/unsubscribe/{provider}", h.unsubscribe).Methods(http.MethodGet)
 	r.HandleFunc("/ingest/sync/{provider}", h.sync).Methods(http.MethodGet)
 
+	// Provider routes
+	r.HandleFunc("/providers/{provider}/labels", h.setProviderLabels).Methods(http.MethodPut)
+	r.HandleFunc("/registry/events", h.registryEvents).Methods(http.MethodGet)
+
+	// Value store routes
+	r.HandleFunc("/valuestore/check", h.checkValueStore).Methods(http.MethodPost)
+	r.HandleFunc("/valuestore/compact", h.compactValueStore).Methods(http.MethodPost)
+	r.HandleFunc("/valuestore/status", h.valueStoreStatus).Methods(http.MethodGet)
+
 	// Metrics routes
 	r.Handle("/metrics", metrics.Start(coremetrics.DefaultViews))
 	r.Handle("/debug/pprof", pprof.WithProfile())
@@ -74,5 +84,6 @@ func (s *Server) Start() error {
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	log.Info("admin http server shutdown")
+	s.handler.checker.Close()
 	return s.server.Shutdown(ctx)
 }
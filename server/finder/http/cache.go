@@ -0,0 +1,110 @@
+package httpfinderserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+)
+
+// etagSize is the number of bytes of the response hash used as the ETag.
+const etagSize = 16
+
+// setCacheControl sets the Cache-Control header, if maxAge is not zero.
+func setCacheControl(w http.ResponseWriter, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+}
+
+// makeETag returns a weak ETag for the find response, as encoded for the
+// content type, before it is compressed with the content coding.  Each
+// content coding of the same response gets a different ETag.
+//
+// Provider scores, and the signature that covers them, are left out, since a
+// provider's score changes as time passes since its last advertisement, and
+// the ETag must only change when the results do.  The ETag is weak because
+// responses with the same ETag can differ in their scores and signature.
+func makeETag(rsp *model.FindResponse, contentType, encoding string) (string, error) {
+	unscored := &model.FindResponse{
+		MultihashResults: make([]model.MultihashResult, len(rsp.MultihashResults)),
+	}
+	for i, mhr := range rsp.MultihashResults {
+		provResults := make([]model.ProviderResult, len(mhr.ProviderResults))
+		copy(provResults, mhr.ProviderResults)
+		for j := range provResults {
+			provResults[j].Score = 0
+		}
+		mhr.ProviderResults = provResults
+		unscored.MultihashResults[i] = mhr
+	}
+	body, err := model.MarshalFindResponseAs(unscored, contentType)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	tag := hex.EncodeToString(sum[:etagSize])
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return `W/"` + tag + `"`, nil
+}
+
+// lastModified returns the latest advertisement time of the providers in the
+// results.  Providers that are not registered with this indexer, such as
+// those from upstream indexers, are ignored.
+func (h *httpHandler) lastModified(results []model.MultihashResult) time.Time {
+	var latest time.Time
+	seen := map[string]struct{}{}
+	for i := range results {
+		for j := range results[i].ProviderResults {
+			provID := results[i].ProviderResults[j].Provider.ID
+			if _, ok := seen[string(provID)]; ok {
+				continue
+			}
+			seen[string(provID)] = struct{}{}
+			info := h.registry.ProviderInfo(provID)
+			if info != nil && info.LastAdvertisementTime.After(latest) {
+				latest = info.LastAdvertisementTime
+			}
+		}
+	}
+	return latest
+}
+
+// notModified returns true if the request's conditional headers show that the
+// client already has the current response.  If-None-Match takes precedence
+// over If-Modified-Since.
+func notModified(r *http.Request, etag string, lastMod time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastMod.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !lastMod.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// etagMatch returns true if any of the comma-separated ETags in the
+// If-None-Match header value matches etag, using weak comparison, which
+// ignores whether either ETag is weak.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package httpfinderserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings that find responses can be compressed with.
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// minCompressSize is the smallest response that is compressed.  Smaller
+// responses are not worth the cost of compressing.
+const minCompressSize = 512
+
+// responseTypes are the media types of find responses, in order of preference
+// when a client accepts more than one equally.
+var responseTypes = []string{model.JSONContentType, model.CBORContentType, model.ProtobufContentType}
+
+// responseEncodings are the supported content codings, in order of preference
+// when a client accepts more than one equally.
+var responseEncodings = []string{encodingZstd, encodingGzip}
+
+// zstdEncoder is shared by all requests, since EncodeAll is safe to call
+// concurrently.
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// acceptRange is one entry of an Accept or Accept-Encoding header.
+type acceptRange struct {
+	value string
+	q     float64
+}
+
+// parseAccept parses the comma-separated entries of an Accept or
+// Accept-Encoding header.  Entries without a q parameter have a q of 1.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			// Accept-Encoding values are tokens, not media types, and
+			// ParseMediaType rejects some that are valid, such as "*".
+			value = strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+			params = nil
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{value: value, q: q})
+	}
+	return ranges
+}
+
+// negotiate returns the offer that the client most prefers, using match to
+// check whether an offer is in a range.  Offers not in any range have a q of
+// defaultQ.  Returns an empty string if the client accepts none of the offers.
+func negotiate(ranges []acceptRange, offers []string, defaultQ float64, match func(rangeValue, offer string) bool) string {
+	var best string
+	var bestQ float64
+	for _, offer := range offers {
+		q := defaultQ
+		// The most specific matching range determines the q of the offer.
+		specificity := -1
+		for _, r := range ranges {
+			if !match(r.value, offer) {
+				continue
+			}
+			s := strings.Count(r.value, "*")
+			if specificity == -1 || s < specificity {
+				specificity = s
+				q = r.q
+			}
+		}
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+	return best
+}
+
+// negotiateContentType returns the media type of the find response that is
+// most preferred by the Accept header.  Returns an empty string if the client
+// does not accept any of them.
+func negotiateContentType(accept string) string {
+	if accept == "" {
+		return model.JSONContentType
+	}
+	return negotiate(parseAccept(accept), responseTypes, 0, func(rangeValue, offer string) bool {
+		if rangeValue == offer || rangeValue == "*/*" {
+			return true
+		}
+		return strings.HasSuffix(rangeValue, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(rangeValue, "*"))
+	})
+}
+
+// negotiateEncoding returns the content coding most preferred by the
+// Accept-Encoding header, or an empty string if the response is not to be
+// compressed.
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	return negotiate(parseAccept(acceptEncoding), responseEncodings, 0, func(rangeValue, offer string) bool {
+		return rangeValue == offer || rangeValue == "*"
+	})
+}
+
+// compress compresses data with the content coding.
+func compress(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case encodingZstd:
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	case encodingGzip:
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return data, nil
+}
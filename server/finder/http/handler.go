@@ -1,20 +1,32 @@
 package httpfinderserver
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	indexer "github.com/filecoin-project/go-indexer-core"
 	coremetrics "github.com/filecoin-project/go-indexer-core/metrics"
 	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/config"
 	"github.com/filecoin-project/storetheindex/internal/handler"
 	"github.com/filecoin-project/storetheindex/internal/httpserver"
 	"github.com/filecoin-project/storetheindex/internal/metrics"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
 	"github.com/filecoin-project/storetheindex/internal/registry"
+	"github.com/filecoin-project/storetheindex/internal/syserr"
 	"github.com/gorilla/mux"
-	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/tag"
@@ -23,11 +35,61 @@ import (
 // handler handles requests for the finder resource
 type httpHandler struct {
 	finderHandler *handler.FinderHandler
+	registry      *registry.Registry
+	cacheCfg      config.HTTPCache
 }
 
-func newHandler(indexer indexer.Interface, registry *registry.Registry) *httpHandler {
+// bytesPerMultihash is the maximum expected size of each multihash, and its
+// cursor, in a batch find request.  This is used to limit the size of the
+// request body that is read.
+const bytesPerMultihash = 256
+
+// maxStreamLine is the largest line accepted in a streaming find request.
+const maxStreamLine = 4 * bytesPerMultihash
+
+// errBodyTooLarge is returned when reading more than the maximum size of a
+// request body.
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedBody reads at most limit bytes of a request body, and returns
+// errBodyTooLarge if the body is larger.  The body is also wrapped by
+// http.MaxBytesReader, so that the server closes the connection instead of
+// reading the rest of an oversized body.
+type limitedBody struct {
+	r io.Reader
+	n int64
+}
+
+func newLimitedBody(w http.ResponseWriter, r *http.Request, limit int64) *limitedBody {
+	return &limitedBody{
+		r: http.MaxBytesReader(w, r.Body, limit+1),
+		n: limit,
+	}
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Check for data beyond the limit.
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n != 0 {
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+func newHandler(indexer indexer.Interface, registry *registry.Registry, cfg serverConfig) *httpHandler {
 	return &httpHandler{
-		finderHandler: handler.NewFinderHandler(indexer, registry),
+		finderHandler: handler.NewFinderHandler(indexer, registry, cfg.provIndex, cfg.finderCfg, cfg.signKey, cfg.upstreams, cfg.cluster),
+		registry:      registry,
+		cacheCfg:      cfg.finderCfg.HTTPCache,
 	}
 }
 
@@ -40,26 +102,51 @@ func (h *httpHandler) find(w http.ResponseWriter, r *http.Request) {
 		httpserver.HandleError(w, err, "find")
 		return
 	}
-	h.getIndexes(w, []multihash.Multihash{m})
+	req, err := findRequest(r, m)
+	if err != nil {
+		httpserver.HandleError(w, err, "find")
+		return
+	}
+	h.getIndexes(w, r, req)
 }
 
 func (h *httpHandler) findCid(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	cidVar := vars["cid"]
-	c, err := cid.Decode(cidVar)
+	c, err := model.DecodeCid(cidVar)
 	if err != nil {
 		log.Errorw("error decoding cid", "cid", cidVar, "err", err)
 		httpserver.HandleError(w, err, "find")
 		return
 	}
-	h.getIndexes(w, []multihash.Multihash{c.Hash()})
+	req, err := findRequest(r, c.Hash())
+	if err != nil {
+		httpserver.HandleError(w, err, "find")
+		return
+	}
+	// Only find providers that serve the CID's codec, unless the request
+	// already selects codecs.
+	if len(req.Codecs) == 0 {
+		req.Codecs = []multicodec.Code{model.CidCodec(c)}
+	}
+	h.getIndexes(w, r, req)
 }
 
 func (h *httpHandler) findBatch(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	if isNDJSON(r.Header.Get("Content-Type")) {
+		h.findBatchStream(w, r)
+		return
+	}
+
+	maxBody := int64(h.finderHandler.MaxBatchSize()) * bytesPerMultihash
+	body, err := io.ReadAll(newLimitedBody(w, r, maxBody))
 	if err != nil {
 		log.Errorw("failed reading get batch request", "err", err)
-		http.Error(w, "", http.StatusInternalServerError)
+		status := http.StatusBadRequest
+		if errors.Is(err, errBodyTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("cannot read request: %s", err), status)
 		return
 	}
 	req, err := model.UnmarshalFindRequest(body)
@@ -68,13 +155,218 @@ func (h *httpHandler) findBatch(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
-	h.getIndexes(w, req.Multihashes)
+	// Filter query parameters add to any filter in the request body.
+	filter, err := parseFindFilter(r)
+	if err != nil {
+		httpserver.HandleError(w, err, "find")
+		return
+	}
+	mergeFindFilter(&req.FindFilter, filter)
+	h.getIndexes(w, r, req)
 }
 
-func (h *httpHandler) getIndexes(w http.ResponseWriter, mhs []multihash.Multihash) {
+// findBatchStream handles a batch find request where the request and response
+// are newline-delimited JSON.  The results for each multihash are written as
+// they are found, so the response is not held in memory.  Over HTTP/2, the
+// request is read one line at a time, and the results for each multihash are
+// written before the next line is read.  An HTTP/1 request body cannot be read
+// once the response is started, so the request is read before any results are
+// written.  Once results have been written, an error is returned as a final
+// line holding only the error.
+func (h *httpHandler) findBatchStream(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 
-	response, err := h.finderHandler.MakeFindResponse(mhs)
+	filter, err := parseFindFilter(r)
+	if err != nil {
+		httpserver.HandleError(w, err, "find")
+		return
+	}
+
+	maxItems := h.finderHandler.MaxStreamBatchSize()
+	body := newLimitedBody(w, r, int64(maxItems)*bytesPerMultihash)
+	readFirst := r.ProtoMajor < 2
+
+	var enc *json.Encoder
+	flusher, _ := w.(http.Flusher)
+	fail := func(err error) {
+		if enc == nil {
+			httpserver.HandleError(w, err, "find")
+			return
+		}
+		log.Infow("Streaming find request failed", "err", err)
+		_ = enc.Encode(&model.FindStreamResult{Error: err.Error()})
+	}
+
+	writeResults := func(item *model.FindRequestItem) bool {
+		req := &model.FindRequest{
+			Multihashes: []multihash.Multihash{item.Multihash},
+			Cursors:     []string{item.Cursor},
+			FindFilter:  filter,
+		}
+		results, err := h.finderHandler.MakeFindResults(req)
+		if err != nil {
+			fail(err)
+			return false
+		}
+
+		if enc == nil {
+			w.Header().Set("Content-Type", model.NDJSONContentType)
+			w.WriteHeader(http.StatusOK)
+			enc = json.NewEncoder(w)
+		}
+		for j := range results {
+			err = enc.Encode(&results[j])
+			if err != nil {
+				log.Errorw("cannot write streaming find response", "err", err)
+				return false
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	var items []model.FindRequestItem
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, bytesPerMultihash), maxStreamLine)
+	var count int
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var item model.FindRequestItem
+		if err = json.Unmarshal(line, &item); err != nil {
+			fail(syserr.New(fmt.Errorf("cannot decode request: %s", err), http.StatusBadRequest))
+			return
+		}
+		count++
+		if count > maxItems {
+			err = fmt.Errorf("streaming find request exceeds maximum of %d multihashes", maxItems)
+			fail(syserr.New(err, http.StatusRequestEntityTooLarge))
+			return
+		}
+		if readFirst {
+			items = append(items, item)
+			continue
+		}
+		if !writeResults(&item) {
+			return
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errBodyTooLarge) || errors.Is(err, bufio.ErrTooLong) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		fail(syserr.New(fmt.Errorf("cannot read request: %s", err), status))
+		return
+	}
+	for i := range items {
+		if !writeResults(&items[i]) {
+			return
+		}
+	}
+	if enc == nil {
+		w.Header().Set("Content-Type", model.NDJSONContentType)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Method, "http")),
+		stats.WithMeasurements(metrics.FindLatency.M(coremetrics.MsecSince(startTime))))
+}
+
+// GET /providers/{providerid}/contexts
+func (h *httpHandler) listContexts(w http.ResponseWriter, r *http.Request) {
+	providerID, err := getProviderID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.finderHandler.MakeProviderContextsResponse(providerID)
+	if err != nil {
+		httpserver.HandleError(w, err, "list contexts")
+		return
+	}
+
+	if len(response.Contexts) == 0 {
+		http.Error(w, "no contexts for provider", http.StatusNotFound)
+		return
+	}
+
+	rb, err := model.MarshalProviderContextsResponse(response)
+	if err != nil {
+		log.Errorw("failed marshalling provider contexts response", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJsonResponse(w, http.StatusOK, rb)
+}
+
+// GET /providers/{providerid}/contexts/{contextid}/multihashes
+func (h *httpHandler) listContextMultihashes(w http.ResponseWriter, r *http.Request) {
+	providerID, err := getProviderID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctxVar := mux.Vars(r)["contextid"]
+	contextID, err := providerindex.DecodeContextID(ctxVar)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode context id: %s", err), http.StatusBadRequest)
+		return
+	}
+	offset, err := getIntParam(r, "offset")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := getIntParam(r, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.finderHandler.MakeContextMultihashesResponse(providerID, contextID, offset, limit)
+	if err != nil {
+		httpserver.HandleError(w, err, "list multihashes")
+		return
+	}
+
+	if response == nil {
+		http.Error(w, "context not found for provider", http.StatusNotFound)
+		return
+	}
+
+	rb, err := model.MarshalContextMultihashesResponse(response)
+	if err != nil {
+		log.Errorw("failed marshalling context multihashes response", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJsonResponse(w, http.StatusOK, rb)
+}
+
+// getIndexes writes the response to a find request.  The response is encoded
+// and compressed as negotiated by the request's Accept and Accept-Encoding
+// headers.  Responses to GET requests have HTTP caching headers, and are not
+// sent if the client has the current response.
+func (h *httpHandler) getIndexes(w http.ResponseWriter, r *http.Request, req *model.FindRequest) {
+	startTime := time.Now()
+	cacheable := r.Method == http.MethodGet
+
+	contentType := negotiateContentType(r.Header.Get("Accept"))
+	if contentType == "" {
+		http.Error(w, "find response available as "+strings.Join(responseTypes, ", "), http.StatusNotAcceptable)
+		return
+	}
+
+	response, err := h.finderHandler.MakeFindResponse(req)
 	if err != nil {
 		httpserver.HandleError(w, err, "get")
 		return
@@ -82,20 +374,164 @@ func (h *httpHandler) getIndexes(w http.ResponseWriter, mhs []multihash.Multihas
 
 	// If no info for any multihashes, then 404
 	if len(response.MultihashResults) == 0 {
+		if cacheable {
+			setCacheControl(w, time.Duration(h.cacheCfg.MissMaxAge))
+		}
 		http.Error(w, "no results for query", http.StatusNotFound)
 		return
 	}
 
-	rb, err := model.MarshalFindResponse(response)
+	rb, err := model.MarshalFindResponseAs(response, contentType)
 	if err != nil {
 		log.Errorw("failed marshalling query response", "err", err)
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
+	var encoding string
+	if len(rb) >= minCompressSize {
+		encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	}
 
 	_ = stats.RecordWithOptions(context.Background(),
 		stats.WithTags(tag.Insert(metrics.Method, "http")),
 		stats.WithMeasurements(metrics.FindLatency.M(coremetrics.MsecSince(startTime))))
 
-	httpserver.WriteJsonResponse(w, http.StatusOK, rb)
+	w.Header().Set("Vary", "Accept, Accept-Encoding")
+	if cacheable {
+		etag, err := makeETag(response, contentType, encoding)
+		if err != nil {
+			log.Errorw("failed making etag for query response", "err", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		lastMod := h.lastModified(response.MultihashResults)
+		w.Header().Set("ETag", etag)
+		if !lastMod.IsZero() {
+			w.Header().Set("Last-Modified", lastMod.UTC().Format(http.TimeFormat))
+		}
+		setCacheControl(w, time.Duration(h.cacheCfg.MaxAge))
+		if notModified(r, etag, lastMod) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if encoding != "" {
+		rb, err = compress(rb, encoding)
+		if err != nil {
+			log.Errorw("failed compressing query response", "encoding", encoding, "err", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(rb); err != nil {
+		log.Errorw("cannot write response", "err", err)
+	}
+}
+
+func getProviderID(r *http.Request) (peer.ID, error) {
+	pid := mux.Vars(r)["providerid"]
+	providerID, err := peer.Decode(pid)
+	if err != nil {
+		return providerID, fmt.Errorf("cannot decode provider id: %s", err)
+	}
+	return providerID, nil
+}
+
+func getIntParam(r *http.Request, name string) (int, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s parameter: %s", name, err)
+	}
+	return n, nil
+}
+
+// findRequest makes a find request for a single multihash, using the cursor
+// and filter query parameters if present.
+func findRequest(r *http.Request, m multihash.Multihash) (*model.FindRequest, error) {
+	filter, err := parseFindFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	req := &model.FindRequest{
+		Multihashes: []multihash.Multihash{m},
+		FindFilter:  filter,
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		req.Cursors = []string{cursor}
+	}
+	return req, nil
+}
+
+// parseFindFilter reads a find filter from the query parameters:
+//
+//	protocol         - protocol ID, in decimal or 0x-prefixed hex (repeatable)
+//	provider         - provider ID to include (repeatable)
+//	exclude_provider - provider ID to exclude (repeatable)
+//	context_prefix   - multibase-encoded context ID prefix
+//	codec            - IPLD codec, by name or number, of content (repeatable)
+func parseFindFilter(r *http.Request) (model.FindFilter, error) {
+	var filter model.FindFilter
+	query := r.URL.Query()
+
+	for _, proto := range query["protocol"] {
+		code, err := strconv.ParseUint(proto, 0, 64)
+		if err != nil {
+			return filter, syserr.New(fmt.Errorf("invalid protocol %q", proto), http.StatusBadRequest)
+		}
+		filter.Protocols = append(filter.Protocols, multicodec.Code(code))
+	}
+	for _, prov := range query["provider"] {
+		provID, err := peer.Decode(prov)
+		if err != nil {
+			return filter, syserr.New(fmt.Errorf("invalid provider %q: %s", prov, err), http.StatusBadRequest)
+		}
+		filter.Providers = append(filter.Providers, provID)
+	}
+	for _, prov := range query["exclude_provider"] {
+		provID, err := peer.Decode(prov)
+		if err != nil {
+			return filter, syserr.New(fmt.Errorf("invalid exclude_provider %q: %s", prov, err), http.StatusBadRequest)
+		}
+		filter.ExcludeProviders = append(filter.ExcludeProviders, provID)
+	}
+	for _, codec := range query["codec"] {
+		var code multicodec.Code
+		if err := code.Set(codec); err != nil {
+			return filter, syserr.New(fmt.Errorf("invalid codec %q", codec), http.StatusBadRequest)
+		}
+		filter.Codecs = append(filter.Codecs, code)
+	}
+	if prefix := query.Get("context_prefix"); prefix != "" {
+		ctxPrefix, err := providerindex.DecodeContextID(prefix)
+		if err != nil {
+			return filter, syserr.New(fmt.Errorf("invalid context_prefix: %s", err), http.StatusBadRequest)
+		}
+		filter.ContextIDPrefix = ctxPrefix
+	}
+	return filter, nil
+}
+
+// mergeFindFilter adds the criteria in other to filter.  A context ID prefix in
+// other replaces any in filter.
+func mergeFindFilter(filter *model.FindFilter, other model.FindFilter) {
+	filter.Protocols = append(filter.Protocols, other.Protocols...)
+	filter.Providers = append(filter.Providers, other.Providers...)
+	filter.ExcludeProviders = append(filter.ExcludeProviders, other.ExcludeProviders...)
+	filter.Codecs = append(filter.Codecs, other.Codecs...)
+	if len(other.ContextIDPrefix) != 0 {
+		filter.ContextIDPrefix = other.ContextIDPrefix
+	}
+}
+
+func isNDJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == model.NDJSONContentType
 }
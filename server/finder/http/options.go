@@ -3,6 +3,13 @@ package httpfinderserver
 import (
 	"fmt"
 	"time"
+
+	"github.com/filecoin-project/storetheindex/api/v0/finder/client"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/cluster"
+	"github.com/filecoin-project/storetheindex/internal/handler"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
+	"github.com/libp2p/go-libp2p-core/crypto"
 )
 
 const (
@@ -14,6 +21,11 @@ const (
 type serverConfig struct {
 	apiWriteTimeout time.Duration
 	apiReadTimeout  time.Duration
+	provIndex       *providerindex.Index
+	finderCfg       config.Finder
+	signKey         crypto.PrivKey
+	upstreams       []handler.Upstream
+	cluster         *cluster.Cluster
 }
 
 // ServerOption for httpserver
@@ -57,3 +69,52 @@ func ReadTimeout(t time.Duration) ServerOption {
 		return nil
 	}
 }
+
+// ProviderIndex sets the index used to list the content indexed for each
+// provider.  If not set, provider content listing is not available.
+func ProviderIndex(provIndex *providerindex.Index) ServerOption {
+	return func(c *serverConfig) error {
+		c.provIndex = provIndex
+		return nil
+	}
+}
+
+// FinderConfig sets the finder configuration, which contains limits on the
+// size of find requests and responses.
+func FinderConfig(cfg config.Finder) ServerOption {
+	return func(c *serverConfig) error {
+		c.finderCfg = cfg
+		return nil
+	}
+}
+
+// SigningKey sets the private key used to sign find responses.  If not set,
+// find responses are not signed.
+func SigningKey(privKey crypto.PrivKey) ServerOption {
+	return func(c *serverConfig) error {
+		c.signKey = privKey
+		return nil
+	}
+}
+
+// Upstream adds an upstream indexer that is queried, using the finder client,
+// for multihashes that are not found locally.  The name identifies the
+// upstream indexer in the results that came from it.
+func Upstream(name string, finder client.Finder) ServerOption {
+	return func(c *serverConfig) error {
+		c.upstreams = append(c.upstreams, handler.Upstream{
+			Name:   name,
+			Finder: finder,
+		})
+		return nil
+	}
+}
+
+// Cluster sets the sharded cluster that this indexer is a node of.  Find
+// requests for multihashes owned by other nodes are sent to those nodes.
+func Cluster(c *cluster.Cluster) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.cluster = c
+		return nil
+	}
+}
@@ -1,20 +1,31 @@
 package httpfinderserver_test
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"testing"
 	"time"
 
 	indexer "github.com/filecoin-project/go-indexer-core"
 	httpclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/http"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/providerindex"
 	"github.com/filecoin-project/storetheindex/internal/registry"
 	httpserver "github.com/filecoin-project/storetheindex/server/finder/http"
 	"github.com/filecoin-project/storetheindex/server/finder/test"
+	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
 )
 
-func setupServer(ind indexer.Interface, reg *registry.Registry, t *testing.T) *httpserver.Server {
-	s, err := httpserver.New("127.0.0.1:0", ind, reg)
+func setupServer(ind indexer.Interface, reg *registry.Registry, t *testing.T, options ...httpserver.ServerOption) *httpserver.Server {
+	s, err := httpserver.New("127.0.0.1:0", ind, reg, options...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,6 +63,330 @@ func TestFindIndexData(t *testing.T) {
 
 	test.FindIndexTest(ctx, t, c, ind, reg)
 
+	c.CloseIdleConnections()
+	err := s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProviderContexts(t *testing.T) {
+	// Initialize everything
+	provIndex := providerindex.New(test.InitIndex(t, true), dssync.MutexWrap(datastore.NewMapDatastore()))
+	reg := test.InitRegistry(t)
+	s := setupServer(provIndex, reg, t, httpserver.ProviderIndex(provIndex))
+	c := setupClient(s.URL(), t)
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.ProviderContextsTest(ctx, t, c, provIndex)
+
+	c.CloseIdleConnections()
+	err := s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindLimits(t *testing.T) {
+	// Initialize everything
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	finderCfg := config.Finder{
+		MaxBatchSize:       5,
+		MaxStreamBatchSize: 6,
+		MaxProviderResults: 1,
+	}
+	s := setupServer(ind, reg, t, httpserver.FinderConfig(finderCfg))
+	c := setupClient(s.URL(), t)
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.FindLimitsTest(ctx, t, c, ind)
+
+	// Batch request body larger than maximum batch size allows is rejected.
+	cl := &http.Client{Transport: &http.Transport{}}
+	defer cl.CloseIdleConnections()
+	body := bytes.Repeat([]byte(" "), 5*256+1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL()+"/multihash", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d for oversized request, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+
+	c.CloseIdleConnections()
+	cl.CloseIdleConnections()
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindFilter(t *testing.T) {
+	// Initialize everything
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	s := setupServer(ind, reg, t)
+	c := setupClient(s.URL(), t)
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.FindFilterTest(ctx, t, c, ind)
+
+	// Check that a bad filter query parameter is rejected.
+	mh := util.RandomMultihashes(1)[0]
+	cl := &http.Client{Transport: &http.Transport{}}
+	resp, err := cl.Get(s.URL() + "/multihash/" + mh.B58String() + "?protocol=bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	cl.CloseIdleConnections()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	c.CloseIdleConnections()
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignedFind(t *testing.T) {
+	// Initialize everything
+	priv, pub, err := p2ptest.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexerID, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	s := setupServer(ind, reg, t, httpserver.SigningKey(priv))
+	c := setupClient(s.URL(), t)
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.SignedFindTest(ctx, t, c, ind, indexerID)
+
+	c.CloseIdleConnections()
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoutingFindProviders(t *testing.T) {
+	// Initialize everything
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	s := setupServer(ind, reg, t)
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.RoutingFindProvidersTest(ctx, t, s.URL(), ind, reg)
+
+	err := s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPCache(t *testing.T) {
+	// Initialize everything
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	cacheCfg := config.HTTPCache{
+		MaxAge:     config.Duration(time.Hour),
+		MissMaxAge: config.Duration(time.Minute),
+	}
+	// Ranking is enabled, since scores change with time but must not change
+	// the ETag.
+	finderCfg := config.Finder{
+		HTTPCache: cacheCfg,
+		Ranking: config.Ranking{
+			Enabled:         true,
+			FreshnessWeight: 1,
+		},
+	}
+	s := setupServer(ind, reg, t, httpserver.FinderConfig(finderCfg))
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.HTTPCacheTest(ctx, t, s.URL(), ind, reg, cacheCfg)
+
+	err := s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindEncodings(t *testing.T) {
+	// Initialize everything
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	s := setupServer(ind, reg, t)
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.FindEncodingsTest(ctx, t, s.URL(), ind, reg)
+
+	err := s.Shutdown(ctx)
+	if err != nil {
+		t.Error("shutdown error:", err)
+	}
+	err = <-errChan
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindCid(t *testing.T) {
+	// Initialize everything
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	s := setupServer(ind, reg, t)
+
+	// Start server
+	errChan := make(chan error, 1)
+	go func() {
+		err := s.Start()
+		if err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	// Test must complete in 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	test.FindCidTest(ctx, t, s.URL(), ind, reg)
+
 	err := s.Shutdown(ctx)
 	if err != nil {
 		t.Error("shutdown error:", err)
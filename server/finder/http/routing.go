@@ -0,0 +1,43 @@
+package httpfinderserver
+
+import (
+	"net/http"
+
+	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
+	"github.com/filecoin-project/storetheindex/internal/httpserver"
+	"github.com/gorilla/mux"
+)
+
+// routingPath is the path prefix for the delegated routing API, which allows
+// IPFS nodes to use the indexer as a content router.
+const routingPath = "/routing/v1"
+
+// GET /routing/v1/providers/{cid}
+func (h *httpHandler) routingFindProviders(w http.ResponseWriter, r *http.Request) {
+	cidVar := mux.Vars(r)["cid"]
+	c, err := model.DecodeCid(cidVar)
+	if err != nil {
+		log.Errorw("error decoding cid", "cid", cidVar, "err", err)
+		http.Error(w, "invalid cid: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rsp, err := h.finderHandler.MakeRoutingProvidersResponse(c.Hash())
+	if err != nil {
+		httpserver.HandleError(w, err, "find providers")
+		return
+	}
+	if rsp == nil {
+		http.Error(w, "no providers for cid", http.StatusNotFound)
+		return
+	}
+
+	rb, err := model.MarshalRoutingProvidersResponse(rsp)
+	if err != nil {
+		log.Errorw("failed marshalling find providers response", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJsonResponse(w, http.StatusOK, rb)
+}
@@ -44,13 +44,20 @@ func New(listen string, indexer indexer.Interface, registry *registry.Registry,
 	s := &Server{server, l}
 
 	// Resource handler
-	h := newHandler(indexer, registry)
+	h := newHandler(indexer, registry, cfg)
 
 	// Client routes
 	r.HandleFunc("/cid/{cid}", h.findCid).Methods(http.MethodGet)
 	r.HandleFunc("/multihash/{multihash}", h.find).Methods(http.MethodGet)
 	r.HandleFunc("/multihash", h.findBatch).Methods(http.MethodPost)
 
+	// Delegated routing routes
+	r.HandleFunc(routingPath+"/providers/{cid}", h.routingFindProviders).Methods(http.MethodGet)
+
+	// Provider content routes
+	r.HandleFunc("/providers/{providerid}/contexts", h.listContexts).Methods(http.MethodGet)
+	r.HandleFunc("/providers/{providerid}/contexts/{contextid}/multihashes", h.listContextMultihashes).Methods(http.MethodGet)
+
 	return s, nil
 }
 
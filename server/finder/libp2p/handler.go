@@ -10,6 +10,7 @@ import (
 	"github.com/filecoin-project/storetheindex/api/v0"
 	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
 	pb "github.com/filecoin-project/storetheindex/api/v0/finder/pb"
+	"github.com/filecoin-project/storetheindex/internal/cluster"
 	"github.com/filecoin-project/storetheindex/internal/handler"
 	"github.com/filecoin-project/storetheindex/internal/libp2pserver"
 	"github.com/filecoin-project/storetheindex/internal/metrics"
@@ -27,14 +28,16 @@ var log = logging.Logger("indexer/finder")
 // handler handles requests for the providers resource
 type libp2pHandler struct {
 	finderHandler *handler.FinderHandler
+	cluster       *cluster.Cluster
 }
 
 // handlerFunc is the function signature required by handlers in this package
 type handlerFunc func(context.Context, peer.ID, *pb.FinderMessage) ([]byte, error)
 
-func newHandler(indexer indexer.Interface, registry *registry.Registry) *libp2pHandler {
+func newHandler(indexer indexer.Interface, registry *registry.Registry, cfg serverConfig) *libp2pHandler {
 	return &libp2pHandler{
-		finderHandler: handler.NewFinderHandler(indexer, registry),
+		finderHandler: handler.NewFinderHandler(indexer, registry, nil, cfg.finderCfg, cfg.signKey, cfg.upstreams, cfg.cluster),
+		cluster:       cfg.cluster,
 	}
 }
 
@@ -69,25 +72,41 @@ func (h *libp2pHandler) HandleMessage(ctx context.Context, msgPeer peer.ID, msgb
 		rspType = pb.FinderMessage_ERROR_RESPONSE
 	}
 
-	return &pb.FinderMessage{
+	rsp := &pb.FinderMessage{
 		Type: rspType,
 		Data: data,
-	}, nil
+	}
+	if rspType == pb.FinderMessage_GET_RESPONSE {
+		rsp.Codec = req.GetCodec()
+	}
+	return rsp, nil
 }
 
 func (h *libp2pHandler) get(ctx context.Context, p peer.ID, msg *pb.FinderMessage) ([]byte, error) {
 	startTime := time.Now()
 
+	contentType := model.CodecContentType(msg.GetCodec())
+	if contentType == "" {
+		return nil, fmt.Errorf("unsupported codec %d", msg.GetCodec())
+	}
+
 	req, err := model.UnmarshalFindRequest(msg.GetData())
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := h.finderHandler.MakeFindResponse(req.Multihashes)
+	// Requests from other cluster nodes are not sent upstream, since the
+	// requesting node does that.
+	var r *model.FindResponse
+	if h.cluster != nil && h.cluster.IsNode(p) {
+		r, err = h.finderHandler.MakeClusterFindResponse(req)
+	} else {
+		r, err = h.finderHandler.MakeFindResponse(req)
+	}
 	if err != nil {
 		return nil, err
 	}
-	data, err := model.MarshalFindResponse(r)
+	data, err := model.MarshalFindResponseAs(r, contentType)
 	if err != nil {
 		return nil, err
 	}
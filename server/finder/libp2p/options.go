@@ -0,0 +1,73 @@
+package p2pfinderserver
+
+import (
+	"fmt"
+
+	"github.com/filecoin-project/storetheindex/api/v0/finder/client"
+	"github.com/filecoin-project/storetheindex/config"
+	"github.com/filecoin-project/storetheindex/internal/cluster"
+	"github.com/filecoin-project/storetheindex/internal/handler"
+	"github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// serverConfig is a structure containing all the options that can be used
+// when constructing a libp2p finder server.
+type serverConfig struct {
+	finderCfg config.Finder
+	signKey   crypto.PrivKey
+	upstreams []handler.Upstream
+	cluster   *cluster.Cluster
+}
+
+// ServerOption for libp2p finder server
+type ServerOption func(*serverConfig) error
+
+// apply applies the given options to this config
+func (c *serverConfig) apply(opts ...ServerOption) error {
+	for i, opt := range opts {
+		if err := opt(c); err != nil {
+			return fmt.Errorf("p2pfinderserver option %d failed: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// FinderConfig sets the finder configuration, which contains limits on the
+// size of find requests and responses.
+func FinderConfig(cfg config.Finder) ServerOption {
+	return func(c *serverConfig) error {
+		c.finderCfg = cfg
+		return nil
+	}
+}
+
+// SigningKey sets the private key used to sign find responses.  If not set,
+// find responses are not signed.
+func SigningKey(privKey crypto.PrivKey) ServerOption {
+	return func(c *serverConfig) error {
+		c.signKey = privKey
+		return nil
+	}
+}
+
+// Upstream adds an upstream indexer that is queried, using the finder client,
+// for multihashes that are not found locally.  The name identifies the
+// upstream indexer in the results that came from it.
+func Upstream(name string, finder client.Finder) ServerOption {
+	return func(c *serverConfig) error {
+		c.upstreams = append(c.upstreams, handler.Upstream{
+			Name:   name,
+			Finder: finder,
+		})
+		return nil
+	}
+}
+
+// Cluster sets the sharded cluster that this indexer is a node of.  Find
+// requests for multihashes owned by other nodes are sent to those nodes.
+func Cluster(c *cluster.Cluster) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.cluster = c
+		return nil
+	}
+}
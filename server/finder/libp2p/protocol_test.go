@@ -6,6 +6,7 @@ import (
 
 	indexer "github.com/filecoin-project/go-indexer-core"
 	p2pclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/libp2p"
+	pb "github.com/filecoin-project/storetheindex/api/v0/finder/pb"
 	"github.com/filecoin-project/storetheindex/internal/libp2pserver"
 	"github.com/filecoin-project/storetheindex/internal/registry"
 	p2pserver "github.com/filecoin-project/storetheindex/server/finder/libp2p"
@@ -20,7 +21,10 @@ func setupServer(ctx context.Context, ind indexer.Interface, reg *registry.Regis
 	if err != nil {
 		t.Fatal(err)
 	}
-	s := p2pserver.New(ctx, h, ind, reg)
+	s, err := p2pserver.New(ctx, h, ind, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
 	return s, h
 }
 
@@ -47,3 +51,63 @@ func TestFindIndexData(t *testing.T) {
 	}
 	test.FindIndexTest(ctx, t, c, ind, reg)
 }
+
+func TestFindFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Initialize everything
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	s, sh := setupServer(ctx, ind, reg, t)
+	c := setupClient(s.ID(), t)
+	err := c.ConnectAddrs(ctx, sh.Addrs()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.FindFilterTest(ctx, t, c, ind)
+}
+
+func TestSignedFind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Initialize everything
+	h, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ind := test.InitIndex(t, false)
+	reg := test.InitRegistry(t)
+	s, err := p2pserver.New(ctx, h, ind, reg, p2pserver.SigningKey(h.Peerstore().PrivKey(h.ID())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := setupClient(s.ID(), t)
+	err = c.ConnectAddrs(ctx, h.Addrs()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.SignedFindTest(ctx, t, c, ind, h.ID())
+}
+
+func TestFindCodecs(t *testing.T) {
+	for _, codec := range []pb.FinderMessage_Codec{pb.FinderMessage_JSON, pb.FinderMessage_CBOR, pb.FinderMessage_PROTOBUF} {
+		t.Run(codec.String(), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Initialize everything
+			ind := test.InitIndex(t, false)
+			reg := test.InitRegistry(t)
+			s, sh := setupServer(ctx, ind, reg, t)
+			c := setupClient(s.ID(), t)
+			c.SetCodec(codec)
+			err := c.ConnectAddrs(ctx, sh.Addrs()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.FindIndexTest(ctx, t, c, ind, reg)
+		})
+	}
+}
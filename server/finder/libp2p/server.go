@@ -10,6 +10,10 @@ import (
 )
 
 // New creates a new libp2p server
-func New(ctx context.Context, h host.Host, indexer indexer.Interface, registry *registry.Registry) *libp2pserver.Server {
-	return libp2pserver.New(ctx, h, newHandler(indexer, registry))
+func New(ctx context.Context, h host.Host, indexer indexer.Interface, registry *registry.Registry, options ...ServerOption) (*libp2pserver.Server, error) {
+	var cfg serverConfig
+	if err := cfg.apply(options...); err != nil {
+		return nil, err
+	}
+	return libp2pserver.New(ctx, h, newHandler(indexer, registry, cfg)), nil
 }
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,12 +19,17 @@ import (
 	"github.com/filecoin-project/go-indexer-core/store/storethehash"
 	v0 "github.com/filecoin-project/storetheindex/api/v0"
 	"github.com/filecoin-project/storetheindex/api/v0/finder/client"
+	httpclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/http"
 	"github.com/filecoin-project/storetheindex/api/v0/finder/model"
 	"github.com/filecoin-project/storetheindex/config"
 	"github.com/filecoin-project/storetheindex/internal/registry"
 	"github.com/filecoin-project/storetheindex/test/util"
+	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 )
 
@@ -194,6 +202,821 @@ func FindIndexTest(ctx context.Context, t *testing.T, c client.Finder, ind index
 	}
 }
 
+// ProviderContextsTest checks listing the contexts and multihashes indexed for
+// a provider.
+func ProviderContextsTest(ctx context.Context, t *testing.T, c *httpclient.Client, ind indexer.Interface) {
+	mhs := util.RandomMultihashes(15)
+	p, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxID := []byte("test-context-id")
+	metadata := v0.Metadata{
+		ProtocolID: protocolID,
+		Data:       []byte(mhs[0]),
+	}
+	encMetadata, err := metadata.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := indexer.Value{
+		ProviderID:    p,
+		ContextID:     ctxID,
+		MetadataBytes: encMetadata,
+	}
+	populateIndex(ind, mhs, v, t)
+
+	ctxResp, err := c.ProviderContexts(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ctxResp.Contexts) != 1 {
+		t.Fatalf("expected 1 context, got %d", len(ctxResp.Contexts))
+	}
+	ctxResult := ctxResp.Contexts[0]
+	if !bytes.Equal(ctxResult.ContextID, ctxID) {
+		t.Fatal("wrong context id in response")
+	}
+	if !ctxResult.Metadata.Equal(metadata) {
+		t.Fatal("wrong metadata in response")
+	}
+	if ctxResult.MultihashCount != uint64(len(mhs)) {
+		t.Fatalf("expected %d multihashes, got %d", len(mhs), ctxResult.MultihashCount)
+	}
+
+	// Read all multihashes, a page at a time.
+	var found []multihash.Multihash
+	var offset int
+	for {
+		mhResp, err := c.ContextMultihashes(ctx, p, ctxID, offset, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, mhResp.Multihashes...)
+		if mhResp.NextOffset == 0 {
+			break
+		}
+		offset = mhResp.NextOffset
+	}
+	if len(found) != len(mhs) {
+		t.Fatalf("expected %d multihashes, got %d", len(mhs), len(found))
+	}
+	for i := range mhs {
+		if !hasMultihash(found, mhs[i]) {
+			t.Fatal("missing multihash in context listing")
+		}
+	}
+
+	// Unknown context
+	mhResp, err := c.ContextMultihashes(ctx, p, []byte("unknown"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mhResp.Multihashes) != 0 {
+		t.Fatal("expected no multihashes for unknown context")
+	}
+}
+
+// FindLimitsTest checks that batch size limits are enforced, that provider
+// results are continued using cursors, and that streaming find returns all
+// results.  The server must be configured with a maximum batch size of 5 and
+// at most 1 provider result for each multihash.
+func FindLimitsTest(ctx context.Context, t *testing.T, c *httpclient.Client, ind indexer.Interface) {
+	mhs := util.RandomMultihashes(6)
+	p, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := v0.Metadata{
+		ProtocolID: protocolID,
+		Data:       []byte(mhs[0]),
+	}
+	encMetadata, err := metadata.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Index the multihashes under 3 different contexts, so that there are 3
+	// provider results for each multihash.
+	for i := 0; i < 3; i++ {
+		v := indexer.Value{
+			ProviderID:    p,
+			ContextID:     []byte(fmt.Sprint("test-context-", i)),
+			MetadataBytes: encMetadata,
+		}
+		if err = ind.Put(v, mhs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Batch larger than maximum is rejected
+	_, err = c.FindBatch(ctx, mhs)
+	if err == nil {
+		t.Fatal("expected error for batch larger than maximum")
+	}
+
+	// Read all provider results using cursors
+	var cursors []string
+	var provResults int
+	for {
+		resp, err := c.FindBatchCursors(ctx, mhs[:1], cursors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.MultihashResults) != 1 {
+			t.Fatalf("expected 1 multihash result, got %d", len(resp.MultihashResults))
+		}
+		result := resp.MultihashResults[0]
+		if len(result.ProviderResults) != 1 {
+			t.Fatalf("expected 1 provider result, got %d", len(result.ProviderResults))
+		}
+		provResults++
+		if result.Cursor == "" {
+			break
+		}
+		cursors = []string{result.Cursor}
+	}
+	if provResults != 3 {
+		t.Fatalf("expected 3 provider results, got %d", provResults)
+	}
+
+	// Bad cursor is rejected
+	_, err = c.FindBatchCursors(ctx, mhs[:1], []string{"bad-cursor"})
+	if err == nil {
+		t.Fatal("expected error for bad cursor")
+	}
+
+	// Streaming find returns a result for each multihash
+	var found []multihash.Multihash
+	err = c.FindBatchStream(ctx, mhs[:5], func(result model.MultihashResult) error {
+		found = append(found, result.Multihash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 5 {
+		t.Fatalf("expected 5 streamed results, got %d", len(found))
+	}
+	for i := range found {
+		if !hasMultihash(mhs[:5], found[i]) {
+			t.Fatal("unexpected multihash in streamed results")
+		}
+	}
+
+	// Streaming batch may be larger than the maximum batch size, and reads
+	// all provider results using cursors.
+	cursors = nil
+	provResults = 0
+	for {
+		var next []string
+		var nextMhs []multihash.Multihash
+		err = c.FindBatchStreamCursors(ctx, mhs, cursors, func(result model.MultihashResult) error {
+			provResults += len(result.ProviderResults)
+			if result.Cursor != "" {
+				nextMhs = append(nextMhs, result.Multihash)
+				next = append(next, result.Cursor)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(next) == 0 {
+			break
+		}
+		mhs, cursors = nextMhs, next
+	}
+	if provResults != 3*6 {
+		t.Fatalf("expected %d streamed provider results, got %d", 3*6, provResults)
+	}
+
+	// Streaming batch larger than maximum streaming batch size is rejected
+	err = c.FindBatchStream(ctx, util.RandomMultihashes(7), func(result model.MultihashResult) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error for streaming batch larger than maximum")
+	}
+}
+
+// FilterFinder is a finder client that supports filtering results.
+type FilterFinder interface {
+	FindBatchFilter(context.Context, []multihash.Multihash, model.FindFilter) (*model.FindResponse, error)
+}
+
+// FindFilterTest checks that find results are filtered by protocol, provider
+// and context ID prefix.
+func FindFilterTest(ctx context.Context, t *testing.T, c FilterFinder, ind indexer.Interface) {
+	mhs := util.RandomMultihashes(5)
+	p, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := peer.Decode("12D3KooWSG3JuvEjRkSxt93ADTjQxqe4ExbBwSkQ9Zyk1WfBaZJF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []struct {
+		provID  peer.ID
+		ctxID   string
+		protoID uint64
+	}{
+		{p, "bitswap-1", protocolID},
+		{p, "graphsync-1", protocolID + 1},
+		{otherID, "bitswap-2", protocolID},
+	}
+	for _, val := range values {
+		metadata := v0.Metadata{
+			ProtocolID: multicodec.Code(val.protoID),
+			Data:       []byte(val.ctxID),
+		}
+		encMetadata, err := metadata.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := indexer.Value{
+			ProviderID:    val.provID,
+			ContextID:     []byte(val.ctxID),
+			MetadataBytes: encMetadata,
+		}
+		if err = ind.Put(v, mhs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	countResults := func(filter model.FindFilter) int {
+		resp, err := c.FindBatchFilter(ctx, mhs[:1], filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.MultihashResults) == 0 {
+			return 0
+		}
+		return len(resp.MultihashResults[0].ProviderResults)
+	}
+
+	if n := countResults(model.FindFilter{}); n != 3 {
+		t.Fatalf("expected 3 unfiltered results, got %d", n)
+	}
+	if n := countResults(model.FindFilter{Protocols: []multicodec.Code{protocolID}}); n != 2 {
+		t.Fatalf("expected 2 results for protocol, got %d", n)
+	}
+	if n := countResults(model.FindFilter{Providers: []peer.ID{otherID}}); n != 1 {
+		t.Fatalf("expected 1 result for provider, got %d", n)
+	}
+	if n := countResults(model.FindFilter{ExcludeProviders: []peer.ID{otherID}}); n != 2 {
+		t.Fatalf("expected 2 results excluding provider, got %d", n)
+	}
+	if n := countResults(model.FindFilter{ContextIDPrefix: []byte("bitswap")}); n != 2 {
+		t.Fatalf("expected 2 results for context prefix, got %d", n)
+	}
+	filter := model.FindFilter{
+		Protocols:        []multicodec.Code{protocolID},
+		ExcludeProviders: []peer.ID{p},
+	}
+	if n := countResults(filter); n != 1 {
+		t.Fatalf("expected 1 result for combined filter, got %d", n)
+	}
+	if n := countResults(model.FindFilter{Protocols: []multicodec.Code{0x1234}}); n != 0 {
+		t.Fatalf("expected no results for unknown protocol, got %d", n)
+	}
+}
+
+// SignedFindTest checks that find responses are signed by the indexer
+// identified by indexerID.  The server must be configured to sign responses.
+func SignedFindTest(ctx context.Context, t *testing.T, c client.Finder, ind indexer.Interface, indexerID peer.ID) {
+	mhs := util.RandomMultihashes(5)
+	p, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := v0.Metadata{
+		ProtocolID: protocolID,
+		Data:       []byte(mhs[0]),
+	}
+	encMetadata, err := metadata.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := indexer.Value{
+		ProviderID:    p,
+		ContextID:     []byte("test-context-id"),
+		MetadataBytes: encMetadata,
+	}
+	populateIndex(ind, mhs, v, t)
+
+	verifier := client.VerifySignatures(c, indexerID)
+	resp, err := verifier.FindBatch(ctx, mhs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.MultihashResults) != len(mhs) {
+		t.Fatalf("expected %d results, got %d", len(mhs), len(resp.MultihashResults))
+	}
+	if _, err = verifier.Find(ctx, mhs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Responses are not accepted as coming from a different indexer.
+	verifier = client.VerifySignatures(c, p)
+	if _, err = verifier.Find(ctx, mhs[0]); err == nil {
+		t.Fatal("expected error verifying response from wrong indexer")
+	}
+}
+
+// RoutingFindProvidersTest checks that the delegated routing endpoint, of the
+// finder server at baseURL, returns a record for each provider and transport.
+func RoutingFindProvidersTest(ctx context.Context, t *testing.T, baseURL string, ind indexer.Interface, reg *registry.Registry) {
+	cl := newHTTPClient()
+	defer cl.CloseIdleConnections()
+
+	mhs := util.RandomMultihashes(2)
+	p, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/9999")
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    p,
+			Addrs: []multiaddr.Multiaddr{a},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Index the multihash twice for each transport, so that there are
+	// duplicate provider records to remove.
+	for i, proto := range []multicodec.Code{model.TransportBitswap, model.TransportBitswap, model.TransportGraphsyncFilecoinV1, model.TransportGraphsyncFilecoinV1} {
+		encMetadata, err := v0.Metadata{ProtocolID: proto}.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := indexer.Value{
+			ProviderID:    p,
+			ContextID:     []byte(fmt.Sprint("test-context-", i)),
+			MetadataBytes: encMetadata,
+		}
+		if err = ind.Put(v, mhs[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	getProviders := func(mh multihash.Multihash) (*model.RoutingProvidersResponse, int) {
+		c := cid.NewCidV1(cid.Raw, mh)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/routing/v1/providers/"+c.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer drainClose(resp)
+		if resp.StatusCode != http.StatusOK {
+			return nil, resp.StatusCode
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp, err := model.UnmarshalRoutingProvidersResponse(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rsp, resp.StatusCode
+	}
+
+	rsp, status := getProviders(mhs[0])
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if len(rsp.Providers) != 2 {
+		t.Fatalf("expected 2 provider records, got %d", len(rsp.Providers))
+	}
+	schemas := map[string]bool{}
+	for _, rec := range rsp.Providers {
+		if rec.ID != p {
+			t.Fatalf("wrong provider ID %s", rec.ID)
+		}
+		if len(rec.Addrs) != 1 || rec.Addrs[0] != a.String() {
+			t.Fatalf("wrong provider addresses %v", rec.Addrs)
+		}
+		schemas[rec.Schema] = true
+	}
+	if !schemas[model.RoutingSchemaBitswap] || !schemas[model.RoutingSchemaGraphsync] {
+		t.Fatalf("expected bitswap and graphsync records, got %v", rsp.Providers)
+	}
+
+	if _, status = getProviders(mhs[1]); status != http.StatusNotFound {
+		t.Fatalf("expected status %d for unknown cid, got %d", http.StatusNotFound, status)
+	}
+}
+
+// HTTPCacheTest checks the HTTP caching headers of GET find responses, and
+// that a conditional request for an unchanged response gets a 304.  The server
+// must be configured with the given HTTP cache configuration.
+func HTTPCacheTest(ctx context.Context, t *testing.T, baseURL string, ind indexer.Interface, reg *registry.Registry, cacheCfg config.HTTPCache) {
+	cl := newHTTPClient()
+	defer cl.CloseIdleConnections()
+
+	mhs := util.RandomMultihashes(2)
+	p, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adTime := time.Date(2021, time.October, 5, 10, 30, 0, 0, time.UTC)
+	a, _ := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/9999")
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    p,
+			Addrs: []multiaddr.Multiaddr{a},
+		},
+		LastAdvertisementTime: adTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encMetadata, err := v0.Metadata{ProtocolID: protocolID}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := indexer.Value{
+		ProviderID:    p,
+		ContextID:     []byte("test-context-id"),
+		MetadataBytes: encMetadata,
+	}
+	populateIndex(ind, mhs[:1], v, t)
+
+	get := func(mh multihash.Multihash, header map[string]string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/multihash/"+mh.B58String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		drainClose(resp)
+		return resp
+	}
+	maxAge := func(d config.Duration) string {
+		return fmt.Sprintf("public, max-age=%d", int(time.Duration(d).Seconds()))
+	}
+
+	resp := get(mhs[0], nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expected weak ETag in response, got %q", etag)
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != adTime.Format(http.TimeFormat) {
+		t.Fatalf("expected Last-Modified %q, got %q", adTime.Format(http.TimeFormat), lm)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != maxAge(cacheCfg.MaxAge) {
+		t.Fatalf("expected Cache-Control %q, got %q", maxAge(cacheCfg.MaxAge), cc)
+	}
+
+	// The same content gets the same ETag.
+	resp = get(mhs[0], nil)
+	if resp.Header.Get("ETag") != etag {
+		t.Fatal("ETag changed for unchanged response")
+	}
+
+	// Conditional requests for the current response get a 304.
+	resp = get(mhs[0], map[string]string{"If-None-Match": `"other", ` + etag})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected status %d for matching ETag, got %d", http.StatusNotModified, resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") != etag {
+		t.Fatal("wrong ETag in not modified response")
+	}
+	// Weak comparison also matches the ETag without the weak prefix.
+	resp = get(mhs[0], map[string]string{"If-None-Match": strings.TrimPrefix(etag, "W/")})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected status %d for matching strong ETag, got %d", http.StatusNotModified, resp.StatusCode)
+	}
+	resp = get(mhs[0], map[string]string{"If-Modified-Since": adTime.Format(http.TimeFormat)})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected status %d for If-Modified-Since, got %d", http.StatusNotModified, resp.StatusCode)
+	}
+	resp = get(mhs[0], map[string]string{"If-Modified-Since": adTime.Add(-time.Hour).Format(http.TimeFormat)})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d for earlier If-Modified-Since, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// A changed response gets a new ETag.
+	v.ContextID = []byte("other-context-id")
+	if err = ind.Put(v, mhs[0]); err != nil {
+		t.Fatal(err)
+	}
+	resp = get(mhs[0], map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d for changed response, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") == etag {
+		t.Fatal("ETag not changed for changed response")
+	}
+
+	// Misses have their own max age.
+	resp = get(mhs[1], nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != maxAge(cacheCfg.MissMaxAge) {
+		t.Fatalf("expected Cache-Control %q for miss, got %q", maxAge(cacheCfg.MissMaxAge), cc)
+	}
+}
+
+// FindEncodingsTest checks that find responses are encoded and compressed as
+// requested by the Accept and Accept-Encoding headers.
+func FindEncodingsTest(ctx context.Context, t *testing.T, baseURL string, ind indexer.Interface, reg *registry.Registry) {
+	cl := newHTTPClient()
+	defer cl.CloseIdleConnections()
+
+	mhs := util.RandomMultihashes(20)
+	p, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/9999")
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{
+			ID:    p,
+			Addrs: []multiaddr.Multiaddr{a},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encMetadata, err := v0.Metadata{ProtocolID: protocolID}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := indexer.Value{
+		ProviderID:    p,
+		ContextID:     []byte("test-context-id"),
+		MetadataBytes: encMetadata,
+	}
+	populateIndex(ind, mhs, v, t)
+
+	reqData, err := model.MarshalFindRequest(&model.FindRequest{Multihashes: mhs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func(accept, acceptEncoding string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/multihash", bytes.NewReader(reqData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		// Setting Accept-Encoding stops the transport from decompressing
+		// the response.
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		accept         string
+		acceptEncoding string
+		contentType    string
+		encoding       string
+	}{
+		{"", "identity", model.JSONContentType, ""},
+		{"application/cbor", "gzip", model.CBORContentType, "gzip"},
+		{"application/x-protobuf, application/json;q=0.5", "gzip;q=0.5, zstd", model.ProtobufContentType, "zstd"},
+		{"application/json;q=0.1, */*", "*", model.CBORContentType, "zstd"},
+	}
+	for _, test := range tests {
+		resp := find(test.accept, test.acceptEncoding)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != test.contentType {
+			t.Fatalf("Accept %q: expected content type %q, got %q", test.accept, test.contentType, ct)
+		}
+		if ce := resp.Header.Get("Content-Encoding"); ce != test.encoding {
+			t.Fatalf("Accept-Encoding %q: expected content encoding %q, got %q", test.acceptEncoding, test.encoding, ce)
+		}
+		if test.encoding != "" {
+			continue
+		}
+		r, err := model.UnmarshalFindResponseAs(body, test.contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.MultihashResults) != len(mhs) {
+			t.Fatalf("expected %d results, got %d", len(mhs), len(r.MultihashResults))
+		}
+	}
+
+	resp := find("text/plain", "")
+	drainClose(resp)
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("expected status %d for unsupported Accept, got %d", http.StatusNotAcceptable, resp.StatusCode)
+	}
+
+	// The finder client decodes the compressed binary response.
+	c, err := httpclient.New(baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.CloseIdleConnections()
+	r, err := c.FindBatch(ctx, mhs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.MultihashResults) != len(mhs) {
+		t.Fatalf("expected %d results from client, got %d", len(mhs), len(r.MultihashResults))
+	}
+}
+
+// FindCidTest checks finding by CID, where the CID's codec selects providers
+// that serve that codec, any encoding of the CID finds the same results, and
+// an identity CID returns its inlined data.
+func FindCidTest(ctx context.Context, t *testing.T, baseURL string, ind indexer.Interface, reg *registry.Registry) {
+	cl := newHTTPClient()
+	defer cl.CloseIdleConnections()
+
+	mh := util.RandomMultihashes(1)[0]
+	a, _ := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/9999")
+	encMetadata, err := v0.Metadata{ProtocolID: protocolID}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Register a provider that serves dag-pb, one that serves raw, and one
+	// that does not advertise codecs.
+	dagPBProv, err := peer.Decode(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.Register(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{ID: dagPBProv, Addrs: []multiaddr.Multiaddr{a}},
+		Codecs:   []multicodec.Code{multicodec.DagPb},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawProv, err := p2ptest.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.Replicate(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{ID: rawProv, Addrs: []multiaddr.Multiaddr{a}},
+		Codecs:   []multicodec.Code{multicodec.Raw},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anyProv, err := p2ptest.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.Replicate(&registry.ProviderInfo{
+		AddrInfo: peer.AddrInfo{ID: anyProv, Addrs: []multiaddr.Multiaddr{a}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []peer.ID{dagPBProv, rawProv, anyProv} {
+		v := indexer.Value{
+			ProviderID:    p,
+			ContextID:     []byte("test-context-id"),
+			MetadataBytes: encMetadata,
+		}
+		if err = ind.Put(v, mh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(path string) (*model.FindResponse, int) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer drainClose(resp)
+		if resp.StatusCode != http.StatusOK {
+			return nil, resp.StatusCode
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := model.UnmarshalFindResponse(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r, resp.StatusCode
+	}
+	checkProviders := func(path string, expect ...peer.ID) {
+		r, status := find(path)
+		if status != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", path, http.StatusOK, status)
+		}
+		if len(r.MultihashResults) != 1 {
+			t.Fatalf("%s: expected 1 result, got %d", path, len(r.MultihashResults))
+		}
+		provResults := r.MultihashResults[0].ProviderResults
+		if len(provResults) != len(expect) {
+			t.Fatalf("%s: expected %d provider results, got %d", path, len(expect), len(provResults))
+		}
+		for _, pr := range provResults {
+			if !containsPeerID(expect, pr.Provider.ID) {
+				t.Fatalf("%s: unexpected provider %s", path, pr.Provider.ID)
+			}
+		}
+	}
+
+	// Every encoding of a dag-pb CID finds the same providers.
+	dagPBCid := cid.NewCidV1(cid.DagProtobuf, mh)
+	cidStrs := []string{cid.NewCidV0(mh).String()}
+	for _, base := range []multibase.Encoding{multibase.Base32, multibase.Base32Upper, multibase.Base36, multibase.Base58BTC} {
+		s, err := dagPBCid.StringOfBase(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cidStrs = append(cidStrs, s)
+	}
+	for _, s := range cidStrs {
+		checkProviders("/cid/"+s, dagPBProv, anyProv)
+	}
+	checkProviders("/cid/"+cid.NewCidV1(cid.Raw, mh).String(), rawProv, anyProv)
+
+	// Finding by multihash is not filtered, unless codecs are given.
+	checkProviders("/multihash/"+mh.B58String(), dagPBProv, rawProv, anyProv)
+	checkProviders("/multihash/"+mh.B58String()+"?codec=raw", rawProv, anyProv)
+	checkProviders("/multihash/"+mh.B58String()+"?codec=0x70&codec=raw", dagPBProv, rawProv, anyProv)
+	if _, status := find("/multihash/" + mh.B58String() + "?codec=nosuchcodec"); status != http.StatusBadRequest {
+		t.Fatalf("expected status %d for unknown codec, got %d", http.StatusBadRequest, status)
+	}
+
+	// An identity CID returns its data, without looking for providers.
+	data := []byte("inline content")
+	idMh, err := multihash.Sum(data, multihash.IDENTITY, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, status := find("/cid/" + cid.NewCidV1(cid.Raw, idMh).String())
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d for identity cid, got %d", http.StatusOK, status)
+	}
+	if len(r.MultihashResults) != 1 {
+		t.Fatalf("expected 1 result for identity cid, got %d", len(r.MultihashResults))
+	}
+	if !bytes.Equal(r.MultihashResults[0].Data, data) {
+		t.Fatalf("expected inline data %q, got %q", data, r.MultihashResults[0].Data)
+	}
+	if len(r.MultihashResults[0].ProviderResults) != 0 {
+		t.Fatal("expected no provider results for identity cid")
+	}
+}
+
+// newHTTPClient returns an HTTP client with its own connections, which the
+// test closes before the server is shut down.  Otherwise, the server waits for
+// connections that the client opened but did not use.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{}}
+}
+
+// drainClose reads the rest of the response body and closes it, so that the
+// connection can be reused.
+func drainClose(resp *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func containsPeerID(peers []peer.ID, id peer.ID) bool {
+	for i := range peers {
+		if peers[i] == id {
+			return true
+		}
+	}
+	return false
+}
+
 func checkResponse(r *model.FindResponse, mhs []multihash.Multihash, expected []model.ProviderResult) error {
 	// Check if everything was returned.
 	if len(r.MultihashResults) != len(mhs) {
@@ -208,7 +1031,7 @@ func checkResponse(r *model.FindResponse, mhs []multihash.Multihash, expected []
 		// Check if same value
 		for j, pr := range r.MultihashResults[i].ProviderResults {
 			if !pr.Equal(expected[j]) {
-				return fmt.Errorf("wrong ProviderResult included for a multihash: %s", expected[j])
+				return fmt.Errorf("wrong ProviderResult included for a multihash: %v", expected[j])
 			}
 		}
 	}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	indexer "github.com/filecoin-project/go-indexer-core"
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/model"
 	"github.com/filecoin-project/storetheindex/internal/handler"
 	"github.com/filecoin-project/storetheindex/internal/httpserver"
 	"github.com/filecoin-project/storetheindex/internal/registry"
@@ -25,12 +26,19 @@ func newHandler(indexer indexer.Interface, registry *registry.Registry) *httpHan
 
 // ----- provider handlers -----
 
-// GET /providers",
+// GET /providers
+//
+// Query parameters select, sort, and page the providers, as described by
+// model.ListProvidersRequest.
 func (h *httpHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
-	data, err := h.ingestHandler.ListProviders()
+	req, err := model.ParseListProvidersQuery(r.URL.Query())
 	if err != nil {
-		log.Errorw("cannot list providers", "err", err)
-		http.Error(w, "", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := h.ingestHandler.ListProviders(req)
+	if err != nil {
+		httpserver.HandleError(w, err, "list providers")
 		return
 	}
 
@@ -61,6 +61,8 @@ func TestRegisterProvider(t *testing.T) {
 
 	test.ListProvidersTest(t, httpClient, peerID)
 
+	test.QueryProvidersTest(t, httpClient, peerID, reg)
+
 	test.IndexContent(t, httpClient, peerID, privKey, ind)
 
 	test.IndexContentNewAddr(t, httpClient, peerID, privKey, ind, "/ip4/127.0.0.1/tcp/7777", reg)
@@ -9,6 +9,7 @@ import (
 
 	indexer "github.com/filecoin-project/go-indexer-core"
 	"github.com/filecoin-project/storetheindex/api/v0"
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/model"
 	pb "github.com/filecoin-project/storetheindex/api/v0/ingest/pb"
 	"github.com/filecoin-project/storetheindex/internal/handler"
 	"github.com/filecoin-project/storetheindex/internal/libp2pserver"
@@ -93,10 +94,20 @@ func (h *libp2pHandler) DiscoverProvider(ctx context.Context, p peer.ID, msg *pb
 }
 
 func (h *libp2pHandler) ListProviders(ctx context.Context, p peer.ID, msg *pb.IngestMessage) ([]byte, error) {
-	data, err := h.ingestHandler.ListProviders()
+	// A request without data lists all providers.
+	var req model.ListProvidersRequest
+	if len(msg.GetData()) != 0 {
+		err := json.Unmarshal(msg.GetData(), &req)
+		if err != nil {
+			log.Errorw("error unmarshalling ListProviders request", "err", err)
+			return nil, syserr.New(errors.New("cannot decode request"), http.StatusBadRequest)
+		}
+	}
+
+	data, err := h.ingestHandler.ListProviders(&req)
 	if err != nil {
 		log.Errorw("cannot list providers", "err", err)
-		return nil, syserr.New(nil, http.StatusInternalServerError)
+		return nil, err
 	}
 
 	return data, nil
@@ -63,6 +63,8 @@ func TestRegisterProvider(t *testing.T) {
 
 	test.ListProvidersTest(t, p2pClient, peerID)
 
+	test.QueryProvidersTest(t, p2pClient, peerID, reg)
+
 	test.IndexContent(t, p2pClient, peerID, privKey, ind)
 
 	test.IndexContentNewAddr(t, p2pClient, peerID, privKey, ind, "/ip4/127.0.0.1/tcp/7777", reg)
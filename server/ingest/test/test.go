@@ -2,6 +2,7 @@ package test
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"runtime"
 	"testing"
@@ -14,11 +15,13 @@ import (
 	"github.com/filecoin-project/go-indexer-core/store/storethehash"
 	v0 "github.com/filecoin-project/storetheindex/api/v0"
 	"github.com/filecoin-project/storetheindex/api/v0/ingest/client"
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/model"
 	"github.com/filecoin-project/storetheindex/config"
 	"github.com/filecoin-project/storetheindex/internal/registry"
 	"github.com/filecoin-project/storetheindex/test/util"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
 	"github.com/multiformats/go-multiaddr"
 )
 
@@ -115,6 +118,12 @@ func GetProviderTest(t *testing.T, c client.Ingest, providerID peer.ID) {
 	if provInfo.AddrInfo.ID != providerID {
 		t.Fatal("wrong peer id")
 	}
+	if provInfo.FirstSeen == "" {
+		t.Fatal("missing first seen time")
+	}
+	if provInfo.Type != "other" {
+		t.Fatal("wrong provider type:", provInfo.Type)
+	}
 }
 
 func ListProvidersTest(t *testing.T, c client.Ingest, providerID peer.ID) {
@@ -133,6 +142,97 @@ func ListProvidersTest(t *testing.T, c client.Ingest, providerID peer.ID) {
 	}
 }
 
+// QueryProvidersTest adds providers to the registry, in addition to the
+// provider with providerID, and checks that they are filtered, sorted, and
+// paged.
+func QueryProvidersTest(t *testing.T, c client.Ingest, providerID peer.ID, reg *registry.Registry) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	maddr, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/9999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var ids []peer.ID
+	for i := 0; i < 4; i++ {
+		id, err := p2ptest.RandPeerID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		info := &registry.ProviderInfo{
+			AddrInfo: peer.AddrInfo{
+				ID:    ids[i],
+				Addrs: []multiaddr.Multiaddr{maddr},
+			},
+			LastAdvertisementTime: adTime.Add(time.Duration(i) * time.Minute),
+			Labels:                map[string]string{"group": "test"},
+		}
+		if i%2 == 0 {
+			info.DiscoveryAddr = fmt.Sprint("fil:t0100", i)
+		}
+		if err = reg.Replicate(info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Page through the providers with a label, newest advertisement first.
+	query := model.ListProvidersRequest{
+		Labels: map[string]string{"group": ""},
+		Sort:   "-" + model.SortByLastAd,
+		Limit:  3,
+	}
+	rsp, err := c.QueryProviders(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Providers) != 3 || rsp.Cursor == "" {
+		t.Fatalf("expected 3 providers and a cursor, got %d providers", len(rsp.Providers))
+	}
+	query.Cursor = rsp.Cursor
+	rsp2, err := c.QueryProviders(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp2.Providers) != 1 || rsp2.Cursor != "" {
+		t.Fatalf("expected last page with 1 provider, got %d providers", len(rsp2.Providers))
+	}
+	providers := append(rsp.Providers, rsp2.Providers...)
+	for i := range providers {
+		if providers[i].AddrInfo.ID != ids[len(ids)-1-i] {
+			t.Fatal("providers not in order of last advertisement")
+		}
+	}
+
+	// Filter without paging.
+	hasDisco := true
+	rsp, err = c.QueryProviders(ctx, model.ListProvidersRequest{
+		HasDiscoveryAddr: &hasDisco,
+		AdAfter:          adTime.Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Providers) != 1 || rsp.Providers[0].AddrInfo.ID != ids[2] {
+		t.Fatal("wrong providers selected by filter")
+	}
+
+	// Without filters, all providers are listed, including the registered one.
+	rsp, err = c.QueryProviders(ctx, model.ListProvidersRequest{Type: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Providers) != len(ids)+1 {
+		t.Fatalf("expected %d providers, got %d", len(ids)+1, len(rsp.Providers))
+	}
+
+	_, err = c.QueryProviders(ctx, model.ListProvidersRequest{Sort: "bogus"})
+	if err == nil {
+		t.Fatal("expected error for unknown sort order")
+	}
+}
+
 func IndexContent(t *testing.T, cl client.Ingest, providerID peer.ID, privateKey crypto.PrivKey, ind indexer.Interface) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -181,6 +281,26 @@ func IndexContent(t *testing.T, cl client.Ingest, providerID peer.ID, privateKey
 	if !ok {
 		t.Fatal("did not get expected content")
 	}
+
+	// Check that the provider record counts the indexed content.  The
+	// registry records it asynchronously.
+	var provInfo *model.ProviderInfo
+	for i := 0; i < 10; i++ {
+		provInfo, err = cl.GetProvider(ctx, providerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if provInfo.IndexCount != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if provInfo.IndexCount == 0 {
+		t.Fatal("indexed content not counted")
+	}
+	if len(provInfo.Protocols) != 1 || provInfo.Protocols[0] != testProtocolID {
+		t.Fatal("wrong provider protocols:", provInfo.Protocols)
+	}
 }
 
 func IndexContentNewAddr(t *testing.T, cl client.Ingest, providerID peer.ID, privateKey crypto.PrivKey, ind indexer.Interface, newAddr string, reg *registry.Registry) {